@@ -3,17 +3,30 @@ package insdash
 import "encoding/json"
 
 func CreateBatches[T any](v []T, recordLimit int, byteLimit int) ([][]T, error) {
+	var err error
+	batches := CreateBatchesFunc(v, recordLimit, byteLimit, func(record T) int {
+		js, jsErr := json.Marshal(record)
+		if jsErr != nil && err == nil {
+			err = jsErr
+		}
+
+		return len(js)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return batches, nil
+}
+
+// CreateBatchesFunc is like CreateBatches, but measures each record with size instead of its JSON representation.
+func CreateBatchesFunc[T any](v []T, recordLimit int, byteLimit int, size func(T) int) [][]T {
 	batches := make([][]T, 0)
 	buffer := make([]T, 0)
 	bufferSize := 0
 
 	for _, record := range v {
-		js, jsErr := json.Marshal(record)
-		if jsErr != nil {
-			return nil, jsErr
-		}
-
-		recordSize := len(js)
+		recordSize := size(record)
 		sizeExceeds := bufferSize+recordSize > byteLimit
 		bufferFull := len(buffer) == recordLimit
 
@@ -31,7 +44,7 @@ func CreateBatches[T any](v []T, recordLimit int, byteLimit int) ([][]T, error)
 		batches = append(batches, buffer)
 	}
 
-	return batches, nil
+	return batches
 }
 
 func Contains[T comparable](v []T, e T) bool {
@@ -32,3 +32,29 @@ func TestCreateBatches_MarshalError(t *testing.T) {
 		assert.Nil(t, batches)
 	})
 }
+
+func TestCreateBatchesFunc(t *testing.T) {
+	size := func(s string) int { return len(s) }
+
+	t.Run("should_return_batches_by_size_func", func(t *testing.T) {
+		batches := CreateBatchesFunc([]string{"aaa", "bb", "c", "dddd"}, 10, 5, size)
+
+		assert.Equal(t, [][]string{{"aaa", "bb"}, {"c", "dddd"}}, batches)
+	})
+
+	t.Run("should_return_batches_by_record_limit", func(t *testing.T) {
+		batches := CreateBatchesFunc([]string{"a", "b", "c"}, 2, 1024, size)
+
+		assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, batches)
+	})
+
+	t.Run("should_put_an_oversized_record_in_its_own_batch", func(t *testing.T) {
+		batches := CreateBatchesFunc([]string{"a", "larger than the limit", "b"}, 10, 5, size)
+
+		assert.Equal(t, [][]string{{"a"}, {"larger than the limit"}, {"b"}}, batches)
+	})
+
+	t.Run("should_return_empty_batches_when_empty", func(t *testing.T) {
+		assert.Empty(t, CreateBatchesFunc([]string{}, 10, 1024, size))
+	})
+}
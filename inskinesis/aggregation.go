@@ -0,0 +1,341 @@
+package inskinesis
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxAggregatedRecordSize is the maximum size of a Kinesis record, data and partition key included.
+const maxAggregatedRecordSize = 1024 * 1024
+
+// aggregatedRecordMagic starts every KPL aggregated record.
+var aggregatedRecordMagic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+var (
+	ErrNotAggregated            = errors.New("record is not aggregated")
+	ErrInvalidAggregatedRecord  = errors.New("invalid aggregated record")
+	ErrAggregatedRecordChecksum = errors.New("aggregated record checksum mismatch")
+)
+
+// Field numbers of the KPL AggregatedRecord and Record protobuf messages.
+const (
+	fieldPartitionKeyTable    protowire.Number = 1
+	fieldExplicitHashKeyTable protowire.Number = 2
+	fieldRecords              protowire.Number = 3
+
+	fieldPartitionKeyIndex    protowire.Number = 1
+	fieldExplicitHashKeyIndex protowire.Number = 2
+	fieldData                 protowire.Number = 3
+)
+
+// UserRecord is a record packed into a KPL aggregated record.
+type UserRecord struct {
+	PartitionKey    string
+	ExplicitHashKey string // Empty if the record has no explicit hash key.
+	Data            []byte
+}
+
+// IsAggregated reports whether data is a KPL aggregated record.
+func IsAggregated(data []byte) bool {
+	return len(data) > len(aggregatedRecordMagic)+md5.Size && bytes.HasPrefix(data, aggregatedRecordMagic)
+}
+
+// Deaggregate unpacks the user records of a KPL aggregated record.
+//
+// Returns:
+// - records: The user records in the order they were aggregated.
+// - err: ErrNotAggregated if data is not an aggregated record, ErrAggregatedRecordChecksum if its MD5 trailer does not
+// match, or ErrInvalidAggregatedRecord if it cannot be decoded.
+func Deaggregate(data []byte) ([]UserRecord, error) {
+	if !IsAggregated(data) {
+		return nil, ErrNotAggregated
+	}
+
+	message := data[len(aggregatedRecordMagic) : len(data)-md5.Size]
+	checksum := md5.Sum(message)
+	if !bytes.Equal(checksum[:], data[len(data)-md5.Size:]) {
+		return nil, ErrAggregatedRecordChecksum
+	}
+
+	var partitionKeys, explicitHashKeys []string
+	var encodedRecords [][]byte
+
+	err := consumeFields(message, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+
+		value, n := protowire.ConsumeBytes(b)
+		switch num {
+		case fieldPartitionKeyTable:
+			partitionKeys = append(partitionKeys, string(value))
+		case fieldExplicitHashKeyTable:
+			explicitHashKeys = append(explicitHashKeys, string(value))
+		case fieldRecords:
+			encodedRecords = append(encodedRecords, value)
+		}
+
+		return n, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]UserRecord, len(encodedRecords))
+	for i, encoded := range encodedRecords {
+		if records[i], err = decodeUserRecord(encoded, partitionKeys, explicitHashKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+func decodeUserRecord(encoded []byte, partitionKeys, explicitHashKeys []string) (UserRecord, error) {
+	var record UserRecord
+	hasPartitionKey := false
+
+	err := consumeFields(encoded, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == fieldPartitionKeyIndex && typ == protowire.VarintType:
+			index, n := protowire.ConsumeVarint(b)
+			if n < 0 || index >= uint64(len(partitionKeys)) {
+				return 0, ErrInvalidAggregatedRecord
+			}
+
+			record.PartitionKey = partitionKeys[index]
+			hasPartitionKey = true
+			return n, nil
+		case num == fieldExplicitHashKeyIndex && typ == protowire.VarintType:
+			index, n := protowire.ConsumeVarint(b)
+			if n < 0 || index >= uint64(len(explicitHashKeys)) {
+				return 0, ErrInvalidAggregatedRecord
+			}
+
+			record.ExplicitHashKey = explicitHashKeys[index]
+			return n, nil
+		case num == fieldData && typ == protowire.BytesType:
+			data, n := protowire.ConsumeBytes(b)
+			record.Data = data
+			return n, nil
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+	if err != nil {
+		return UserRecord{}, err
+	}
+
+	if !hasPartitionKey {
+		return UserRecord{}, ErrInvalidAggregatedRecord
+	}
+
+	return record, nil
+}
+
+// consumeFields calls f for every field of a protobuf message, f returning the length of the field value it consumed.
+func consumeFields(b []byte, f func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrInvalidAggregatedRecord
+		}
+		b = b[n:]
+
+		n, err := f(num, typ, b)
+		if err != nil {
+			return err
+		}
+
+		if n < 0 {
+			return ErrInvalidAggregatedRecord
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// aggregator packs records into a single KPL aggregated record.
+type aggregator struct {
+	first   types.PutRecordsRequestEntry // First record, whose keys are used by the aggregated record.
+	packed  []interface{}                // Records packed, in order.
+	records []byte                       // Encoded records field of the aggregated record.
+
+	partitionKeys    []string          // Partition key table.
+	partitionIndex   map[string]uint64 // Index of every partition key in the table.
+	explicitHashKeys []string          // Explicit hash key table.
+	explicitIndex    map[string]uint64 // Index of every explicit hash key in the table.
+
+	size int // Size of the encoded AggregatedRecord message.
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{
+		partitionIndex: make(map[string]uint64),
+		explicitIndex:  make(map[string]uint64),
+	}
+}
+
+// add packs an encoded record if the aggregated record stays within the Kinesis record size limit.
+//
+// Returns:
+// - ok: Whether the record was packed.
+func (a *aggregator) add(r encodedRecord) bool {
+	entry := r.entry
+	partitionKey := aws.ToString(entry.PartitionKey)
+	explicitHashKey := aws.ToString(entry.ExplicitHashKey)
+
+	size := a.size
+	partitionIndex, ok := a.partitionIndex[partitionKey]
+	if !ok {
+		partitionIndex = uint64(len(a.partitionKeys))
+		size += protowire.SizeTag(fieldPartitionKeyTable) + protowire.SizeBytes(len(partitionKey))
+	}
+
+	explicitIndex, hasExplicitIndex := a.explicitIndex[explicitHashKey]
+	if explicitHashKey != "" && !hasExplicitIndex {
+		explicitIndex = uint64(len(a.explicitHashKeys))
+		size += protowire.SizeTag(fieldExplicitHashKeyTable) + protowire.SizeBytes(len(explicitHashKey))
+	}
+
+	record := protowire.AppendTag(nil, fieldPartitionKeyIndex, protowire.VarintType)
+	record = protowire.AppendVarint(record, partitionIndex)
+	if explicitHashKey != "" {
+		record = protowire.AppendTag(record, fieldExplicitHashKeyIndex, protowire.VarintType)
+		record = protowire.AppendVarint(record, explicitIndex)
+	}
+	record = protowire.AppendTag(record, fieldData, protowire.BytesType)
+	record = protowire.AppendBytes(record, entry.Data)
+
+	size += protowire.SizeTag(fieldRecords) + protowire.SizeBytes(len(record))
+
+	aggregatePartitionKey := partitionKey
+	if len(a.packed) > 0 {
+		aggregatePartitionKey = aws.ToString(a.first.PartitionKey)
+	}
+
+	if len(aggregatedRecordMagic)+size+md5.Size+len(aggregatePartitionKey) > maxAggregatedRecordSize {
+		return false
+	}
+
+	if len(a.packed) == 0 {
+		a.first = entry
+	}
+
+	if !ok {
+		a.partitionIndex[partitionKey] = partitionIndex
+		a.partitionKeys = append(a.partitionKeys, partitionKey)
+	}
+
+	if explicitHashKey != "" && !hasExplicitIndex {
+		a.explicitIndex[explicitHashKey] = explicitIndex
+		a.explicitHashKeys = append(a.explicitHashKeys, explicitHashKey)
+	}
+
+	a.records = protowire.AppendTag(a.records, fieldRecords, protowire.BytesType)
+	a.records = protowire.AppendBytes(a.records, record)
+	a.packed = append(a.packed, r.records...)
+	a.size = size
+
+	return true
+}
+
+// encoded returns the aggregated record with the records packed in it, or the single record packed as is.
+func (a *aggregator) encoded() encodedRecord {
+	if len(a.packed) == 1 {
+		return encodedRecord{records: a.packed, entry: a.first}
+	}
+
+	message := make([]byte, 0, a.size)
+	for _, key := range a.partitionKeys {
+		message = protowire.AppendTag(message, fieldPartitionKeyTable, protowire.BytesType)
+		message = protowire.AppendString(message, key)
+	}
+
+	for _, key := range a.explicitHashKeys {
+		message = protowire.AppendTag(message, fieldExplicitHashKeyTable, protowire.BytesType)
+		message = protowire.AppendString(message, key)
+	}
+
+	message = append(message, a.records...)
+	checksum := md5.Sum(message)
+
+	data := make([]byte, 0, len(aggregatedRecordMagic)+len(message)+md5.Size)
+	data = append(data, aggregatedRecordMagic...)
+	data = append(data, message...)
+	data = append(data, checksum[:]...)
+
+	return encodedRecord{
+		records: a.packed,
+		entry: types.PutRecordsRequestEntry{
+			Data:            data,
+			PartitionKey:    a.first.PartitionKey,
+			ExplicitHashKey: a.first.ExplicitHashKey,
+		},
+	}
+}
+
+// aggregateRecords packs encoded records into as few KPL aggregated records as the Kinesis record size limit allows.
+// Records are only packed with records landing on the same shard: the shard predicted from shards when they are
+// known, or else the records sharing their explicit hash key, or their partition key without one. An aggregated record
+// takes the partition and explicit hash keys of its first record, so that its records land on their own shard, in
+// the order they were given. Records packed alone, such as records too large to be aggregated, are returned as is.
+func aggregateRecords(records []encodedRecord, shards []shardRange) []encodedRecord {
+	var aggregated []encodedRecord
+	var keys []string // Keys of the open aggregators, in the order they were opened.
+	open := make(map[string]*aggregator)
+
+	for _, r := range records {
+		key := aggregationKey(r.entry, shards)
+		a, ok := open[key]
+		if !ok {
+			a = newAggregator()
+			open[key] = a
+			keys = append(keys, key)
+		}
+
+		if a.add(r) {
+			continue
+		}
+
+		if len(a.packed) > 0 {
+			aggregated = append(aggregated, a.encoded())
+			a = newAggregator()
+			open[key] = a
+		}
+
+		if !a.add(r) {
+			aggregated = append(aggregated, r)
+		}
+	}
+
+	for _, key := range keys {
+		if a := open[key]; len(a.packed) > 0 {
+			aggregated = append(aggregated, a.encoded())
+		}
+	}
+
+	return aggregated
+}
+
+// aggregationKey returns the key of the records an entry can be packed with: its predicted shard if any,
+// or its explicit hash key, or its partition key.
+func aggregationKey(entry types.PutRecordsRequestEntry, shards []shardRange) string {
+	if len(shards) > 0 {
+		if shardId := predictShard(shards, entry); shardId != "" {
+			return "shard:" + shardId
+		}
+	}
+
+	if entry.ExplicitHashKey != nil {
+		return "hash:" + aws.ToString(entry.ExplicitHashKey)
+	}
+
+	return "key:" + aws.ToString(entry.PartitionKey)
+}
@@ -0,0 +1,255 @@
+package inskinesis
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func entry(data string, partitionKey string) types.PutRecordsRequestEntry {
+	return types.PutRecordsRequestEntry{Data: []byte(data), PartitionKey: aws.String(partitionKey)}
+}
+
+// encodedEntries returns entries as encoded records, each holding its data as record.
+func encodedEntries(entries ...types.PutRecordsRequestEntry) []encodedRecord {
+	records := make([]encodedRecord, len(entries))
+	for i, e := range entries {
+		records[i] = encodedRecord{records: []interface{}{string(e.Data)}, entry: e}
+	}
+
+	return records
+}
+
+// singleShard is a shard holding the whole hash key space.
+var singleShard = []shardRange{{id: "shard-0", start: big.NewInt(0), end: new(big.Int).Lsh(big.NewInt(1), 128)}}
+
+func Test_aggregateRecords(t *testing.T) {
+	t.Run("it_should_encode_the_kpl_format", func(t *testing.T) {
+		aggregated := aggregateRecords(encodedEntries(entry("x", "a"), entry("y", "a")), nil)
+
+		message := []byte{
+			0x0A, 0x01, 'a', // partition_key_table: "a"
+			0x1A, 0x05, 0x08, 0x00, 0x1A, 0x01, 'x', // records: {partition_key_index: 0, data: "x"}
+			0x1A, 0x05, 0x08, 0x00, 0x1A, 0x01, 'y', // records: {partition_key_index: 0, data: "y"}
+		}
+		checksum := md5.Sum(message)
+		expected := append(append([]byte{0xF3, 0x89, 0x9A, 0xC2}, message...), checksum[:]...)
+
+		require.Len(t, aggregated, 1)
+		assert.Equal(t, expected, aggregated[0].entry.Data)
+		assert.Equal(t, "a", aws.ToString(aggregated[0].entry.PartitionKey))
+		assert.Equal(t, []interface{}{"x", "y"}, aggregated[0].records)
+	})
+
+	t.Run("it_should_round_trip_records_and_keys", func(t *testing.T) {
+		withHashKey := entry("c\n", "key-2")
+		withHashKey.ExplicitHashKey = aws.String("42")
+
+		aggregated := aggregateRecords(encodedEntries(entry("a\n", "key-1"), entry("b\n", "key-2"), withHashKey), singleShard)
+		require.Len(t, aggregated, 1)
+
+		records, err := Deaggregate(aggregated[0].entry.Data)
+
+		require.NoError(t, err)
+		assert.Equal(t, []UserRecord{
+			{PartitionKey: "key-1", Data: []byte("a\n")},
+			{PartitionKey: "key-2", Data: []byte("b\n")},
+			{PartitionKey: "key-2", ExplicitHashKey: "42", Data: []byte("c\n")},
+		}, records)
+	})
+
+	t.Run("it_should_keep_single_records_as_is", func(t *testing.T) {
+		aggregated := aggregateRecords(encodedEntries(entry("a\n", "key")), nil)
+
+		assert.Equal(t, encodedEntries(entry("a\n", "key")), aggregated)
+	})
+
+	t.Run("it_should_pack_records_of_the_same_shard_in_order", func(t *testing.T) {
+		now := time.Now()
+		m, _ := newTestShardMap(&now)
+		shards, err := m.get(context.Background())
+		require.NoError(t, err)
+
+		// MD5("a") and MD5("c") fall in the lower half of the hash key space, MD5("b") in the upper half.
+		aggregated := aggregateRecords(encodedEntries(entry("1", "a"), entry("2", "b"), entry("3", "c"), entry("4", "a")), shards)
+
+		require.Len(t, aggregated, 2)
+		assert.Equal(t, []interface{}{"1", "3", "4"}, aggregated[0].records)
+		assert.Equal(t, "a", aws.ToString(aggregated[0].entry.PartitionKey))
+		assert.Equal(t, encodedEntries(entry("2", "b")), aggregated[1:])
+	})
+
+	t.Run("it_should_pack_records_sharing_their_keys_without_shards", func(t *testing.T) {
+		withHashKey := entry("3", "a")
+		withHashKey.ExplicitHashKey = aws.String("42")
+
+		aggregated := aggregateRecords(encodedEntries(entry("1", "a"), entry("2", "b"), withHashKey, entry("4", "a")), nil)
+
+		require.Len(t, aggregated, 3)
+		assert.Equal(t, []interface{}{"1", "4"}, aggregated[0].records)
+		assert.Equal(t, []interface{}{"2"}, aggregated[1].records)
+		assert.Equal(t, []interface{}{"3"}, aggregated[2].records)
+		assert.Equal(t, "42", aws.ToString(aggregated[2].entry.ExplicitHashKey))
+	})
+
+	t.Run("it_should_split_at_the_record_size_limit", func(t *testing.T) {
+		large := string(bytes.Repeat([]byte("x"), 400*1024))
+		tooLarge := string(bytes.Repeat([]byte("x"), maxAggregatedRecordSize))
+
+		aggregated := aggregateRecords(encodedEntries(
+			entry(large, "1"), entry(large, "2"), entry(large, "3"), entry(tooLarge, "4"),
+		), singleShard)
+
+		require.Len(t, aggregated, 3)
+		assert.Len(t, aggregated[0].records, 2)
+		assert.True(t, IsAggregated(aggregated[0].entry.Data))
+		assert.Equal(t, "3", aws.ToString(aggregated[1].entry.PartitionKey))
+		assert.Equal(t, large, string(aggregated[1].entry.Data), "the last fitting record should be sent alone")
+		assert.Equal(t, tooLarge, string(aggregated[2].entry.Data))
+
+		assert.LessOrEqual(t, len(aggregated[0].entry.Data)+len(aws.ToString(aggregated[0].entry.PartitionKey)), maxAggregatedRecordSize)
+		assert.Equal(t, 4, countRecords(aggregated))
+	})
+}
+
+func TestDeaggregate(t *testing.T) {
+	t.Run("it_should_reject_records_that_are_not_aggregated", func(t *testing.T) {
+		_, err := Deaggregate([]byte("{\"k\":\"v\"}\n"))
+
+		assert.ErrorIs(t, err, ErrNotAggregated)
+	})
+
+	t.Run("it_should_reject_corrupted_records", func(t *testing.T) {
+		aggregated := aggregateRecords(encodedEntries(entry("a", "1"), entry("b", "2")), singleShard)
+		data := aggregated[0].entry.Data
+		data[len(aggregatedRecordMagic)+3] ^= 0xFF
+
+		_, err := Deaggregate(data)
+
+		assert.ErrorIs(t, err, ErrAggregatedRecordChecksum)
+	})
+
+	t.Run("it_should_reject_records_with_unknown_key_indexes", func(t *testing.T) {
+		message := []byte{0x1A, 0x05, 0x08, 0x01, 0x1A, 0x01, 'x'}
+		checksum := md5.Sum(message)
+		data := append(append([]byte{0xF3, 0x89, 0x9A, 0xC2}, message...), checksum[:]...)
+
+		_, err := Deaggregate(data)
+
+		assert.ErrorIs(t, err, ErrInvalidAggregatedRecord)
+	})
+}
+
+func TestStream_PutRecords_withAggregation(t *testing.T) {
+	t.Run("it_should_send_records_aggregated_and_count_failed_user_records", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.aggregate = true
+		s.retryCount = 0
+
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+				require.Len(t, input.Records, 1)
+
+				records, err := Deaggregate(input.Records[0].Data)
+				require.NoError(t, err)
+				assert.Len(t, records, 3)
+				assert.Equal(t, []byte("{\"i\":0}\n"), records[0].Data)
+
+				return &kinesis.PutRecordsOutput{
+					FailedRecordCount: aws.Int32(1),
+					Records:           []types.PutRecordsResultEntry{{ErrorCode: aws.String("InternalFailure")}},
+				}, nil
+			})
+
+		failed, err := s.PutRecords(context.Background(), []interface{}{
+			map[string]int{"i": 0}, map[string]int{"i": 1}, map[string]int{"i": 2},
+		})
+
+		assert.EqualError(t, err, "retry count exceeded")
+		assert.Equal(t, 3, failed)
+	})
+
+	t.Run("it_should_count_the_retried_user_records", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.aggregate = true
+
+		gomock.InOrder(
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(&kinesis.PutRecordsOutput{
+				FailedRecordCount: aws.Int32(1),
+				Records:           []types.PutRecordsResultEntry{{ErrorCode: aws.String("InternalFailure")}},
+			}, nil),
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(successPutOutput(), nil),
+		)
+
+		failed, err := s.PutRecords(context.Background(), []interface{}{order{Id: 0}, order{Id: 1}, order{Id: 2}})
+
+		require.NoError(t, err)
+		assert.Zero(t, failed)
+		assert.Equal(t, int64(3), s.Stats().Retried)
+	})
+}
+
+func TestStream_Put_withAggregation(t *testing.T) {
+	t.Run("it_should_aggregate_the_flushed_buffer_before_splitting_it_into_batches", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.aggregate = true
+		s.maxStreamBatchSize = 2
+		s.start()
+
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+				require.Len(t, input.Records, 1)
+
+				records, err := Deaggregate(input.Records[0].Data)
+				require.NoError(t, err)
+				assert.Len(t, records, 5)
+
+				return successPutOutput(), nil
+			})
+
+		for i := 0; i < 5; i++ {
+			s.Put(order{Id: i})
+		}
+		s.FlushAndStopStreaming()
+
+		stats := s.Stats()
+		assert.Equal(t, int64(5), stats.Batched)
+		assert.Equal(t, int64(5), stats.Sent)
+	})
+}
+
+func TestConsumer_Start_withAggregation(t *testing.T) {
+	t.Run("it_should_deaggregate_records", func(t *testing.T) {
+		aggregated := aggregateRecords(encodedEntries(entry("1\n", "a"), entry("2\n3\n", "b")), singleShard)
+		k := &fakeKinesis{shards: []fakeShard{{id: "shard-0", records: []string{string(aggregated[0].entry.Data)}}}}
+
+		var partitionKeys []string
+		c := newTestConsumer(k, nil, func(_ context.Context, r Record) error {
+			partitionKeys = append(partitionKeys, r.PartitionKey)
+			return nil
+		})
+
+		data := collect(t, c, 3)
+
+		assert.Equal(t, []string{"1", "2", "3"}, data)
+		assert.Equal(t, []string{"a", "b", "b"}, partitionKeys)
+	})
+}
@@ -0,0 +1,150 @@
+package inskinesis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ShardEnd is the checkpoint of a shard that has been read until its end after resharding.
+const ShardEnd = "SHARD_END"
+
+// CheckpointStore persists the sequence number of the last record processed in every shard.
+// Implementations must be safe for concurrent use.
+type CheckpointStore interface {
+	// Get returns the checkpoint of a shard, or an empty string if the shard has no checkpoint.
+	Get(ctx context.Context, streamName, shardId string) (string, error)
+	// Set stores the checkpoint of a shard.
+	Set(ctx context.Context, streamName, shardId, sequenceNumber string) error
+}
+
+func checkpointKey(streamName, shardId string) string {
+	return streamName + "/" + shardId
+}
+
+type memoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]string
+}
+
+// NewMemoryCheckpointStore creates a CheckpointStore keeping checkpoints in memory, lost when the process exits.
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{checkpoints: make(map[string]string)}
+}
+
+func (s *memoryCheckpointStore) Get(_ context.Context, streamName, shardId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkpoints[checkpointKey(streamName, shardId)], nil
+}
+
+func (s *memoryCheckpointStore) Set(_ context.Context, streamName, shardId, sequenceNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[checkpointKey(streamName, shardId)] = sequenceNumber
+
+	return nil
+}
+
+type fileCheckpointStore struct {
+	path string
+
+	mu          sync.Mutex
+	checkpoints map[string]string
+}
+
+// NewFileCheckpointStore creates a CheckpointStore keeping checkpoints in a JSON file, loading the existing ones.
+// The file is replaced atomically on every update.
+func NewFileCheckpointStore(path string) (CheckpointStore, error) {
+	s := &fileCheckpointStore{path: path, checkpoints: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &s.checkpoints); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileCheckpointStore) Get(_ context.Context, streamName, shardId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkpoints[checkpointKey(streamName, shardId)], nil
+}
+
+func (s *fileCheckpointStore) Set(_ context.Context, streamName, shardId, sequenceNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[checkpointKey(streamName, shardId)] = sequenceNumber
+
+	data, err := json.Marshal(s.checkpoints)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// RedisClient is the subset of the insredis.RedisInterface used by the Redis checkpoint store.
+// Both insredis.RedisInterface and *redis.Client satisfy it.
+type RedisClient interface {
+	Get(key string) *redis.StringCmd
+	Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+}
+
+type redisCheckpointStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisCheckpointStore creates a CheckpointStore keeping checkpoints in Redis, under keys starting with prefix.
+// Example: `store := NewRedisCheckpointStore(insredis.GetClient(), "my-app:")`
+func NewRedisCheckpointStore(client RedisClient, prefix string) CheckpointStore {
+	return &redisCheckpointStore{client: client, prefix: prefix}
+}
+
+func (s *redisCheckpointStore) Get(_ context.Context, streamName, shardId string) (string, error) {
+	sequenceNumber, err := s.client.Get(s.prefix + checkpointKey(streamName, shardId)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+
+	return sequenceNumber, err
+}
+
+func (s *redisCheckpointStore) Set(_ context.Context, streamName, shardId, sequenceNumber string) error {
+	return s.client.Set(s.prefix+checkpointKey(streamName, shardId), sequenceNumber, 0).Err()
+}
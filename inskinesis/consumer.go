@@ -0,0 +1,467 @@
+package inskinesis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// KinesisConsumerInterface defines the Kinesis operations used by a consumer.
+type KinesisConsumerInterface interface {
+	ListShards(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error)
+	GetShardIterator(ctx context.Context, params *kinesis.GetShardIteratorInput, optFns ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error)
+}
+
+// ConsumerInterface defines the interface for a Kinesis stream consumer.
+type ConsumerInterface interface {
+	Start(ctx context.Context) error
+	Error() <-chan error
+}
+
+// Record is a single record read from a Kinesis stream.
+// Kinesis records holding several records, delimited following the framing of the stream or packed in KPL aggregated
+// records, are split into many Records sharing the same sequence number.
+type Record struct {
+	StreamName                  string
+	ShardId                     string
+	SequenceNumber              string
+	SubSequenceNumber           int // Index of the record within its KPL aggregated record, zero if not aggregated.
+	PartitionKey                string
+	ExplicitHashKey             string
+	ApproximateArrivalTimestamp time.Time
+	Data                        []byte
+}
+
+// Handler processes a record read by a consumer.
+type Handler func(ctx context.Context, record Record) error
+
+// ConsumerConfig represents the configuration settings of a consumer.
+type ConsumerConfig struct {
+	Region            string
+	StreamName        string
+	Checkpoints       CheckpointStore         // Store of the shard checkpoints. Defaults to an in-memory store.
+	InitialPosition   types.ShardIteratorType // Iterator type of shards without checkpoint, TRIM_HORIZON or LATEST. Defaults to TRIM_HORIZON.
+	MaxRecords        int32                   // Maximum number of records returned by each GetRecords call. Defaults to 10000.
+	PollInterval      time.Duration           // Time to wait between GetRecords calls of a shard. Defaults to 1 second.
+	ShardSyncInterval time.Duration           // Interval at which shards are listed to discover new shards. Defaults to 1 minute.
+	Framing           Framing                 // Framing of the records written by the stream. Defaults to FramingNewline.
+	EndpointUrl       string                  // Endpoint URL for AWS operations, to use a local stand-in of Kinesis.
+	Verbose           bool
+}
+
+// consumer reads the records of every shard of a Kinesis stream.
+type consumer struct {
+	name          string                   // Name of the Kinesis stream.
+	kinesisClient KinesisConsumerInterface // AWS Kinesis client for interacting with the stream.
+	handler       Handler                  // Function processing every record.
+	checkpoints   CheckpointStore          // Store of the shard checkpoints.
+
+	initialPosition   types.ShardIteratorType // Iterator type of shards without checkpoint.
+	maxRecords        int32                   // Maximum number of records returned by each GetRecords call.
+	pollInterval      time.Duration           // Time to wait between GetRecords calls of a shard.
+	shardSyncInterval time.Duration           // Interval at which shards are listed.
+	framing           Framing                 // Framing of the records, to split Kinesis records into records.
+
+	mu       sync.Mutex      // Mutex to synchronize access to running and finished.
+	running  map[string]bool // Shards being read.
+	finished map[string]bool // Shards read until their end.
+
+	syncChannel chan struct{} // Channel to trigger listing shards, when a shard ends.
+	errChannel  chan error    // Channel for receiving errors.
+
+	verbose bool // Verbose mode
+}
+
+// NewConsumer creates a consumer of a Kinesis stream, calling handler for every record.
+// Records are read from every shard concurrently, in order within a shard. Shards created by resharding are read
+// once their parent shards have been read until their end.
+//
+// Checkpoints are stored after the records returned by each GetRecords call are processed, so records are delivered
+// at least once. When the handler fails, the error is sent to the Error() channel and the shard is read again from
+// its last checkpoint after the poll interval.
+func NewConsumer(config ConsumerConfig, handler Handler) (ConsumerInterface, error) {
+	if config.Region == "" {
+		return nil, errors.New("region is required")
+	}
+
+	if config.StreamName == "" {
+		return nil, errors.New("stream name is required")
+	}
+
+	if handler == nil {
+		return nil, errors.New("handler is required")
+	}
+
+	if config.Framing != "" {
+		if err := config.Framing.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	kinesisClient, err := newKinesisClient(config.Region, config.EndpointUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConsumer(kinesisClient, config, handler), nil
+}
+
+func newConsumer(kinesisClient KinesisConsumerInterface, config ConsumerConfig, handler Handler) *consumer {
+	c := &consumer{
+		name:          config.StreamName,
+		kinesisClient: kinesisClient,
+		handler:       handler,
+		checkpoints:   config.Checkpoints,
+
+		initialPosition:   config.InitialPosition,
+		maxRecords:        config.MaxRecords,
+		pollInterval:      config.PollInterval,
+		shardSyncInterval: config.ShardSyncInterval,
+		framing:           config.Framing,
+
+		running:  make(map[string]bool),
+		finished: make(map[string]bool),
+
+		syncChannel: make(chan struct{}, 1),
+		errChannel:  make(chan error, errorChannelSize),
+
+		verbose: config.Verbose,
+	}
+
+	if c.checkpoints == nil {
+		c.checkpoints = NewMemoryCheckpointStore()
+	}
+
+	if c.initialPosition == "" {
+		c.initialPosition = types.ShardIteratorTypeTrimHorizon
+	}
+
+	if c.maxRecords == 0 {
+		c.maxRecords = 10000
+	}
+
+	if c.pollInterval == 0 {
+		c.pollInterval = time.Second
+	}
+
+	if c.shardSyncInterval == 0 {
+		c.shardSyncInterval = time.Minute
+	}
+
+	if c.framing == "" {
+		c.framing = FramingNewline
+	}
+
+	return c
+}
+
+// Error returns the channel for receiving errors.
+func (c *consumer) Error() <-chan error {
+	return c.errChannel
+}
+
+// Start reads the stream until ctx is canceled, then waits for the records being processed.
+//
+// Returns:
+// - err: The error listing the shards of the stream the first time, nil once ctx is canceled.
+func (c *consumer) Start(ctx context.Context) error {
+	shards, err := c.listShards(ctx)
+	if err != nil {
+		return err
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ticker := time.NewTicker(c.shardSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		c.startShards(ctx, shards, wg)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-c.syncChannel:
+		}
+
+		if shards, err = c.listShards(ctx); err != nil {
+			c.sendError(err)
+		}
+	}
+}
+
+func (c *consumer) listShards(ctx context.Context) ([]types.Shard, error) {
+	var shards []types.Shard
+	input := &kinesis.ListShardsInput{StreamName: aws.String(c.name)}
+
+	for {
+		res, err := c.kinesisClient.ListShards(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("error listing shards of Kinesis stream %s: %w", c.name, err)
+		}
+
+		shards = append(shards, res.Shards...)
+		if res.NextToken == nil {
+			return shards, nil
+		}
+
+		input = &kinesis.ListShardsInput{NextToken: res.NextToken}
+	}
+}
+
+// startShards starts reading the shards that are not being read, whose parents have been read until their end.
+func (c *consumer) startShards(ctx context.Context, shards []types.Shard, wg *sync.WaitGroup) {
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[aws.ToString(shard.ShardId)] = true
+	}
+
+	for _, shard := range shards {
+		shardId := aws.ToString(shard.ShardId)
+		if c.isRunning(shardId) || c.isFinished(ctx, shardId) {
+			continue
+		}
+
+		hasParent := false
+		parentsFinished := true
+		for _, parentId := range []*string{shard.ParentShardId, shard.AdjacentParentShardId} {
+			// parents past the retention period are no longer listed and have nothing left to read
+			if parentId == nil || !listed[*parentId] {
+				continue
+			}
+
+			hasParent = true
+			if !c.isFinished(ctx, *parentId) {
+				parentsFinished = false
+			}
+		}
+
+		if !parentsFinished {
+			continue
+		}
+
+		c.setRunning(shardId, true)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.setRunning(shardId, false)
+
+			c.consumeShard(ctx, shardId, hasParent)
+		}()
+	}
+}
+
+func (c *consumer) isRunning(shardId string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.running[shardId]
+}
+
+func (c *consumer) setRunning(shardId string, running bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.running[shardId] = running
+}
+
+// isFinished reports whether a shard has been read until its end, by this consumer or according to its checkpoint.
+func (c *consumer) isFinished(ctx context.Context, shardId string) bool {
+	c.mu.Lock()
+	finished := c.finished[shardId]
+	c.mu.Unlock()
+
+	if finished {
+		return true
+	}
+
+	checkpoint, err := c.checkpoints.Get(ctx, c.name, shardId)
+	if err != nil {
+		c.sendError(fmt.Errorf("error getting checkpoint of shard %s: %w", shardId, err))
+		return false
+	}
+
+	if checkpoint != ShardEnd {
+		return false
+	}
+
+	c.mu.Lock()
+	c.finished[shardId] = true
+	c.mu.Unlock()
+
+	return true
+}
+
+// consumeShard reads a shard until its end or until ctx is canceled.
+// Shards with a parent are read from their start, regardless of the initial position.
+func (c *consumer) consumeShard(ctx context.Context, shardId string, hasParent bool) {
+	checkpoint, err := c.checkpoints.Get(ctx, c.name, shardId)
+	if err != nil {
+		c.sendError(fmt.Errorf("error getting checkpoint of shard %s: %w", shardId, err))
+		return
+	}
+
+	var iterator *string
+	for ctx.Err() == nil {
+		if iterator == nil {
+			if iterator, err = c.getShardIterator(ctx, shardId, checkpoint, hasParent); err != nil {
+				c.sendError(err)
+				c.wait(ctx)
+				continue
+			}
+		}
+
+		res, err := c.kinesisClient.GetRecords(ctx, &kinesis.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         aws.Int32(c.maxRecords),
+		})
+		if err != nil {
+			c.sendError(fmt.Errorf("error getting records of shard %s: %w", shardId, err))
+			iterator = nil
+			c.wait(ctx)
+			continue
+		}
+
+		processed, err := c.processRecords(ctx, shardId, res.Records)
+		if processed != "" {
+			checkpoint = processed
+			c.setCheckpoint(ctx, shardId, checkpoint)
+		}
+
+		if err != nil {
+			c.sendError(err)
+			iterator = nil
+			c.wait(ctx)
+			continue
+		}
+
+		if res.NextShardIterator == nil {
+			c.printf("Shard %s of Kinesis stream %s has ended\n", shardId, c.name)
+			c.setCheckpoint(ctx, shardId, ShardEnd)
+			c.mu.Lock()
+			c.finished[shardId] = true
+			c.mu.Unlock()
+
+			select {
+			case c.syncChannel <- struct{}{}:
+			default:
+			}
+
+			return
+		}
+
+		iterator = res.NextShardIterator
+		c.wait(ctx)
+	}
+}
+
+func (c *consumer) getShardIterator(ctx context.Context, shardId string, checkpoint string, hasParent bool) (*string, error) {
+	input := &kinesis.GetShardIteratorInput{
+		StreamName:        aws.String(c.name),
+		ShardId:           aws.String(shardId),
+		ShardIteratorType: c.initialPosition,
+	}
+
+	if checkpoint != "" {
+		input.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+		input.StartingSequenceNumber = aws.String(checkpoint)
+	} else if hasParent {
+		input.ShardIteratorType = types.ShardIteratorTypeTrimHorizon
+	}
+
+	res, err := c.kinesisClient.GetShardIterator(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("error getting iterator of shard %s: %w", shardId, err)
+	}
+
+	return res.ShardIterator, nil
+}
+
+// processRecords calls the handler for every record, stopping at the first failure.
+//
+// Returns:
+// - sequenceNumber: The sequence number of the last record fully processed, empty if none.
+// - err: The error of the handler, nil if all records were processed.
+func (c *consumer) processRecords(ctx context.Context, shardId string, records []types.Record) (string, error) {
+	sequenceNumber := ""
+	for _, r := range records {
+		userRecords := []UserRecord{{PartitionKey: aws.ToString(r.PartitionKey), Data: r.Data}}
+		if IsAggregated(r.Data) {
+			var err error
+			if userRecords, err = Deaggregate(r.Data); err != nil {
+				return sequenceNumber, fmt.Errorf("error deaggregating record %s of shard %s: %w", aws.ToString(r.SequenceNumber), shardId, err)
+			}
+		}
+
+		for i, userRecord := range userRecords {
+			split, err := c.framing.split(userRecord.Data)
+			if err != nil {
+				// Data that cannot be split would fail on every read, so the records before the error are processed
+				// and the rest is skipped.
+				c.sendError(fmt.Errorf("error splitting record %s of shard %s: %w", aws.ToString(r.SequenceNumber), shardId, err))
+			}
+
+			for _, data := range split {
+				err := c.handler(ctx, Record{
+					StreamName:                  c.name,
+					ShardId:                     shardId,
+					SequenceNumber:              aws.ToString(r.SequenceNumber),
+					SubSequenceNumber:           i,
+					PartitionKey:                userRecord.PartitionKey,
+					ExplicitHashKey:             userRecord.ExplicitHashKey,
+					ApproximateArrivalTimestamp: aws.ToTime(r.ApproximateArrivalTimestamp),
+					Data:                        data,
+				})
+				if err != nil {
+					return sequenceNumber, fmt.Errorf("error handling record %s of shard %s: %w", aws.ToString(r.SequenceNumber), shardId, err)
+				}
+			}
+		}
+
+		sequenceNumber = aws.ToString(r.SequenceNumber)
+	}
+
+	return sequenceNumber, nil
+}
+
+func (c *consumer) setCheckpoint(ctx context.Context, shardId string, sequenceNumber string) {
+	if err := c.checkpoints.Set(ctx, c.name, shardId, sequenceNumber); err != nil {
+		c.sendError(fmt.Errorf("error setting checkpoint of shard %s: %w", shardId, err))
+	}
+}
+
+// wait pauses for the poll interval or until ctx is canceled.
+func (c *consumer) wait(ctx context.Context) {
+	timer := time.NewTimer(c.pollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+func (c *consumer) sendError(err error) {
+	c.printf("%v\n", err)
+
+	select {
+	case c.errChannel <- err:
+	default:
+	}
+}
+
+// custom printf if verbose mode is enabled
+func (c *consumer) printf(format string, a ...interface{}) {
+	if c.verbose {
+		fmt.Printf(format, a...)
+	}
+}
@@ -0,0 +1,312 @@
+package inskinesis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeShard struct {
+	id       string
+	parentId string
+	records  []string
+	closed   bool
+}
+
+// fakeKinesis serves the records of fixed shards, iterators being "<shard id>:<index of the next record>".
+type fakeKinesis struct {
+	shards []fakeShard
+
+	mu         sync.Mutex
+	iterations []string
+}
+
+func (k *fakeKinesis) ListShards(_ context.Context, _ *kinesis.ListShardsInput, _ ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+	out := &kinesis.ListShardsOutput{}
+	for _, s := range k.shards {
+		shard := types.Shard{ShardId: aws.String(s.id)}
+		if s.parentId != "" {
+			shard.ParentShardId = aws.String(s.parentId)
+		}
+		out.Shards = append(out.Shards, shard)
+	}
+
+	return out, nil
+}
+
+func (k *fakeKinesis) GetShardIterator(_ context.Context, input *kinesis.GetShardIteratorInput, _ ...func(*kinesis.Options)) (*kinesis.GetShardIteratorOutput, error) {
+	shard := k.shard(aws.ToString(input.ShardId))
+
+	index := 0
+	switch input.ShardIteratorType {
+	case types.ShardIteratorTypeAfterSequenceNumber:
+		index, _ = strconv.Atoi(strings.TrimPrefix(aws.ToString(input.StartingSequenceNumber), shard.id+"-"))
+		index++
+	case types.ShardIteratorTypeLatest:
+		index = len(shard.records)
+	}
+
+	return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String(fmt.Sprintf("%s:%d", shard.id, index))}, nil
+}
+
+func (k *fakeKinesis) GetRecords(_ context.Context, input *kinesis.GetRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+	parts := strings.Split(aws.ToString(input.ShardIterator), ":")
+	shard := k.shard(parts[0])
+	index, _ := strconv.Atoi(parts[1])
+
+	k.mu.Lock()
+	k.iterations = append(k.iterations, aws.ToString(input.ShardIterator))
+	k.mu.Unlock()
+
+	out := &kinesis.GetRecordsOutput{}
+	for i := index; i < len(shard.records); i++ {
+		out.Records = append(out.Records, types.Record{
+			SequenceNumber: aws.String(fmt.Sprintf("%s-%d", shard.id, i)),
+			PartitionKey:   aws.String("key"),
+			Data:           []byte(shard.records[i]),
+		})
+	}
+
+	if !shard.closed {
+		out.NextShardIterator = aws.String(fmt.Sprintf("%s:%d", shard.id, len(shard.records)))
+	}
+
+	return out, nil
+}
+
+func (k *fakeKinesis) shard(id string) fakeShard {
+	for _, s := range k.shards {
+		if s.id == id {
+			return s
+		}
+	}
+
+	panic("unknown shard " + id)
+}
+
+// collect runs a consumer until want records are handled, returning their data.
+func collect(t *testing.T, c *consumer, want int) []string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var data []string
+	handler := c.handler
+	c.handler = func(ctx context.Context, r Record) error {
+		if err := handler(ctx, r); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		data = append(data, string(r.Data))
+		if len(data) == want {
+			cancel()
+		}
+
+		return nil
+	}
+
+	require.NoError(t, c.Start(ctx))
+	require.Len(t, data, want)
+
+	return data
+}
+
+func nopHandler(context.Context, Record) error {
+	return nil
+}
+
+func newTestConsumer(k KinesisConsumerInterface, checkpoints CheckpointStore, handler Handler) *consumer {
+	return newConsumer(k, ConsumerConfig{
+		StreamName:        "test-stream",
+		Checkpoints:       checkpoints,
+		PollInterval:      time.Millisecond,
+		ShardSyncInterval: 10 * time.Millisecond,
+		Verbose:           true,
+	}, handler)
+}
+
+func TestNewConsumer(t *testing.T) {
+	t.Run("it_should_require_region_and_stream_name", func(t *testing.T) {
+		_, err := NewConsumer(ConsumerConfig{StreamName: "s"}, nopHandler)
+		assert.EqualError(t, err, "region is required")
+
+		_, err = NewConsumer(ConsumerConfig{Region: "eu-west-1"}, nopHandler)
+		assert.EqualError(t, err, "stream name is required")
+	})
+
+	t.Run("it_should_require_a_handler", func(t *testing.T) {
+		_, err := NewConsumer(ConsumerConfig{Region: "eu-west-1", StreamName: "s"}, nil)
+		assert.EqualError(t, err, "handler is required")
+	})
+
+	t.Run("it_should_apply_defaults", func(t *testing.T) {
+		c := newConsumer(&fakeKinesis{}, ConsumerConfig{StreamName: "s"}, nopHandler)
+
+		assert.Equal(t, types.ShardIteratorTypeTrimHorizon, c.initialPosition)
+		assert.Equal(t, int32(10000), c.maxRecords)
+		assert.Equal(t, time.Second, c.pollInterval)
+		assert.Equal(t, FramingNewline, c.framing)
+		assert.Equal(t, time.Minute, c.shardSyncInterval)
+		assert.NotNil(t, c.checkpoints)
+	})
+}
+
+func TestConsumer_Start(t *testing.T) {
+	t.Run("it_should_split_records_of_all_shards_and_checkpoint_them", func(t *testing.T) {
+		k := &fakeKinesis{shards: []fakeShard{
+			{id: "shard-0", records: []string{"{\"a\":1}\n{\"a\":2}\n", "{\"a\":3}\n"}},
+			{id: "shard-1", records: []string{"{\"b\":1}\n"}},
+		}}
+		checkpoints := NewMemoryCheckpointStore()
+
+		data := collect(t, newTestConsumer(k, checkpoints, nopHandler), 4)
+
+		assert.ElementsMatch(t, []string{`{"a":1}`, `{"a":2}`, `{"a":3}`, `{"b":1}`}, data)
+
+		checkpoint, err := checkpoints.Get(context.Background(), "test-stream", "shard-0")
+		require.NoError(t, err)
+		assert.Equal(t, "shard-0-1", checkpoint)
+	})
+
+	t.Run("it_should_resume_after_the_checkpoint", func(t *testing.T) {
+		k := &fakeKinesis{shards: []fakeShard{{id: "shard-0", records: []string{"old\n", "new\n"}}}}
+		checkpoints := NewMemoryCheckpointStore()
+		require.NoError(t, checkpoints.Set(context.Background(), "test-stream", "shard-0", "shard-0-0"))
+
+		data := collect(t, newTestConsumer(k, checkpoints, nopHandler), 1)
+
+		assert.Equal(t, []string{"new"}, data)
+	})
+
+	t.Run("it_should_read_child_shards_after_their_parent_ends", func(t *testing.T) {
+		k := &fakeKinesis{shards: []fakeShard{
+			{id: "child", parentId: "parent", records: []string{"child\n"}},
+			{id: "parent", records: []string{"parent-1\n", "parent-2\n"}, closed: true},
+		}}
+		checkpoints := NewMemoryCheckpointStore()
+		c := newTestConsumer(k, checkpoints, nopHandler)
+		c.initialPosition = types.ShardIteratorTypeLatest
+
+		data := collect(t, c, 1)
+
+		assert.Equal(t, []string{"child"}, data, "the parent read from the latest position has no records")
+
+		checkpoint, err := checkpoints.Get(context.Background(), "test-stream", "parent")
+		require.NoError(t, err)
+		assert.Equal(t, ShardEnd, checkpoint)
+	})
+
+	t.Run("it_should_keep_order_across_resharding", func(t *testing.T) {
+		k := &fakeKinesis{shards: []fakeShard{
+			{id: "child", parentId: "parent", records: []string{"3\n"}},
+			{id: "parent", records: []string{"1\n2\n"}, closed: true},
+		}}
+
+		data := collect(t, newTestConsumer(k, nil, nopHandler), 3)
+
+		assert.Equal(t, []string{"1", "2", "3"}, data)
+	})
+
+	t.Run("it_should_read_again_from_the_checkpoint_when_handler_fails", func(t *testing.T) {
+		k := &fakeKinesis{shards: []fakeShard{{id: "shard-0", records: []string{"1\n", "2\n"}}}}
+
+		failed := false
+		c := newTestConsumer(k, nil, func(_ context.Context, r Record) error {
+			if string(r.Data) == "2" && !failed {
+				failed = true
+				return errors.New("handler failed")
+			}
+
+			return nil
+		})
+
+		data := collect(t, c, 2)
+
+		assert.Equal(t, []string{"1", "2"}, data)
+		assert.Contains(t, k.iterations, "shard-0:1", "the shard should be read again after the processed record")
+		assert.ErrorContains(t, <-c.Error(), "handler failed")
+	})
+}
+
+func Test_splitRecordData(t *testing.T) {
+	t.Run("it_should_split_on_separator_and_skip_empty_records", func(t *testing.T) {
+		records := splitRecordData([]byte("a\n\nb\nc"))
+
+		assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, records)
+	})
+}
+
+func TestFileCheckpointStore(t *testing.T) {
+	t.Run("it_should_persist_checkpoints_across_stores", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+		s, err := NewFileCheckpointStore(path)
+		require.NoError(t, err)
+		require.NoError(t, s.Set(context.Background(), "stream", "shard-0", "42"))
+
+		s, err = NewFileCheckpointStore(path)
+		require.NoError(t, err)
+
+		checkpoint, err := s.Get(context.Background(), "stream", "shard-0")
+		require.NoError(t, err)
+		assert.Equal(t, "42", checkpoint)
+
+		checkpoint, err = s.Get(context.Background(), "stream", "shard-1")
+		require.NoError(t, err)
+		assert.Empty(t, checkpoint)
+	})
+}
+
+type fakeRedis struct {
+	values map[string]interface{}
+}
+
+func (r *fakeRedis) Get(key string) *redis.StringCmd {
+	value, ok := r.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+
+	return redis.NewStringResult(value.(string), nil)
+}
+
+func (r *fakeRedis) Set(key string, value interface{}, _ time.Duration) *redis.StatusCmd {
+	r.values[key] = value
+	return redis.NewStatusResult("OK", nil)
+}
+
+func TestRedisCheckpointStore(t *testing.T) {
+	t.Run("it_should_store_checkpoints_under_prefixed_keys", func(t *testing.T) {
+		client := &fakeRedis{values: make(map[string]interface{})}
+		s := NewRedisCheckpointStore(client, "app:")
+
+		checkpoint, err := s.Get(context.Background(), "stream", "shard-0")
+		require.NoError(t, err)
+		assert.Empty(t, checkpoint)
+
+		require.NoError(t, s.Set(context.Background(), "stream", "shard-0", "42"))
+		assert.Equal(t, "42", client.values["app:stream/shard-0"])
+
+		checkpoint, err = s.Get(context.Background(), "stream", "shard-0")
+		require.NoError(t, err)
+		assert.Equal(t, "42", checkpoint)
+	})
+}
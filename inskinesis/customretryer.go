@@ -1,24 +1,28 @@
 package inskinesis
 
 import (
-	"github.com/aws/aws-sdk-go/aws/request"
+	"errors"
 	"net"
 	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
 )
 
 // CustomRetryer retries on "connection reset by peer"
 type CustomRetryer struct {
-	request.Retryer
+	aws.Retryer
 }
 
-func (r CustomRetryer) ShouldRetry(req *request.Request) bool {
-	if err, ok := req.Error.(net.Error); ok && err.Timeout() {
+func (r CustomRetryer) IsErrorRetryable(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
 		return true
 	}
 
-	if opErr, ok := req.Error.(*net.OpError); ok && strings.Contains(opErr.Err.Error(), "connection reset by peer") {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Err != nil && strings.Contains(opErr.Err.Error(), "connection reset by peer") {
 		return true
 	}
 
-	return r.Retryer.ShouldRetry(req)
+	return r.Retryer.IsErrorRetryable(err)
 }
@@ -0,0 +1,181 @@
+package inskinesis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// Encoder encodes a record into the data of a Kinesis record.
+type Encoder interface {
+	Encode(record interface{}) ([]byte, error)
+}
+
+// EncoderFunc adapts a function to the Encoder interface.
+type EncoderFunc func(record interface{}) ([]byte, error)
+
+func (f EncoderFunc) Encode(record interface{}) ([]byte, error) {
+	return f(record)
+}
+
+type encodersCollection struct{}
+
+var Encoders = encodersCollection{}
+
+// JSON encoder marshals records to JSON. This is the default encoder.
+// Example: `Encoder: Encoders.JSON()`
+func (e encodersCollection) JSON() Encoder {
+	return EncoderFunc(json.Marshal)
+}
+
+// Protobuf encoder marshals records implementing proto.Message to the protobuf wire format.
+// Example: `Encoder: Encoders.Protobuf()`
+func (e encodersCollection) Protobuf() Encoder {
+	return EncoderFunc(func(record interface{}) ([]byte, error) {
+		message, ok := record.(proto.Message)
+		if !ok {
+			return nil, fmt.Errorf("record of type %T is not a protobuf message", record)
+		}
+
+		return proto.Marshal(message)
+	})
+}
+
+// Raw encoder sends records of type []byte, json.RawMessage or string as they are.
+// Example: `Encoder: Encoders.Raw()`
+func (e encodersCollection) Raw() Encoder {
+	return EncoderFunc(func(record interface{}) ([]byte, error) {
+		switch r := record.(type) {
+		case []byte:
+			return r, nil
+		case json.RawMessage:
+			return r, nil
+		case string:
+			return []byte(r), nil
+		default:
+			return nil, fmt.Errorf("record of type %T is not raw bytes", record)
+		}
+	})
+}
+
+// Avro returns an encoder writing records in the Avro binary encoding of the schema, without the schema itself.
+// Records of type map[string]interface{} are encoded as they are, other records are converted through their JSON form,
+// which must follow the Avro JSON encoding: values of unions other than null are wrapped as {"type": value}.
+// Example: `encoder, err := Encoders.Avro(schema)`
+func (e encodersCollection) Avro(schema string) (Encoder, error) {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Avro schema: %w", err)
+	}
+
+	return EncoderFunc(func(record interface{}) ([]byte, error) {
+		var native interface{} = record
+		if _, ok := record.(map[string]interface{}); !ok {
+			js, err := json.Marshal(record)
+			if err != nil {
+				return nil, err
+			}
+
+			native, _, err = codec.NativeFromTextual(js)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return codec.BinaryFromNative(nil, native)
+	}), nil
+}
+
+// Framing decides how encoded records are delimited within the data of a Kinesis record.
+type Framing string
+
+const (
+	FramingNewline        Framing = "newline"         // Records end with a newline, added if missing. This is the default.
+	FramingLengthPrefixed Framing = "length-prefixed" // Records start with their length as a 4 bytes big-endian integer.
+	FramingNone           Framing = "none"            // Records are sent as they are encoded.
+)
+
+// lengthPrefixSize is the size of the length prefix of FramingLengthPrefixed.
+const lengthPrefixSize = 4
+
+// ErrInvalidFraming is returned when the data of a Kinesis record does not match its framing.
+var ErrInvalidFraming = errors.New("invalid record framing")
+
+func (f Framing) validate() error {
+	switch f {
+	case FramingNewline, FramingLengthPrefixed, FramingNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown framing %q", f)
+	}
+}
+
+// frame delimits an encoded record.
+func (f Framing) frame(data []byte) []byte {
+	switch f {
+	case FramingLengthPrefixed:
+		framed := make([]byte, lengthPrefixSize, lengthPrefixSize+len(data))
+		binary.BigEndian.PutUint32(framed, uint32(len(data)))
+		return append(framed, data...)
+	case FramingNone:
+		return data
+	default:
+		// The capacity is capped so that adding the separator copies data instead of writing past the encoded record.
+		return addOutputSeparatorIfNeeded(data[:len(data):len(data)])
+	}
+}
+
+// split returns the records of the data of a Kinesis record, skipping empty records.
+//
+// Returns:
+// - records: The records, up to the first one that does not match the framing.
+// - err: ErrInvalidFraming if the data does not match the framing.
+func (f Framing) split(data []byte) ([][]byte, error) {
+	switch f {
+	case FramingLengthPrefixed:
+		var records [][]byte
+		for len(data) > 0 {
+			if len(data) < lengthPrefixSize {
+				return records, ErrInvalidFraming
+			}
+
+			size := binary.BigEndian.Uint32(data)
+			data = data[lengthPrefixSize:]
+			if uint64(size) > uint64(len(data)) {
+				return records, ErrInvalidFraming
+			}
+
+			if size > 0 {
+				records = append(records, data[:size])
+			}
+			data = data[size:]
+		}
+
+		return records, nil
+	case FramingNone:
+		if len(data) == 0 {
+			return nil, nil
+		}
+
+		return [][]byte{data}, nil
+	default:
+		return splitRecordData(data), nil
+	}
+}
+
+// splitRecordData splits the data of a Kinesis record on the output separator, skipping empty records.
+func splitRecordData(data []byte) [][]byte {
+	var records [][]byte
+	for _, record := range bytes.Split(data, []byte{outputSeparator}) {
+		if len(record) > 0 {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
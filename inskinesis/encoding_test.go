@@ -0,0 +1,242 @@
+package inskinesis
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testAvroSchema = `{
+	"type": "record",
+	"name": "Order",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "note", "type": ["null", "string"], "default": null}
+	]
+}`
+
+type avroOrder struct {
+	Id   int                    `json:"id"`
+	Note map[string]interface{} `json:"note"`
+}
+
+func TestEncoders(t *testing.T) {
+	t.Run("it_should_encode_json", func(t *testing.T) {
+		data, err := Encoders.JSON().Encode(order{Id: 1})
+		require.NoError(t, err)
+		assert.Equal(t, `{"id":1}`, string(data))
+	})
+
+	t.Run("it_should_encode_protobuf_messages", func(t *testing.T) {
+		data, err := Encoders.Protobuf().Encode(wrapperspb.String("hello"))
+		require.NoError(t, err)
+
+		var decoded wrapperspb.StringValue
+		require.NoError(t, proto.Unmarshal(data, &decoded))
+		assert.Equal(t, "hello", decoded.GetValue())
+
+		_, err = Encoders.Protobuf().Encode(order{Id: 1})
+		assert.EqualError(t, err, "record of type inskinesis.order is not a protobuf message")
+	})
+
+	t.Run("it_should_pass_raw_bytes_through", func(t *testing.T) {
+		for _, record := range []interface{}{[]byte("raw"), json.RawMessage("raw"), "raw"} {
+			data, err := Encoders.Raw().Encode(record)
+			require.NoError(t, err)
+			assert.Equal(t, "raw", string(data))
+		}
+
+		_, err := Encoders.Raw().Encode(42)
+		assert.EqualError(t, err, "record of type int is not raw bytes")
+	})
+
+	t.Run("it_should_encode_avro_maps_and_structs", func(t *testing.T) {
+		encoder, err := Encoders.Avro(testAvroSchema)
+		require.NoError(t, err)
+
+		codec, err := goavro.NewCodec(testAvroSchema)
+		require.NoError(t, err)
+
+		fromMap, err := encoder.Encode(map[string]interface{}{"id": 1, "note": goavro.Union("string", "first")})
+		require.NoError(t, err)
+
+		fromStruct, err := encoder.Encode(avroOrder{Id: 1, Note: map[string]interface{}{"string": "first"}})
+		require.NoError(t, err)
+		assert.Equal(t, fromMap, fromStruct)
+
+		native, rest, err := codec.NativeFromBinary(fromStruct)
+		require.NoError(t, err)
+		assert.Empty(t, rest)
+		assert.Equal(t, map[string]interface{}{"id": int64(1), "note": map[string]interface{}{"string": "first"}}, native)
+
+		_, err = encoder.Encode(map[string]interface{}{"note": nil})
+		assert.Error(t, err, "records missing fields should not be encoded")
+	})
+
+	t.Run("it_should_reject_invalid_avro_schemas", func(t *testing.T) {
+		_, err := Encoders.Avro(`{"type": "unknown"}`)
+		assert.ErrorContains(t, err, "error parsing Avro schema")
+	})
+}
+
+func TestFraming(t *testing.T) {
+	t.Run("it_should_add_a_missing_newline", func(t *testing.T) {
+		buffer := []byte("a\nbc")
+		framed := FramingNewline.frame(buffer[:1])
+
+		assert.Equal(t, "a\n", string(framed))
+		assert.Equal(t, "a\nbc", string(buffer), "the encoded buffer should not be overwritten")
+		assert.Equal(t, "b\n", string(FramingNewline.frame([]byte("b\n"))))
+	})
+
+	t.Run("it_should_round_trip_length_prefixed_records", func(t *testing.T) {
+		data := append(FramingLengthPrefixed.frame([]byte("a\nb")), FramingLengthPrefixed.frame([]byte("c"))...)
+		assert.Equal(t, []byte{0, 0, 0, 3, 'a', '\n', 'b', 0, 0, 0, 1, 'c'}, data)
+
+		records, err := FramingLengthPrefixed.split(data)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("a\nb"), []byte("c")}, records)
+	})
+
+	t.Run("it_should_return_records_before_invalid_framing", func(t *testing.T) {
+		data := append(FramingLengthPrefixed.frame([]byte("a")), 0, 0, 0, 9, 'b')
+
+		records, err := FramingLengthPrefixed.split(data)
+		assert.ErrorIs(t, err, ErrInvalidFraming)
+		assert.Equal(t, [][]byte{[]byte("a")}, records)
+	})
+
+	t.Run("it_should_not_delimit_records_without_framing", func(t *testing.T) {
+		assert.Equal(t, "a", string(FramingNone.frame([]byte("a"))))
+
+		records, err := FramingNone.split([]byte("a\nb"))
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("a\nb")}, records)
+	})
+
+	t.Run("it_should_reject_unknown_framings", func(t *testing.T) {
+		_, err := NewKinesis(Config{Region: "eu-west-1", StreamName: "test", Framing: "csv"})
+		assert.EqualError(t, err, `unknown framing "csv"`)
+
+		_, err = NewConsumer(ConsumerConfig{Region: "eu-west-1", StreamName: "test", Framing: "csv"}, nopHandler)
+		assert.EqualError(t, err, `unknown framing "csv"`)
+	})
+}
+
+func TestStream_encoder(t *testing.T) {
+	t.Run("it_should_encode_every_record_once", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.maxStreamBatchSize = 2
+
+		var encoded atomic.Int64
+		s.encoder = EncoderFunc(func(record interface{}) ([]byte, error) {
+			encoded.Add(1)
+			return json.Marshal(record)
+		})
+		s.start()
+
+		var sent [][]byte
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			Times(2).
+			DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+				for _, entry := range input.Records {
+					sent = append(sent, entry.Data)
+				}
+				return successPutOutput(), nil
+			})
+
+		for i := 0; i < 3; i++ {
+			s.Put(order{Id: i})
+		}
+		s.FlushAndStopStreaming()
+
+		assert.Equal(t, int64(3), encoded.Load())
+		assert.Len(t, sent, 3)
+	})
+
+	t.Run("it_should_send_length_prefixed_protobuf_records", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.encoder = Encoders.Protobuf()
+		s.framing = FramingLengthPrefixed
+
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+				require.Len(t, input.Records, 1)
+
+				records, err := FramingLengthPrefixed.split(input.Records[0].Data)
+				require.NoError(t, err)
+				require.Len(t, records, 1)
+
+				var decoded wrapperspb.Int64Value
+				require.NoError(t, proto.Unmarshal(records[0], &decoded))
+				assert.Equal(t, int64(42), decoded.GetValue())
+
+				return successPutOutput(), nil
+			})
+
+		failed, err := s.PutRecords(context.Background(), []interface{}{wrapperspb.Int64(42)})
+		require.NoError(t, err)
+		assert.Zero(t, failed)
+	})
+
+	t.Run("it_should_count_records_failing_to_encode", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		recorder := &failureRecorder{}
+		s := newTestStream(mockKinesis, 100, 1)
+		s.encoder = Encoders.Raw()
+		s.onFailure = recorder.handle
+		s.start()
+
+		mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(successPutOutput(), nil)
+
+		s.Put("valid")
+		s.Put(42)
+		s.FlushAndStopStreaming()
+
+		stats := s.Stats()
+		assert.Equal(t, int64(1), stats.Batched)
+		assert.Equal(t, int64(1), stats.Sent)
+		assert.Equal(t, int64(1), stats.Failed)
+		require.Len(t, recorder.failed, 1)
+		assert.Equal(t, ErrorCodeMarshalFailed, recorder.failed[0].ErrorCode)
+	})
+}
+
+func TestConsumer_framing(t *testing.T) {
+	t.Run("it_should_split_length_prefixed_records", func(t *testing.T) {
+		var handled []string
+		c := newConsumer(&fakeKinesis{}, ConsumerConfig{StreamName: "s", Framing: FramingLengthPrefixed}, func(_ context.Context, r Record) error {
+			handled = append(handled, string(r.Data))
+			return nil
+		})
+
+		data := append(FramingLengthPrefixed.frame([]byte("a\nb")), FramingLengthPrefixed.frame([]byte("c"))...)
+		sequenceNumber, err := c.processRecords(context.Background(), "shard-0", []types.Record{
+			{SequenceNumber: aws.String("1"), PartitionKey: aws.String("k"), Data: data},
+			{SequenceNumber: aws.String("2"), PartitionKey: aws.String("k"), Data: []byte{0, 0, 0, 9}},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, "2", sequenceNumber, "records with invalid framing should be skipped")
+		assert.Equal(t, []string{"a\nb", "c"}, handled)
+		assert.ErrorIs(t, <-c.Error(), ErrInvalidFraming)
+	})
+}
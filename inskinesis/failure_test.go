@@ -0,0 +1,167 @@
+package inskinesis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// failureRecorder collects the records passed to its handler.
+type failureRecorder struct {
+	mu     sync.Mutex
+	failed []FailedRecord
+}
+
+func (r *failureRecorder) handle(record FailedRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failed = append(r.failed, record)
+}
+
+func newFailureTestStream(t *testing.T) (*stream, *MockKinesisInterface, *failureRecorder) {
+	ctrl := gomock.NewController(t)
+	mockKinesis := NewMockKinesisInterface(ctrl)
+	recorder := &failureRecorder{}
+
+	s := newTestStream(mockKinesis, 100, 1)
+	s.onFailure = recorder.handle
+
+	return s, mockKinesis, recorder
+}
+
+type order struct {
+	Id int `json:"id"`
+}
+
+func TestStream_PutRecords_onFailure(t *testing.T) {
+	t.Run("it_should_pass_records_rejected_after_retries_with_their_last_error", func(t *testing.T) {
+		s, mockKinesis, recorder := newFailureTestStream(t)
+
+		gomock.InOrder(
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(&kinesis.PutRecordsOutput{
+				FailedRecordCount: aws.Int32(1),
+				Records: []types.PutRecordsResultEntry{
+					{},
+					{ErrorCode: aws.String("ProvisionedThroughputExceededException"), ErrorMessage: aws.String("Rate exceeded")},
+				},
+			}, nil),
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(&kinesis.PutRecordsOutput{
+				FailedRecordCount: aws.Int32(1),
+				Records: []types.PutRecordsResultEntry{
+					{ErrorCode: aws.String("InternalFailure"), ErrorMessage: aws.String("Internal service failure")},
+				},
+			}, nil),
+		)
+
+		failed, err := s.PutRecords(context.Background(), []interface{}{order{Id: 1}, order{Id: 2}})
+
+		assert.EqualError(t, err, "retry count exceeded")
+		assert.Equal(t, 1, failed)
+		assert.Equal(t, []FailedRecord{
+			{Record: order{Id: 2}, ErrorCode: "InternalFailure", ErrorMessage: "Internal service failure"},
+		}, recorder.failed)
+	})
+
+	t.Run("it_should_pass_every_record_when_the_request_fails", func(t *testing.T) {
+		s, mockKinesis, recorder := newFailureTestStream(t)
+
+		gomock.InOrder(
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).
+				Return(nil, &smithy.GenericAPIError{Code: "ResourceNotFoundException", Message: "Stream not found"}),
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).
+				Return(nil, errors.New("connection refused")),
+		)
+
+		failed, err := s.PutRecords(context.Background(), []interface{}{order{Id: 1}, order{Id: 2}})
+		assert.Error(t, err)
+		assert.Equal(t, 2, failed)
+
+		_, err = s.PutRecords(context.Background(), []interface{}{order{Id: 3}})
+		assert.EqualError(t, err, "connection refused")
+
+		assert.Equal(t, []FailedRecord{
+			{Record: order{Id: 1}, ErrorCode: "ResourceNotFoundException", ErrorMessage: "Stream not found"},
+			{Record: order{Id: 2}, ErrorCode: "ResourceNotFoundException", ErrorMessage: "Stream not found"},
+			{Record: order{Id: 3}, ErrorCode: ErrorCodeRequestFailed, ErrorMessage: "connection refused"},
+		}, recorder.failed)
+	})
+
+	t.Run("it_should_send_marshallable_records_and_pass_the_others", func(t *testing.T) {
+		s, mockKinesis, recorder := newFailureTestStream(t)
+		invalid := make(chan int)
+
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+				require.Len(t, input.Records, 1)
+				assert.Equal(t, "{\"id\":1}\n", string(input.Records[0].Data))
+				return successPutOutput(), nil
+			})
+
+		failed, err := s.PutRecords(context.Background(), []interface{}{invalid, order{Id: 1}})
+
+		assert.Error(t, err, "the marshalling error should be returned")
+		assert.Equal(t, 1, failed)
+		require.Len(t, recorder.failed, 1)
+		assert.Equal(t, invalid, recorder.failed[0].Record)
+		assert.Equal(t, ErrorCodeMarshalFailed, recorder.failed[0].ErrorCode)
+		assert.Contains(t, recorder.failed[0].ErrorMessage, "unsupported type")
+	})
+
+	t.Run("it_should_pass_every_record_of_a_failed_aggregated_record", func(t *testing.T) {
+		s, mockKinesis, recorder := newFailureTestStream(t)
+		s.aggregate = true
+		s.retryCount = 0
+
+		mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(&kinesis.PutRecordsOutput{
+			FailedRecordCount: aws.Int32(1),
+			Records:           []types.PutRecordsResultEntry{{ErrorCode: aws.String("InternalFailure")}},
+		}, nil)
+
+		failed, err := s.PutRecords(context.Background(), []interface{}{order{Id: 1}, order{Id: 2}, order{Id: 3}})
+
+		assert.EqualError(t, err, "retry count exceeded")
+		assert.Equal(t, 3, failed)
+		require.Len(t, recorder.failed, 3)
+		assert.Equal(t, order{Id: 3}, recorder.failed[2].Record)
+		assert.Equal(t, "InternalFailure", recorder.failed[2].ErrorCode)
+	})
+
+	t.Run("it_should_pass_spilled_records_as_their_data", func(t *testing.T) {
+		s, _, recorder := newFailureTestStream(t)
+
+		s.fail(spilledRecord{entry: spillEntry{Data: []byte("{\"id\":1}\n")}}, "InternalFailure", "")
+
+		require.Len(t, recorder.failed, 1)
+		assert.Equal(t, []byte("{\"id\":1}\n"), recorder.failed[0].Record)
+	})
+}
+
+func TestStream_onFailure(t *testing.T) {
+	t.Run("it_should_pass_records_failed_while_streaming", func(t *testing.T) {
+		s, mockKinesis, recorder := newFailureTestStream(t)
+		s.start()
+
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("kinesis unavailable"))
+
+		s.Put(order{Id: 1})
+		s.FlushAndStopStreaming()
+
+		assert.Equal(t, []FailedRecord{
+			{Record: order{Id: 1}, ErrorCode: ErrorCodeRequestFailed, ErrorMessage: "kinesis unavailable"},
+		}, recorder.failed)
+		assert.Equal(t, int64(1), s.Stats().Failed)
+	})
+}
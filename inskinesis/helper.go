@@ -1,8 +1,6 @@
 package inskinesis
 
 import (
-	"encoding/json"
-	"errors"
 	"reflect"
 )
 
@@ -28,29 +26,21 @@ func takeArg(arg interface{}, kind reflect.Kind) (val reflect.Value, ok bool) {
 	return
 }
 
-func createBatches(v interface{}, recordLimit int, byteLimit int) ([][]interface{}, error) {
-	records, ok := TakeSliceArg(v)
-	if !ok {
-		return nil, errors.New("invalid input")
-	}
-
-	var batches = make([][]interface{}, 0)
-	buffer := make([]interface{}, 0)
+// createBatches splits encoded records into batches of at most recordLimit records and byteLimit bytes of data.
+// A record larger than byteLimit is sent in a batch of its own.
+func createBatches(records []encodedRecord, recordLimit int, byteLimit int) [][]encodedRecord {
+	var batches = make([][]encodedRecord, 0)
+	buffer := make([]encodedRecord, 0)
 	bufferSize := 0
 
 	for _, record := range records {
-		js, jsErr := json.Marshal(record)
-		if jsErr != nil {
-			return nil, jsErr
-		}
-
-		recordSize := len(js)
+		recordSize := len(record.entry.Data)
 		sizeExceeds := bufferSize+recordSize > byteLimit
 		bufferFull := len(buffer) == recordLimit
 
 		if len(buffer) > 0 && (bufferFull || sizeExceeds) {
 			batches = append(batches, buffer)
-			buffer = make([]interface{}, 0)
+			buffer = make([]encodedRecord, 0)
 			bufferSize = 0
 		}
 
@@ -62,5 +52,5 @@ func createBatches(v interface{}, recordLimit int, byteLimit int) ([][]interface
 		batches = append(batches, buffer)
 	}
 
-	return batches, nil
+	return batches
 }
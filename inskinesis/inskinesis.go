@@ -1,38 +1,69 @@
 package inskinesis
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/aws/aws-sdk-go/aws/client"
 	"math"
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/aws/smithy-go"
 )
 
 const outputSeparator = byte('\n')
 const errorChannelSize = 100
+const logChannelSize = 2000
+const batchChannelSize = 100
+
+// defaultMaxAttempts is the number of attempts made by the AWS SDK for every request.
+const defaultMaxAttempts = 4
+
+// Error codes of the records that were not sent because of inskinesis rather than Kinesis.
+const (
+	ErrorCodeMarshalFailed = "MarshalFailed" // The record could not be encoded.
+	ErrorCodeRequestFailed = "RequestFailed" // The PutRecords request failed without an AWS error code.
+)
+
+// FailedRecord is a record that was not sent to the stream.
+type FailedRecord struct {
+	Record       interface{} // The record as put, or its data as sent to Kinesis if it was spilled to disk.
+	ErrorCode    string      // The error code returned by Kinesis for the record on its last attempt, or of the request.
+	ErrorMessage string      // The error message matching the error code.
+}
+
+// FailureHandler receives every record that was not sent, once its retries are exhausted.
+// Records spilled to disk by OverflowSpill are encoded before they are written and cannot be decoded back, so they
+// are received as their data as sent to Kinesis, a []byte framed as configured, rather than as the record put.
+// It may be called concurrently when MaxGroup is greater than 1.
+type FailureHandler func(record FailedRecord)
 
 type KinesisInterface interface {
-	PutRecords(input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error)
+	PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error)
 }
 
 type kinesisProxy struct {
-	*kinesis.Kinesis
+	*kinesis.Client
 }
 
-func (k *kinesisProxy) PutRecords(input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error) {
-	return k.Kinesis.PutRecords(input)
+func (k *kinesisProxy) PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	return k.Client.PutRecords(ctx, params, optFns...)
 }
 
 // StreamInterface defines the interface for a Kinesis stream.
 type StreamInterface interface {
 	Put(record interface{})
+	TryPut(record interface{}) error
+	PutContext(ctx context.Context, record interface{}) error
+	Dropped() int64
+	Stats() Stats
 	Error() <-chan error
+	Flush()
 	FlushAndStopStreaming()
 }
 
@@ -41,6 +72,8 @@ type stream struct {
 	region        string               // AWS region where the Kinesis stream is located.
 	name          string               // Name of the Kinesis stream.
 	partitioner   *PartitionerFunction // The partitioning function used to determine the partition key for records.
+	encoder       Encoder              // Encoder of the records into the data of Kinesis records.
+	framing       Framing              // How encoded records are delimited within the data of Kinesis records.
 	kinesisClient KinesisInterface     // AWS Kinesis client for interacting with the stream.
 
 	logBufferSize          int // Maximum size of the log buffer for records.
@@ -48,21 +81,35 @@ type stream struct {
 	maxStreamBatchByteSize int // Maximum size (in bytes) of each batch of records.
 	maxGroup               int // Maximum number of concurrent groups for sending records.
 
-	retryCount    int           // Maximum number of retries for failed record submissions.
-	retryWaitTime time.Duration // Time to wait between retries for failed record submissions.
+	lingerInterval time.Duration // Maximum time a record waits in the log buffer before it is flushed, 0 to disable.
+
+	retryCount       int           // Maximum number of retries for failed record submissions.
+	retryWaitTime    time.Duration // Time to wait between retries for failed record submissions.
+	maxRetryWaitTime time.Duration // Maximum time to wait between retries of throttled records.
+
+	shards  *shardMap     // Open shards of the stream, nil unless aggregation or shard rate limiting is enabled.
+	limiter *shardLimiter // Per-shard rate limiter, nil unless shard rate limiting is enabled.
 
 	mu               sync.Mutex         // Mutex to synchronize access to the stream.
 	wgLogChan        *sync.WaitGroup    // WaitGroup to manage goroutines.
 	wgBatchChan      *sync.WaitGroup    // WaitGroup to manage goroutines.
 	logChannel       chan interface{}   // Channel for receiving individual log records.
-	batchChannel     chan []interface{} // Channel for sending batches of log records.
+	batchChannel     chan queuedBatch   // Channel for sending batches of encoded log records.
 	stopChannel      chan bool          // Channel to signal the termination of the streaming process.
+	flushChannel     chan chan struct{} // Channel to request a flush of the log buffer, closing the channel sent once done.
+	stoppedChannel   chan struct{}      // Channel closed once the stream has stopped and sent every record.
 	errChannel       chan error         // Channel for receiving errors.
 	stopBatchChannel chan bool          // Channel to signal the termination of batch streaming.
 	logBuffer        []interface{}      // Buffer for accumulating log records before batching.
 
-	failedCount int // Counter for the number of failed record submissions.
-	totalCount  int // Counter for the total number of records sent to the stream.
+	overflowPolicy OverflowPolicy // What Put does with a record when the log channel is full.
+	spill          *spillFile     // File of the records spilled by Put, nil unless the overflow policy is OverflowSpill.
+
+	stats streamStats // Counters of the records going through the stream.
+
+	aggregate bool // Whether records are packed into KPL aggregated records.
+
+	onFailure FailureHandler // Handler of the records that were not sent, nil to only count them.
 
 	verbose bool // Verbose mode
 }
@@ -71,12 +118,25 @@ type Config struct {
 	Region                 string
 	StreamName             string
 	Partitioner            *PartitionerFunction
+	Encoder                Encoder // Encoder of the records, Encoders.JSON() by default.
+	Framing                Framing // How encoded records are delimited within Kinesis records, FramingNewline by default.
 	MaxStreamBatchSize     int
 	MaxStreamBatchByteSize int
 	MaxBatchSize           int
 	MaxGroup               int
+	LingerInterval         time.Duration // Maximum time a record waits in the buffer before it is sent, 0 to wait for a full buffer.
 	RetryCount             int
 	RetryWaitTime          time.Duration
+	MaxRetryWaitTime       time.Duration  // Maximum wait between retries of throttled records, DefaultMaxRetryWaitTime by default.
+	ShardRateLimit         bool           // Whether records are delayed to keep every shard within 1 MB and 1000 records per second.
+	EndpointUrl            string         // Endpoint URL for AWS operations, to use a local stand-in of Kinesis.
+	Aggregate              bool           // Whether records are packed into KPL aggregated records, up to 1 MB each.
+	LogChannelSize         int            // Capacity of the channel of records put, 2000 by default.
+	BatchChannelSize       int            // Capacity of the channel of batches waiting to be sent, 100 by default.
+	ErrorChannelSize       int            // Capacity of the error channel, 100 by default.
+	OverflowPolicy         OverflowPolicy // What Put does when the log channel is full, OverflowBlock by default.
+	SpillDirectory         string         // Directory of the spill file, required with OverflowSpill.
+	OnFailure              FailureHandler // Handler of the records that were not sent, to persist or re-route them.
 	Verbose                bool
 }
 
@@ -89,41 +149,86 @@ func NewKinesis(config Config) (StreamInterface, error) {
 	if config.StreamName == "" {
 		return nil, errors.New("stream name is required")
 	}
-	awsConfig := aws.Config{Region: aws.String(config.Region)}
-	awsSession, err := session.NewSession(&awsConfig)
-	if err != nil {
+
+	if config.Framing == "" {
+		config.Framing = FramingNewline
+	}
+
+	if err := config.Framing.validate(); err != nil {
 		return nil, err
 	}
 
-	awsSession.Config.Retryer = CustomRetryer{
-		Retryer: client.DefaultRetryer{
-			NumMaxRetries: 3,
-		},
+	if config.OverflowPolicy == "" {
+		config.OverflowPolicy = OverflowBlock
+	}
+
+	if err := config.OverflowPolicy.validate(); err != nil {
+		return nil, err
+	}
+
+	var spill *spillFile
+	if config.OverflowPolicy == OverflowSpill {
+		if config.SpillDirectory == "" {
+			return nil, errors.New("spill directory is required")
+		}
+
+		var err error
+		if spill, err = newSpillFile(config.SpillDirectory); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.LogChannelSize == 0 {
+		config.LogChannelSize = logChannelSize
 	}
 
-	kinesisClient := kinesis.New(awsSession)
+	if config.BatchChannelSize == 0 {
+		config.BatchChannelSize = batchChannelSize
+	}
+
+	if config.ErrorChannelSize == 0 {
+		config.ErrorChannelSize = errorChannelSize
+	}
+
+	kinesisClient, err := newKinesisClient(config.Region, config.EndpointUrl)
+	if err != nil {
+		return nil, err
+	}
 
 	s := &stream{
 		region:        config.Region,
 		name:          config.StreamName,
 		partitioner:   config.Partitioner,
-		kinesisClient: kinesisClient,
+		encoder:       config.Encoder,
+		framing:       config.Framing,
+		kinesisClient: &kinesisProxy{kinesisClient},
 
 		logBufferSize:          config.MaxBatchSize,
 		maxStreamBatchSize:     config.MaxStreamBatchSize,
 		maxStreamBatchByteSize: config.MaxStreamBatchByteSize,
 		maxGroup:               config.MaxGroup,
 
+		lingerInterval: config.LingerInterval,
+
 		wgLogChan:        &sync.WaitGroup{},
 		wgBatchChan:      &sync.WaitGroup{},
-		logChannel:       make(chan interface{}, 2000),
-		batchChannel:     make(chan []interface{}, 100),
-		errChannel:       make(chan error, errorChannelSize),
+		logChannel:       make(chan interface{}, config.LogChannelSize),
+		batchChannel:     make(chan queuedBatch, config.BatchChannelSize),
+		errChannel:       make(chan error, config.ErrorChannelSize),
 		stopChannel:      make(chan bool, 10),
+		flushChannel:     make(chan chan struct{}, 10),
+		stoppedChannel:   make(chan struct{}),
 		stopBatchChannel: make(chan bool, 10),
 
-		retryCount:    config.RetryCount,
-		retryWaitTime: config.RetryWaitTime,
+		retryCount:       config.RetryCount,
+		retryWaitTime:    config.RetryWaitTime,
+		maxRetryWaitTime: config.MaxRetryWaitTime,
+
+		aggregate: config.Aggregate,
+		onFailure: config.OnFailure,
+
+		overflowPolicy: config.OverflowPolicy,
+		spill:          spill,
 
 		verbose: config.Verbose,
 	}
@@ -148,54 +253,173 @@ func NewKinesis(config Config) (StreamInterface, error) {
 		s.partitioner = PartitionerPointer(Partitioners.UUID)
 	}
 
+	if s.encoder == nil {
+		s.encoder = Encoders.JSON()
+	}
+
 	if s.retryWaitTime == 0 {
 		s.retryWaitTime = 100 * time.Millisecond
 	}
 
+	if s.maxRetryWaitTime == 0 {
+		s.maxRetryWaitTime = DefaultMaxRetryWaitTime
+	}
+
+	if config.Aggregate || config.ShardRateLimit {
+		s.shards = newShardMap(kinesisClient, s.name)
+	}
+
+	if config.ShardRateLimit {
+		s.limiter = newShardLimiter(s.shards)
+	}
+
 	s.start()
 
 	return s, nil
 }
 
+// newKinesisClient creates a Kinesis client for the region, retrying with CustomRetryer.
+// The endpoint URL replaces the default Kinesis endpoint if it is set.
+func newKinesisClient(region string, endpointUrl string) (*kinesis.Client, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithRegion(region),
+		awsconfig.WithRetryer(func() aws.Retryer {
+			return CustomRetryer{
+				Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+					o.MaxAttempts = defaultMaxAttempts
+				}),
+			}
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	if endpointUrl != "" {
+		cfg.BaseEndpoint = aws.String(endpointUrl)
+	}
+
+	return kinesis.NewFromConfig(cfg), nil
+}
+
 // Error returns the channel for receiving errors.
 func (s *stream) Error() <-chan error {
 	return s.errChannel
 }
 
 func (s *stream) startStreaming() {
+	// The linger timer runs while the log buffer holds records, linger is nil otherwise.
+	var lingerTimer *time.Timer
+	var linger <-chan time.Time
+
+	// Batches queued since the last Flush are tracked by queued, and sent is closed once the batches queued before
+	// the last Flush are sent, so that a Flush waits for every record put before it without reusing a WaitGroup.
+	queued := &sync.WaitGroup{}
+	sent := make(chan struct{})
+	close(sent)
+
+	flush := func() {
+		if lingerTimer != nil {
+			lingerTimer.Stop()
+			lingerTimer, linger = nil, nil
+		}
+
+		s.flushLogBuffer(queued)
+	}
+
+	add := func(record interface{}) {
+		s.stats.put.Add(1)
+		s.logBuffer = append(s.logBuffer, record)
+		if len(s.logBuffer) > s.logBufferSize {
+			flush()
+		} else if lingerTimer == nil && s.lingerInterval > 0 {
+			lingerTimer = time.NewTimer(s.lingerInterval)
+			linger = lingerTimer.C
+		}
+
+		s.wgLogChan.Done()
+	}
+
 	for {
 		select {
 		case record := <-s.logChannel:
-			s.totalCount++
-			s.logBuffer = append(s.logBuffer, record)
-			if len(s.logBuffer) > s.logBufferSize {
-				batch := s.logBuffer
-				s.logBuffer = make([]interface{}, 0)
+			add(record)
+		case <-linger:
+			lingerTimer, linger = nil, nil
+			s.printf("Linger interval elapsed for Kinesis stream %s, flushing %d records\n", s.name, len(s.logBuffer))
+			s.flushLogBuffer(queued)
+		case done := <-s.flushChannel:
+			// Records put before the flush was requested may still be waiting in the log channel.
+			for n := len(s.logChannel); n > 0; n-- {
+				add(<-s.logChannel)
+			}
 
-				batches, err := createBatches(batch, s.maxStreamBatchSize, s.maxStreamBatchByteSize)
-				if err != nil {
-					if len(s.errChannel) < errorChannelSize {
-						s.errChannel <- err
-					}
-					s.wgLogChan.Done()
-					continue
-				}
+			flush()
 
-				for _, b := range batches {
-					s.wgBatchChan.Add(1)
-					s.batchChannel <- b
-				}
-			}
+			flushed, previous := queued, sent
+			sent = make(chan struct{})
+			go func(sent chan struct{}) {
+				flushed.Wait()
+				<-previous
+				close(sent)
+				close(done)
+			}(sent)
 
-			s.wgLogChan.Done()
+			queued = &sync.WaitGroup{}
 		case <-s.stopChannel:
+			if lingerTimer != nil {
+				lingerTimer.Stop()
+			}
+
+			s.logBuffer = append(s.logBuffer, s.drainSpill()...)
+
 			s.stopAndWaitBatchStreaming()
+			close(s.stoppedChannel)
 			s.wgLogChan.Done()
 			return
 		}
 	}
 }
 
+// queuedBatch is a batch waiting to be sent, with the WaitGroup of the flush waiting for it, if any.
+type queuedBatch struct {
+	records []encodedRecord
+	flushed *sync.WaitGroup
+}
+
+// flushLogBuffer splits the log buffer and the spilled records into batches and queues them for sending.
+// If flushed is not nil, it is done once every queued batch has been sent.
+func (s *stream) flushLogBuffer(flushed *sync.WaitGroup) {
+	s.logBuffer = append(s.logBuffer, s.drainSpill()...)
+	if len(s.logBuffer) == 0 {
+		return
+	}
+
+	batch := s.logBuffer
+	s.logBuffer = make([]interface{}, 0)
+
+	for _, b := range s.createBatches(batch) {
+		s.wgBatchChan.Add(1)
+		if flushed != nil {
+			flushed.Add(1)
+		}
+
+		s.batchChannel <- queuedBatch{records: b, flushed: flushed}
+	}
+}
+
+// createBatches encodes records, aggregates them if enabled, and splits them into batches within the stream batch limits.
+// Records that cannot be encoded are counted as failed and passed to the failure handler.
+func (s *stream) createBatches(records []interface{}) [][]encodedRecord {
+	encoded, err := s.encodeRecords(records)
+	if err != nil {
+		s.stats.failed.Add(int64(len(records) - len(encoded)))
+		s.sendError(err)
+	}
+
+	s.stats.batched.Add(int64(len(encoded)))
+	return createBatches(s.aggregateRecords(context.Background(), encoded), s.maxStreamBatchSize, s.maxStreamBatchByteSize)
+}
+
 func (s *stream) stopAndWaitBatchStreaming() {
 	s.wgBatchChan.Wait()
 	s.wgBatchChan.Add(1)
@@ -203,6 +427,23 @@ func (s *stream) stopAndWaitBatchStreaming() {
 	s.wgBatchChan.Wait()
 }
 
+// Flush sends the records put so far, partial batches included, and waits until they are sent, without waiting for the
+// records put after it. The stream keeps streaming, unlike FlushAndStopStreaming. Once the stream is stopped, every
+// record has been sent and Flush returns immediately.
+func (s *stream) Flush() {
+	done := make(chan struct{})
+	select {
+	case s.flushChannel <- done:
+	case <-s.stoppedChannel:
+		return
+	}
+
+	select {
+	case <-done:
+	case <-s.stoppedChannel:
+	}
+}
+
 func (s *stream) stopAndWaitLogStreaming() {
 	s.wgLogChan.Wait()
 	s.wgLogChan.Add(1)
@@ -227,12 +468,9 @@ func (s *stream) startBatchStreaming() {
 				lastBatch := s.logBuffer
 				s.logBuffer = make([]interface{}, 0)
 
-				batches, _ := createBatches(lastBatch, s.maxStreamBatchSize, s.maxStreamBatchByteSize)
-
-				for _, b := range batches {
+				for _, b := range s.createBatches(lastBatch) {
 					s.wgBatchChan.Add(1)
-					batch := b
-					s.sendSingleBatch(batch, concurrentLimiter)
+					s.sendSingleBatch(queuedBatch{records: b}, concurrentLimiter)
 				}
 			}()
 
@@ -241,26 +479,31 @@ func (s *stream) startBatchStreaming() {
 	}
 }
 
-func (s *stream) sendSingleBatch(batch []interface{}, concurrentLimiter chan struct{}) {
+func (s *stream) sendSingleBatch(batch queuedBatch, concurrentLimiter chan struct{}) {
 	concurrentLimiter <- struct{}{}
 	go func() {
 		defer func() {
 			s.wgBatchChan.Done()
+			if batch.flushed != nil {
+				batch.flushed.Done()
+			}
 			<-concurrentLimiter
 		}()
 
-		failedCount, err := s.PutRecords(batch)
-		s.failedCount += failedCount
+		count := countRecords(batch.records)
+		failedCount, err := s.putEncoded(context.Background(), batch.records)
+		s.stats.failed.Add(int64(failedCount))
+		if sent := count - failedCount; sent > 0 {
+			s.stats.sent.Add(int64(sent))
+		}
+
 		if err != nil {
 			s.printf("Error sending records to Kinesis stream %s: %v\n", s.name, err)
-			if len(s.errChannel) < errorChannelSize {
-				s.errChannel <- err
-			}
-
+			s.sendError(err)
 			return
 		}
 
-		s.printf("Sent %d records to Kinesis stream %s\n", len(batch), s.name)
+		s.printf("Sent %d records to Kinesis stream %s\n", count, s.name)
 	}()
 }
 
@@ -272,108 +515,387 @@ func (s *stream) start() {
 func (s *stream) FlushAndStopStreaming() {
 	s.stopAndWaitLogStreaming()
 
-	s.printf("%d/%d records sent to Kinesis stream %s\n", s.totalCount-s.failedCount, s.totalCount, s.name)
+	if s.spill != nil {
+		if err := s.spill.close(); err != nil {
+			s.sendError(err)
+		}
+	}
+
+	stats := s.Stats()
+	s.printf("%d/%d records sent to Kinesis stream %s\n", stats.Sent, stats.Put, s.name)
+	if stats.Dropped > 0 || stats.ErrorsDropped > 0 {
+		s.printf("%d records and %d errors dropped by Kinesis stream %s\n", stats.Dropped, stats.ErrorsDropped, s.name)
+	}
 }
 
-// PutRecords sends records to the Kinesis stream.
-func (s *stream) PutRecords(batch []interface{}) (int, error) {
-	transformed, err := s.transformRecords(batch)
+// Dropped returns the number of records dropped by Put, following the overflow policy or failing to be spilled.
+func (s *stream) Dropped() int64 {
+	return s.stats.dropped.Load()
+}
+
+// drainSpill returns the records spilled by Put, counting them as records put.
+func (s *stream) drainSpill() []interface{} {
+	if s.spill == nil {
+		return nil
+	}
+
+	records, err := s.spill.drain()
 	if err != nil {
-		return len(batch), err
+		s.sendError(fmt.Errorf("failed to read spilled records of Kinesis stream %s: %w", s.name, err))
+	}
+
+	s.stats.put.Add(int64(len(records)))
+	return records
+}
+
+// sendError sends an error to the error channel, dropping it if the channel is full.
+func (s *stream) sendError(err error) {
+	select {
+	case s.errChannel <- err:
+	default:
+		s.stats.errorsDropped.Add(1)
+		s.printf("Error channel of Kinesis stream %s is full, dropped error: %v\n", s.name, err)
+	}
+}
+
+// PutRecords sends records to the Kinesis stream.
+// Records that cannot be encoded are not sent, the others are. Every record that is not sent is passed to the
+// failure handler.
+//
+// Returns:
+// - failed: The number of records that were not sent.
+// - err: The error of the PutRecords request, "retry count exceeded", or the encoding error.
+func (s *stream) PutRecords(ctx context.Context, batch []interface{}) (int, error) {
+	encoded, encodeErr := s.encodeRecords(batch)
+	failedCount := len(batch) - len(encoded)
+	if len(encoded) == 0 {
+		return failedCount, encodeErr
+	}
+
+	failed, err := s.putEncoded(ctx, s.aggregateRecords(ctx, encoded))
+	if err == nil {
+		err = encodeErr
+	}
+
+	return failedCount + failed, err
+}
+
+// encodedRecord is a Kinesis entry with the records it holds, so that records are encoded once for batching and sending.
+type encodedRecord struct {
+	records []interface{} // Records of the entry, a single one unless they were aggregated.
+	entry   types.PutRecordsRequestEntry
+}
+
+// countRecords returns the number of records held by encoded entries.
+func countRecords(records []encodedRecord) int {
+	count := 0
+	for _, r := range records {
+		count += len(r.records)
+	}
+
+	return count
+}
+
+// encodeRecords encodes records into Kinesis entries, passing the records that cannot be encoded to the failure handler.
+//
+// Returns:
+// - encoded: The records that were encoded, in order.
+// - err: The last encoding error, nil if every record was encoded.
+func (s *stream) encodeRecords(records []interface{}) ([]encodedRecord, error) {
+	encoded := make([]encodedRecord, 0, len(records))
+	var encodeErr error
+	for _, record := range records {
+		entry, err := s.transformRecord(record)
+		if err != nil {
+			encodeErr = err
+			s.fail(record, ErrorCodeMarshalFailed, err.Error())
+			continue
+		}
+
+		encoded = append(encoded, encodedRecord{records: []interface{}{record}, entry: entry})
+	}
+
+	return encoded, encodeErr
+}
+
+// aggregateRecords packs encoded records into KPL aggregated records, grouped by predicted shard, if aggregation is
+// enabled. Records are grouped by explicit hash key or partition key when the shards cannot be listed.
+func (s *stream) aggregateRecords(ctx context.Context, records []encodedRecord) []encodedRecord {
+	if !s.aggregate {
+		return records
 	}
 
-	failedCount, err := s.putRecords(transformed, s.retryCount)
+	var shards []shardRange
+	if s.shards != nil {
+		var err error
+		if shards, err = s.shards.get(ctx); err != nil {
+			s.sendError(err)
+		}
+	}
+
+	return aggregateRecords(records, shards)
+}
+
+// putEncoded sends encoded entries to the Kinesis stream, passing the records of the entries that were not sent to the
+// failure handler.
+//
+// Returns:
+// - failed: The number of records that were not sent.
+// - err: The error of the PutRecords request, or "retry count exceeded".
+func (s *stream) putEncoded(ctx context.Context, records []encodedRecord) (int, error) {
+	entries := make([]types.PutRecordsRequestEntry, len(records))
+	counts := make([]int, len(records))
+	for i, r := range records {
+		entries[i] = r.entry
+		counts[i] = len(r.records)
+	}
+
+	failedCount := 0
+	failures, err := s.putEntries(ctx, entries, counts, s.retryCount)
+	for _, f := range failures {
+		for _, record := range records[f.index].records {
+			failedCount++
+			s.fail(record, f.errorCode, f.errorMessage)
+		}
+	}
 
 	return failedCount, err
 }
 
+// fail passes a record that was not sent to the failure handler, if any.
+func (s *stream) fail(record interface{}, errorCode, errorMessage string) {
+	if s.onFailure == nil {
+		return
+	}
+
+	if spilled, ok := record.(spilledRecord); ok {
+		record = spilled.entry.Data
+	}
+
+	s.onFailure(FailedRecord{Record: record, ErrorCode: errorCode, ErrorMessage: errorMessage})
+}
+
 // Put sends a single record to the Kinesis stream.
+// If the log channel is full, the record is handled following the overflow policy.
 func (s *stream) Put(record interface{}) {
 	s.wgLogChan.Add(1)
-	s.logChannel <- record
+	select {
+	case s.logChannel <- record:
+		return
+	default:
+		s.wgLogChan.Done()
+	}
+
+	s.overflow(record)
 }
 
-func (s *stream) putRecords(batch []*kinesis.PutRecordsRequestEntry, retryCount int) (int, error) {
-	s.printf("Sending %d records to Kinesis stream %s\n", len(batch), s.name)
-	if retryCount < 0 {
-		s.printf("Retry count exceeded for Kinesis stream %s\n", s.name)
-		return len(batch), errors.New("retry count exceeded")
+// TryPut sends a single record to the Kinesis stream without blocking.
+// It returns ErrBufferFull if the log channel is full, whatever the overflow policy.
+func (s *stream) TryPut(record interface{}) error {
+	s.wgLogChan.Add(1)
+	select {
+	case s.logChannel <- record:
+		return nil
+	default:
+		s.wgLogChan.Done()
+		return ErrBufferFull
 	}
+}
 
-	res, err := s.kinesisClient.PutRecords(&kinesis.PutRecordsInput{
-		Records:    batch,
-		StreamName: aws.String(s.name),
-	})
+// PutContext sends a single record to the Kinesis stream, waiting for room in the log channel until ctx is done.
+// It returns the error of ctx if the record could not be put in time, whatever the overflow policy.
+func (s *stream) PutContext(ctx context.Context, record interface{}) error {
+	s.wgLogChan.Add(1)
+	select {
+	case s.logChannel <- record:
+		return nil
+	case <-ctx.Done():
+		s.wgLogChan.Done()
+		return ctx.Err()
+	}
+}
 
-	if err != nil {
-		s.printf("Error sending records to Kinesis stream %s: %v\n", s.name, err)
-		return len(batch), err
+// putRecords sends entries to the Kinesis stream, retrying the entries Kinesis rejects.
+//
+// Returns:
+// - failed: The number of entries that were not sent.
+// - err: The error of the PutRecords request, or "retry count exceeded".
+func (s *stream) putRecords(ctx context.Context, batch []types.PutRecordsRequestEntry, retryCount int) (int, error) {
+	failures, err := s.putEntries(ctx, batch, nil, retryCount)
+
+	return len(failures), err
+}
+
+// entryFailure is an entry that was not sent, with the error of its last attempt.
+type entryFailure struct {
+	index        int // Index of the entry in the batch.
+	errorCode    string
+	errorMessage string
+}
+
+// putEntries sends entries to the Kinesis stream, retrying the entries Kinesis rejects up to retryCount times.
+// counts holds the number of records of every entry, to count the retried records, or nil if every entry holds one.
+//
+// Returns:
+// - failures: The entries that were not sent.
+// - err: The error of the PutRecords request, or "retry count exceeded".
+func (s *stream) putEntries(ctx context.Context, batch []types.PutRecordsRequestEntry, counts []int, retryCount int) ([]entryFailure, error) {
+	pending := make([]entryFailure, len(batch))
+	for i := range batch {
+		pending[i].index = i
+	}
+
+	// fail returns the pending entries with the error of a request that was not made or failed.
+	fail := func(err error) ([]entryFailure, error) {
+		code, message := requestErrorCode(err)
+		for i := range pending {
+			pending[i].errorCode, pending[i].errorMessage = code, message
+		}
+
+		return pending, err
 	}
 
-	if res != nil && res.FailedRecordCount != nil && *res.FailedRecordCount > 0 {
+	for retry := 0; ; retry++ {
+		s.printf("Sending %d records to Kinesis stream %s\n", len(batch), s.name)
+		if retryCount < 0 {
+			s.printf("Retry count exceeded for Kinesis stream %s\n", s.name)
+			return pending, errors.New("retry count exceeded")
+		}
+
+		if s.limiter != nil {
+			delay, err := s.limiter.reserve(ctx, batch)
+			if err != nil {
+				s.sendError(err)
+			}
+
+			if delay > 0 {
+				s.printf("Waiting %v for the shard limits of Kinesis stream %s\n", delay, s.name)
+				if err := sleep(ctx, delay); err != nil {
+					return fail(err)
+				}
+			}
+		}
+
+		res, err := s.kinesisClient.PutRecords(ctx, &kinesis.PutRecordsInput{
+			Records:    batch,
+			StreamName: aws.String(s.name),
+		})
+
+		if err != nil {
+			s.printf("Error sending records to Kinesis stream %s: %v\n", s.name, err)
+			return fail(err)
+		}
+
+		if res == nil {
+			return nil, nil
+		}
+
+		s.stats.bytes.Add(acceptedBytes(res, batch))
+
+		if res.FailedRecordCount == nil || *res.FailedRecordCount == 0 {
+			return nil, nil
+		}
+
 		s.printf("Failed to send %d records to Kinesis stream %s\n", *res.FailedRecordCount, s.name)
-		failedRecords := s.wrapWithPutRecordsRequestEntry(getFailedRecords(res, batch))
-		batch = failedRecords
+		pending = getFailedEntries(res, pending)
+		batch = getFailedRecords(res, batch)
 		retryCount--
+		if retryCount < 0 {
+			continue
+		}
+
+		retried := len(pending)
+		if counts != nil {
+			retried = 0
+			for _, f := range pending {
+				retried += counts[f.index]
+			}
+		}
 
+		s.stats.retried.Add(int64(retried))
 		s.printf("Retrying %d records to Kinesis stream %s\n", len(batch), s.name)
-		time.Sleep(s.retryWaitTime)
-		failed, err := s.putRecords(batch, retryCount)
-		if err != nil {
-			return failed, err
+		if err := sleep(ctx, s.retryDelay(pending, retry+1)); err != nil {
+			return pending, err
 		}
 	}
-	return 0, err
 }
 
-func (s *stream) transformRecords(records []interface{}) ([]*kinesis.PutRecordsRequestEntry, error) {
-	var transformedRecords []*kinesis.PutRecordsRequestEntry
-	failedRecords := 0
-	var err error
-	var js []byte
-	for _, record := range records {
-		js, err = json.Marshal(record)
-		if err != nil {
-			failedRecords += 1
-			continue
-		}
+// getFailedEntries returns the pending entries that failed, with the error Kinesis returned for them.
+func getFailedEntries(response *kinesis.PutRecordsOutput, pending []entryFailure) []entryFailure {
+	failed := make([]entryFailure, 0)
 
-		transformedRecords = append(transformedRecords, &kinesis.PutRecordsRequestEntry{
-			Data:         addOutputSeparatorIfNeeded(js),
-			PartitionKey: aws.String((*s.partitioner)(js)),
-		})
+	for i, record := range response.Records {
+		if record.ErrorCode != nil {
+			failed = append(failed, entryFailure{
+				index:        pending[i].index,
+				errorCode:    aws.ToString(record.ErrorCode),
+				errorMessage: aws.ToString(record.ErrorMessage),
+			})
+		}
 	}
 
-	if failedRecords > 0 {
-		s.printf("Failed to transform %d records to Kinesis stream %s\n", failedRecords, s.name)
+	return failed
+}
+
+// requestErrorCode returns the error code and message of a failed PutRecords request.
+func requestErrorCode(err error) (string, string) {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode(), apiErr.ErrorMessage()
 	}
 
-	return transformedRecords, err
+	return ErrorCodeRequestFailed, err.Error()
 }
 
-func getFailedRecords(response *kinesis.PutRecordsOutput, records []*kinesis.PutRecordsRequestEntry) [][]byte {
-	failedRecords := make([][]byte, 0)
+// transformRecord encodes a record into a Kinesis entry, with the keys chosen by the record or the partitioner.
+// Spilled records are already encoded and keep the keys they were spilled with.
+func (s *stream) transformRecord(record interface{}) (types.PutRecordsRequestEntry, error) {
+	if spilled, ok := record.(spilledRecord); ok {
+		return spilled.entry.toEntry(), nil
+	}
 
-	for i, record := range response.Records {
-		if record.ErrorCode != nil {
-			failedRecords = append(failedRecords, records[i].Data)
+	data, err := s.encoder.Encode(record)
+	if err != nil {
+		s.printf("Failed to transform record to Kinesis stream %s: %v\n", s.name, err)
+		return types.PutRecordsRequestEntry{}, err
+	}
+
+	entry := types.PutRecordsRequestEntry{
+		Data:         s.framing.frame(data),
+		PartitionKey: aws.String(s.partitionKey(record, data)),
+	}
+
+	if keyer, ok := record.(ExplicitHashKeyer); ok && keyer.ExplicitHashKey() != "" {
+		entry.ExplicitHashKey = aws.String(keyer.ExplicitHashKey())
+	}
+
+	return entry, nil
+}
+
+// partitionKey returns the partition key of a record, chosen by the record if it implements PartitionKeyer,
+// or by the partitioner from its encoded bytes otherwise.
+func (s *stream) partitionKey(record interface{}, data []byte) string {
+	if keyer, ok := record.(PartitionKeyer); ok {
+		if key := keyer.PartitionKey(); key != "" {
+			return key
 		}
 	}
 
-	return failedRecords
+	return (*s.partitioner)(data)
 }
 
-func (s *stream) wrapWithPutRecordsRequestEntry(records [][]byte) []*kinesis.PutRecordsRequestEntry {
-	var transformedRecords []*kinesis.PutRecordsRequestEntry
+// getFailedRecords returns the entries that failed, keeping their partition and explicit hash keys
+// so that retried records land on the same shard.
+func getFailedRecords(response *kinesis.PutRecordsOutput, records []types.PutRecordsRequestEntry) []types.PutRecordsRequestEntry {
+	failedRecords := make([]types.PutRecordsRequestEntry, 0)
 
-	for _, record := range records {
-		transformedRecords = append(transformedRecords, &kinesis.PutRecordsRequestEntry{
-			Data:         addOutputSeparatorIfNeeded(record),
-			PartitionKey: aws.String((*s.partitioner)(record)),
-		})
+	for i, record := range response.Records {
+		if record.ErrorCode != nil {
+			failedRecords = append(failedRecords, records[i])
+		}
 	}
 
-	return transformedRecords
+	return failedRecords
 }
 func addOutputSeparatorIfNeeded(record []byte) []byte {
 	if len(record) == 0 {
@@ -1,6 +1,7 @@
 package inskinesis
 
 import (
+	"context"
 	"errors"
 	"net"
 	"net/http"
@@ -9,12 +10,12 @@ import (
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/client"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -25,6 +26,8 @@ func newTestStream(kc KinesisInterface, logBufferSize, maxGroup int) *stream {
 		region:        "eu-west-1",
 		name:          "test-stream",
 		partitioner:   PartitionerPointer(fakePartitioner),
+		encoder:       Encoders.JSON(),
+		framing:       FramingNewline,
 		kinesisClient: kc,
 
 		logBufferSize:          logBufferSize,
@@ -35,9 +38,11 @@ func newTestStream(kc KinesisInterface, logBufferSize, maxGroup int) *stream {
 		wgLogChan:        &sync.WaitGroup{},
 		wgBatchChan:      &sync.WaitGroup{},
 		logChannel:       make(chan interface{}, 2000),
-		batchChannel:     make(chan []interface{}, 100),
+		batchChannel:     make(chan queuedBatch, 100),
 		errChannel:       make(chan error, errorChannelSize),
 		stopChannel:      make(chan bool, 10),
+		flushChannel:     make(chan chan struct{}, 10),
+		stoppedChannel:   make(chan struct{}),
 		stopBatchChannel: make(chan bool, 10),
 
 		retryCount:    1,
@@ -49,8 +54,8 @@ func newTestStream(kc KinesisInterface, logBufferSize, maxGroup int) *stream {
 
 func successPutOutput() *kinesis.PutRecordsOutput {
 	return &kinesis.PutRecordsOutput{
-		FailedRecordCount: aws.Int64(0),
-		Records:           []*kinesis.PutRecordsResultEntry{},
+		FailedRecordCount: aws.Int32(0),
+		Records:           []types.PutRecordsResultEntry{},
 	}
 }
 
@@ -94,24 +99,23 @@ func Test_kinesisProxy_PutRecords(t *testing.T) {
 		}))
 		defer ts.Close()
 
-		sess := session.Must(session.NewSession(&aws.Config{
-			Region:      aws.String("eu-west-1"),
-			Endpoint:    aws.String(ts.URL),
-			DisableSSL:  aws.Bool(true),
-			Credentials: credentials.NewStaticCredentials("test", "test", ""),
-			MaxRetries:  aws.Int(0),
-		}))
+		k := kinesis.New(kinesis.Options{
+			Region:           "eu-west-1",
+			BaseEndpoint:     aws.String(ts.URL),
+			Credentials:      credentials.NewStaticCredentialsProvider("test", "test", ""),
+			RetryMaxAttempts: 1,
+		})
 
-		p := &kinesisProxy{kinesis.New(sess)}
-		out, err := p.PutRecords(&kinesis.PutRecordsInput{
+		p := &kinesisProxy{k}
+		out, err := p.PutRecords(context.Background(), &kinesis.PutRecordsInput{
 			StreamName: aws.String("test"),
-			Records: []*kinesis.PutRecordsRequestEntry{
+			Records: []types.PutRecordsRequestEntry{
 				{Data: []byte("r\n"), PartitionKey: aws.String("pk")},
 			},
 		})
 
 		require.NoError(t, err)
-		assert.Equal(t, int64(0), aws.Int64Value(out.FailedRecordCount))
+		assert.Equal(t, int32(0), aws.ToInt32(out.FailedRecordCount))
 	})
 }
 
@@ -123,7 +127,7 @@ func TestStream_PutAndFlush(t *testing.T) {
 		s.start()
 
 		mockKinesis.EXPECT().
-			PutRecords(gomock.Any()).
+			PutRecords(gomock.Any(), gomock.Any()).
 			Times(1).
 			Return(successPutOutput(), nil)
 
@@ -131,8 +135,8 @@ func TestStream_PutAndFlush(t *testing.T) {
 		s.Put(map[string]string{"k2": "v2"})
 		s.FlushAndStopStreaming()
 
-		assert.Equal(t, 2, s.totalCount)
-		assert.Equal(t, 0, s.failedCount)
+		assert.Equal(t, int64(2), s.Stats().Put)
+		assert.Equal(t, int64(0), s.Stats().Failed)
 	})
 
 	t.Run("it_should_flush_mid_stream_when_buffer_size_exceeded", func(t *testing.T) {
@@ -142,7 +146,7 @@ func TestStream_PutAndFlush(t *testing.T) {
 		s.start()
 
 		mockKinesis.EXPECT().
-			PutRecords(gomock.Any()).
+			PutRecords(gomock.Any(), gomock.Any()).
 			MinTimes(1).
 			Return(successPutOutput(), nil)
 
@@ -151,7 +155,7 @@ func TestStream_PutAndFlush(t *testing.T) {
 		}
 		s.FlushAndStopStreaming()
 
-		assert.Equal(t, 4, s.totalCount)
+		assert.Equal(t, int64(4), s.Stats().Put)
 	})
 
 	t.Run("it_should_stop_cleanly_with_empty_buffer", func(t *testing.T) {
@@ -162,7 +166,7 @@ func TestStream_PutAndFlush(t *testing.T) {
 
 		s.FlushAndStopStreaming()
 
-		assert.Equal(t, 0, s.totalCount)
+		assert.Equal(t, int64(0), s.Stats().Put)
 	})
 
 	t.Run("it_should_report_batching_error_for_unmarshalable_records", func(t *testing.T) {
@@ -189,7 +193,7 @@ func TestStream_PutAndFlush(t *testing.T) {
 		s.start()
 
 		mockKinesis.EXPECT().
-			PutRecords(gomock.Any()).
+			PutRecords(gomock.Any(), gomock.Any()).
 			MinTimes(1).
 			Return(nil, errors.New("kinesis unavailable"))
 
@@ -202,7 +206,190 @@ func TestStream_PutAndFlush(t *testing.T) {
 		case <-time.After(2 * time.Second):
 			t.Fatal("no error received from Error() channel")
 		}
-		assert.Equal(t, 1, s.failedCount)
+		assert.Equal(t, int64(1), s.Stats().Failed)
+	})
+}
+
+func TestStream_Flush(t *testing.T) {
+	t.Run("it_should_send_pending_records_and_keep_streaming", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.start()
+
+		sent := 0
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			Times(2).
+			DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+				sent += len(input.Records)
+				return successPutOutput(), nil
+			})
+
+		s.Put(map[string]string{"k1": "v1"})
+		s.Put(map[string]string{"k2": "v2"})
+		s.Flush()
+		assert.Equal(t, 2, sent, "Flush should return after the records are sent")
+
+		s.Put(map[string]string{"k3": "v3"})
+		s.Flush()
+		assert.Equal(t, 3, sent)
+
+		s.FlushAndStopStreaming()
+		assert.Equal(t, int64(3), s.Stats().Put)
+	})
+
+	t.Run("it_should_return_with_empty_buffer", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		s := newTestStream(NewMockKinesisInterface(ctrl), 100, 1)
+		s.start()
+
+		s.Flush()
+		s.FlushAndStopStreaming()
+	})
+
+	t.Run("it_should_return_after_the_stream_is_stopped", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		s := newTestStream(NewMockKinesisInterface(ctrl), 100, 1)
+		s.start()
+		s.FlushAndStopStreaming()
+
+		flushed := make(chan struct{})
+		go func() {
+			defer close(flushed)
+			for i := 0; i < 20; i++ {
+				s.Flush()
+			}
+		}()
+
+		select {
+		case <-flushed:
+		case <-time.After(time.Second):
+			t.Fatal("Flush should not block once the stream is stopped")
+		}
+	})
+
+	t.Run("it_should_not_wait_for_the_records_put_after_it", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 1, 2)
+		s.start()
+
+		sending := make(chan struct{})
+		release := make(chan struct{})
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			Times(2).
+			DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+				if len(input.Records) == 2 {
+					close(sending)
+					<-release
+				}
+
+				return successPutOutput(), nil
+			})
+
+		s.Put(order{Id: 1})
+		s.Flush()
+		assert.Equal(t, int64(1), s.Stats().Sent)
+
+		s.Put(order{Id: 2})
+		s.Put(order{Id: 3})
+		<-sending
+
+		flushed := make(chan struct{})
+		go func() {
+			defer close(flushed)
+			s.Flush()
+		}()
+
+		select {
+		case <-flushed:
+			t.Fatal("Flush should wait for the records put before it")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		close(release)
+		<-flushed
+		assert.Equal(t, int64(3), s.Stats().Sent)
+		s.FlushAndStopStreaming()
+	})
+
+	t.Run("it_should_flush_while_records_are_put_concurrently", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 10, 2)
+		s.start()
+
+		mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).AnyTimes().Return(successPutOutput(), nil)
+
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					s.Put(order{Id: w*100 + i})
+				}
+			}(w)
+		}
+
+		for i := 0; i < 10; i++ {
+			s.Flush()
+		}
+
+		wg.Wait()
+		s.Flush()
+		assert.Equal(t, int64(400), s.Stats().Sent)
+		s.FlushAndStopStreaming()
+	})
+}
+
+func TestStream_lingerInterval(t *testing.T) {
+	t.Run("it_should_send_partial_buffer_after_linger_interval", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.lingerInterval = 10 * time.Millisecond
+		s.start()
+
+		sent := make(chan int, 1)
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+				sent <- len(input.Records)
+				return successPutOutput(), nil
+			})
+
+		s.Put(map[string]string{"k1": "v1"})
+		s.Put(map[string]string{"k2": "v2"})
+
+		select {
+		case n := <-sent:
+			assert.Equal(t, 2, n)
+		case <-time.After(2 * time.Second):
+			t.Fatal("records were not sent after the linger interval")
+		}
+
+		s.FlushAndStopStreaming()
+	})
+
+	t.Run("it_should_not_send_partial_buffer_without_linger_interval", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.start()
+
+		s.Put(map[string]string{"k1": "v1"})
+		time.Sleep(50 * time.Millisecond)
+
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(successPutOutput(), nil)
+
+		s.FlushAndStopStreaming()
 	})
 }
 
@@ -213,11 +400,11 @@ func TestStream_PutRecords(t *testing.T) {
 		s := newTestStream(mockKinesis, 100, 1)
 
 		mockKinesis.EXPECT().
-			PutRecords(gomock.Any()).
+			PutRecords(gomock.Any(), gomock.Any()).
 			Times(1).
 			Return(successPutOutput(), nil)
 
-		failed, err := s.PutRecords([]interface{}{map[string]string{"k": "v"}})
+		failed, err := s.PutRecords(context.Background(), []interface{}{map[string]string{"k": "v"}})
 		assert.NoError(t, err)
 		assert.Equal(t, 0, failed)
 	})
@@ -227,7 +414,7 @@ func TestStream_PutRecords(t *testing.T) {
 		s := newTestStream(NewMockKinesisInterface(ctrl), 100, 1)
 
 		batch := []interface{}{make(chan int)}
-		failed, err := s.PutRecords(batch)
+		failed, err := s.PutRecords(context.Background(), batch)
 
 		assert.Error(t, err)
 		assert.Equal(t, len(batch), failed)
@@ -240,7 +427,7 @@ func Test_putRecords_retryExceeded(t *testing.T) {
 		mockKinesis := NewMockKinesisInterface(ctrl)
 		s := newTestStream(mockKinesis, 100, 1)
 
-		failed, err := s.putRecords([]*kinesis.PutRecordsRequestEntry{
+		failed, err := s.putRecords(context.Background(), []types.PutRecordsRequestEntry{
 			{Data: []byte("r\n"), PartitionKey: aws.String(testPartition)},
 		}, -1)
 
@@ -249,22 +436,6 @@ func Test_putRecords_retryExceeded(t *testing.T) {
 	})
 }
 
-func Test_transformRecords_partialFailure(t *testing.T) {
-	t.Run("it_should_silently_drop_failed_record_when_later_record_succeeds", func(t *testing.T) {
-		s := newTestStream(nil, 100, 1)
-
-		records := []interface{}{
-			make(chan int),
-			map[string]string{"k": "v"},
-		}
-
-		transformed, err := s.transformRecords(records)
-
-		assert.NoError(t, err, "current behavior: error swallowed by later success")
-		assert.Len(t, transformed, 1, "current behavior: failed record silently dropped")
-	})
-}
-
 func Test_addOutputSeparatorIfNeeded(t *testing.T) {
 	t.Run("it_should_return_empty_record_unchanged", func(t *testing.T) {
 		assert.Empty(t, addOutputSeparatorIfNeeded([]byte{}))
@@ -293,39 +464,35 @@ func TestTakeSliceArg(t *testing.T) {
 	})
 }
 
-func Test_createBatches_invalidInput(t *testing.T) {
-	t.Run("it_should_reject_non_slice_input", func(t *testing.T) {
-		batches, err := createBatches("not-a-slice", 10, 1024)
-		assert.EqualError(t, err, "invalid input")
-		assert.Nil(t, batches)
-	})
-}
-
 type timeoutNetError struct{}
 
 func (timeoutNetError) Error() string   { return "i/o timeout" }
 func (timeoutNetError) Timeout() bool   { return true }
 func (timeoutNetError) Temporary() bool { return true }
 
-func TestCustomRetryer_ShouldRetry(t *testing.T) {
-	retryer := CustomRetryer{Retryer: client.DefaultRetryer{NumMaxRetries: 3}}
+func TestCustomRetryer_IsErrorRetryable(t *testing.T) {
+	retryer := CustomRetryer{Retryer: retry.NewStandard()}
 
 	t.Run("it_should_retry_on_net_timeout", func(t *testing.T) {
-		req := &request.Request{Error: timeoutNetError{}}
-		assert.True(t, retryer.ShouldRetry(req))
+		assert.True(t, retryer.IsErrorRetryable(timeoutNetError{}))
 	})
 
 	t.Run("it_should_retry_on_connection_reset", func(t *testing.T) {
-		req := &request.Request{Error: &net.OpError{Op: "read", Err: errors.New("read: connection reset by peer")}}
-		assert.True(t, retryer.ShouldRetry(req))
+		err := &net.OpError{Op: "read", Err: errors.New("read: connection reset by peer")}
+		assert.True(t, retryer.IsErrorRetryable(err))
 	})
 
-	t.Run("it_should_delegate_other_errors_to_default_retryer", func(t *testing.T) {
-		req := &request.Request{
-			Error:     errors.New("some other failure"),
-			Retryable: aws.Bool(false),
+	t.Run("it_should_retry_on_wrapped_connection_reset", func(t *testing.T) {
+		err := &smithy.OperationError{
+			ServiceID:     "Kinesis",
+			OperationName: "PutRecords",
+			Err:           &net.OpError{Op: "read", Err: errors.New("read: connection reset by peer")},
 		}
-		assert.False(t, retryer.ShouldRetry(req))
+		assert.True(t, retryer.IsErrorRetryable(err))
+	})
+
+	t.Run("it_should_delegate_other_errors_to_default_retryer", func(t *testing.T) {
+		assert.False(t, retryer.IsErrorRetryable(errors.New("some other failure")))
 	})
 }
 
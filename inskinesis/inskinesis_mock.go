@@ -1,9 +1,10 @@
 package inskinesis
 
 import (
+	context "context"
 	reflect "reflect"
 
-	kinesis "github.com/aws/aws-sdk-go/service/kinesis"
+	kinesis "github.com/aws/aws-sdk-go-v2/service/kinesis"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -31,18 +32,23 @@ func (m *MockKinesisInterface) EXPECT() *MockKinesisInterfaceMockRecorder {
 }
 
 // PutRecords mocks base method.
-func (m *MockKinesisInterface) PutRecords(input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error) {
+func (m *MockKinesisInterface) PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PutRecords", input)
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PutRecords", varargs...)
 	ret0, _ := ret[0].(*kinesis.PutRecordsOutput)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // PutRecords indicates an expected call of PutRecords.
-func (mr *MockKinesisInterfaceMockRecorder) PutRecords(input any) *gomock.Call {
+func (mr *MockKinesisInterfaceMockRecorder) PutRecords(ctx, params any, optFns ...any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutRecords", reflect.TypeOf((*MockKinesisInterface)(nil).PutRecords), input)
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutRecords", reflect.TypeOf((*MockKinesisInterface)(nil).PutRecords), varargs...)
 }
 
 // MockStreamInterface is a mock of StreamInterface interface.
@@ -68,6 +74,18 @@ func (m *MockStreamInterface) EXPECT() *MockStreamInterfaceMockRecorder {
 	return m.recorder
 }
 
+// Flush mocks base method.
+func (m *MockStreamInterface) Flush() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Flush")
+}
+
+// Flush indicates an expected call of Flush.
+func (mr *MockStreamInterfaceMockRecorder) Flush() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockStreamInterface)(nil).Flush))
+}
+
 // FlushAndStopStreaming mocks base method.
 func (m *MockStreamInterface) FlushAndStopStreaming() {
 	m.ctrl.T.Helper()
@@ -1,40 +1,19 @@
 package inskinesis
 
 import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/kinesis"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 	"testing"
 )
 
-func Test_wrapWithPutRecordsRequestEntry(t *testing.T) {
-	s := stream{
-		partitioner: PartitionerPointer(Partitioners.UUID),
-	}
-
-	t.Run("it_should_return_put_records_request_entry_correctly", func(t *testing.T) {
-		records := [][]byte{[]byte("record1"), []byte("record2")}
-		expected := []*kinesis.PutRecordsRequestEntry{
-			{
-				Data: []byte("record1\n"),
-			},
-			{
-				Data: []byte("record2\n"),
-			},
-		}
-		actual := s.wrapWithPutRecordsRequestEntry(records)
-
-		assert.Equal(t, expected[0].Data, actual[0].Data)
-		assert.Equal(t, expected[1].Data, actual[1].Data)
-
-	})
-}
-
 func Test_getFailedRecords(t *testing.T) {
 	t.Run("it_should_return_failed_records_correctly", func(t *testing.T) {
 		response := &kinesis.PutRecordsOutput{
-			Records: []*kinesis.PutRecordsResultEntry{
+			Records: []types.PutRecordsResultEntry{
 				{
 					ErrorCode: aws.String("error1"),
 				},
@@ -43,7 +22,7 @@ func Test_getFailedRecords(t *testing.T) {
 				},
 			},
 		}
-		records := []*kinesis.PutRecordsRequestEntry{
+		records := []types.PutRecordsRequestEntry{
 			{
 				Data: []byte("record1\n"),
 			},
@@ -51,14 +30,14 @@ func Test_getFailedRecords(t *testing.T) {
 				Data: []byte("record2\n"),
 			},
 		}
-		expected := [][]byte{[]byte("record1\n"), []byte("record2\n")}
+		expected := records
 		actual := getFailedRecords(response, records)
 		assert.Equal(t, expected, actual)
 	})
 
 	t.Run("it_should_return_empty_slice_when_no_failed_records", func(t *testing.T) {
 		response := &kinesis.PutRecordsOutput{
-			Records: []*kinesis.PutRecordsResultEntry{
+			Records: []types.PutRecordsResultEntry{
 				{
 					ErrorCode: nil,
 				},
@@ -67,7 +46,7 @@ func Test_getFailedRecords(t *testing.T) {
 				},
 			},
 		}
-		records := []*kinesis.PutRecordsRequestEntry{
+		records := []types.PutRecordsRequestEntry{
 			{
 				Data: []byte("record1\n"),
 			},
@@ -75,15 +54,17 @@ func Test_getFailedRecords(t *testing.T) {
 				Data: []byte("record2\n"),
 			},
 		}
-		expected := [][]byte{}
+		expected := []types.PutRecordsRequestEntry{}
 		actual := getFailedRecords(response, records)
 		assert.Equal(t, expected, actual)
 	})
 }
 
-func Test_transformRecords(t *testing.T) {
+func Test_transformRecord(t *testing.T) {
 	s := stream{
 		partitioner: PartitionerPointer(Partitioners.UUID),
+		encoder:     Encoders.JSON(),
+		framing:     FramingNewline,
 	}
 
 	t.Run("it_should_return_transformed_records_correctly", func(t *testing.T) {
@@ -95,7 +76,7 @@ func Test_transformRecords(t *testing.T) {
 				"key2": "value2",
 			},
 		}
-		expected := []*kinesis.PutRecordsRequestEntry{
+		expected := []types.PutRecordsRequestEntry{
 			{
 				Data: []byte("{\"key1\":\"value1\"}\n"),
 			},
@@ -103,65 +84,40 @@ func Test_transformRecords(t *testing.T) {
 				Data: []byte("{\"key2\":\"value2\"}\n"),
 			},
 		}
-		actual, err := s.transformRecords(records)
-		assert.Nil(t, err)
 
-		assert.Equal(t, expected[0].Data, actual[0].Data)
-		assert.Equal(t, expected[1].Data, actual[1].Data)
+		for i, record := range records {
+			actual, err := s.transformRecord(record)
+			assert.Nil(t, err)
+
+			assert.Equal(t, expected[i].Data, actual.Data)
+			assert.Len(t, aws.ToString(actual.PartitionKey), 36)
+		}
 	})
 
 	t.Run("it_should_return_error_when_failed_to_transform_records", func(t *testing.T) {
-		records := []interface{}{make(chan int)}
-		transformed, err := s.transformRecords(records)
+		transformed, err := s.transformRecord(make(chan int))
 		assert.Error(t, err)
-		assert.Nil(t, transformed)
+		assert.Nil(t, transformed.Data)
 	})
 }
 
 func Test_CreateBatches(t *testing.T) {
+	encoded := func(key string, size int) encodedRecord {
+		return encodedRecord{records: []interface{}{key}, entry: types.PutRecordsRequestEntry{Data: make([]byte, size)}}
+	}
+
 	t.Run("it_should_return_batches_correctly", func(t *testing.T) {
-		records := []interface{}{
-			map[string]string{
-				"key1": "value1",
-			},
-			map[string]string{
-				"key2": "value2",
-			},
-			map[string]string{
-				"key3": "value3",
-			},
-			map[string]string{
-				"key4": "value4",
-			},
-		}
-		expected := [][]interface{}{
-			{
-				map[string]string{
-					"key1": "value1",
-				},
-				map[string]string{
-					"key2": "value2",
-				},
-			},
-			{
-				map[string]string{
-					"key3": "value3",
-				},
-				map[string]string{
-					"key4": "value4",
-				},
-			},
-		}
-		actual, err := createBatches(records, 2, 100)
-		assert.Nil(t, err)
-		assert.Equal(t, expected, actual)
+		records := []encodedRecord{encoded("a", 10), encoded("b", 10), encoded("c", 10), encoded("d", 10)}
+
+		actual := createBatches(records, 2, 100)
+		assert.Equal(t, [][]encodedRecord{records[:2], records[2:]}, actual)
 	})
 
-	t.Run("it_should_return_error_when_failed_to_create_batches", func(t *testing.T) {
-		records := []interface{}{make(chan int)}
-		batches, err := createBatches(records, 2, 100)
-		assert.Error(t, err)
-		assert.Nil(t, batches)
+	t.Run("it_should_split_batches_on_the_encoded_size", func(t *testing.T) {
+		records := []encodedRecord{encoded("a", 60), encoded("b", 40), encoded("c", 1), encoded("d", 200)}
+
+		actual := createBatches(records, 10, 100)
+		assert.Equal(t, [][]encodedRecord{records[:2], records[2:3], records[3:]}, actual)
 	})
 }
 
@@ -179,7 +135,7 @@ func Test_putRecords(t *testing.T) {
 	}
 
 	t.Run("it_should_retry", func(t *testing.T) {
-		records := []*kinesis.PutRecordsRequestEntry{
+		records := []types.PutRecordsRequestEntry{
 			{
 				Data:         []byte("record1\n"),
 				PartitionKey: aws.String(testPartition),
@@ -191,8 +147,8 @@ func Test_putRecords(t *testing.T) {
 		}
 
 		resp := kinesis.PutRecordsOutput{
-			FailedRecordCount: aws.Int64(2),
-			Records: []*kinesis.PutRecordsResultEntry{
+			FailedRecordCount: aws.Int32(2),
+			Records: []types.PutRecordsResultEntry{
 				{
 					ErrorCode: aws.String("error1"),
 				},
@@ -202,17 +158,17 @@ func Test_putRecords(t *testing.T) {
 			},
 		}
 
-		s.kinesisClient.(*MockKinesisInterface).EXPECT().PutRecords(&kinesis.PutRecordsInput{
+		s.kinesisClient.(*MockKinesisInterface).EXPECT().PutRecords(gomock.Any(), &kinesis.PutRecordsInput{
 			Records:    records,
 			StreamName: aws.String(s.name),
 		}).Times(4).Return(&resp, nil)
-		failedCount, _ := s.putRecords(records, 3)
+		failedCount, _ := s.putRecords(context.Background(), records, 3)
 
 		assert.Equal(t, 2, failedCount)
 	})
 
 	t.Run("it_should_not_retry_when_failed_record_count_is_zero", func(t *testing.T) {
-		records := []*kinesis.PutRecordsRequestEntry{
+		records := []types.PutRecordsRequestEntry{
 			{
 				Data:         []byte("record1\n"),
 				PartitionKey: aws.String(testPartition),
@@ -224,8 +180,8 @@ func Test_putRecords(t *testing.T) {
 		}
 
 		resp := kinesis.PutRecordsOutput{
-			FailedRecordCount: aws.Int64(0),
-			Records: []*kinesis.PutRecordsResultEntry{
+			FailedRecordCount: aws.Int32(0),
+			Records: []types.PutRecordsResultEntry{
 				{
 					ErrorCode: nil,
 				},
@@ -235,11 +191,11 @@ func Test_putRecords(t *testing.T) {
 			},
 		}
 
-		s.kinesisClient.(*MockKinesisInterface).EXPECT().PutRecords(&kinesis.PutRecordsInput{
+		s.kinesisClient.(*MockKinesisInterface).EXPECT().PutRecords(gomock.Any(), &kinesis.PutRecordsInput{
 			Records:    records,
 			StreamName: aws.String(s.name),
 		}).Times(1).Return(&resp, nil)
-		failedCount, _ := s.putRecords(records, 3)
+		failedCount, _ := s.putRecords(context.Background(), records, 3)
 
 		assert.Equal(t, 0, failedCount)
 	})
@@ -0,0 +1,72 @@
+package inskinesis
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// otelCounter is an observable counter reporting one of the stream counters.
+type otelCounter struct {
+	name        string
+	description string
+	unit        string
+	value       func(Stats) int64
+}
+
+var otelCounters = []otelCounter{
+	{"inskinesis.records.put", "Number of records put into the log buffer.", "", func(s Stats) int64 { return s.Put }},
+	{"inskinesis.records.batched", "Number of records split into batches.", "", func(s Stats) int64 { return s.Batched }},
+	{"inskinesis.records.sent", "Number of records sent to Kinesis.", "", func(s Stats) int64 { return s.Sent }},
+	{"inskinesis.records.failed", "Number of records that could not be sent.", "", func(s Stats) int64 { return s.Failed }},
+	{"inskinesis.records.retried", "Number of records sent again after Kinesis rejected them.", "", func(s Stats) int64 { return s.Retried }},
+	{"inskinesis.records.dropped", "Number of records dropped by Put.", "", func(s Stats) int64 { return s.Dropped }},
+	{"inskinesis.records.spilled", "Number of records spilled to disk by Put.", "", func(s Stats) int64 { return s.Spilled }},
+	{"inskinesis.errors.dropped", "Number of errors dropped because the error channel was full.", "", func(s Stats) int64 { return s.ErrorsDropped }},
+	{"inskinesis.bytes", "Bytes of the Kinesis records accepted by Kinesis.", "By", func(s Stats) int64 { return s.Bytes }},
+}
+
+// RegisterOTelMetrics reports the Stats of a stream as OpenTelemetry observable counters of the given meter, every
+// measurement having the stream name as attribute:
+// - inskinesis.records.put, .batched, .sent, .failed, .retried, .dropped and .spilled: the record counters.
+// - inskinesis.errors.dropped: number of errors dropped because the error channel was full.
+// - inskinesis.bytes: bytes of the Kinesis records accepted by Kinesis.
+//
+// Unregister the returned registration once the stream is stopped.
+func RegisterOTelMetrics(meter metric.Meter, streamName string, stream StreamInterface) (metric.Registration, error) {
+	instruments := make([]metric.Int64ObservableCounter, len(otelCounters))
+	observables := make([]metric.Observable, len(otelCounters))
+
+	for i, c := range otelCounters {
+		opts := []metric.Int64ObservableCounterOption{metric.WithDescription(c.description)}
+		if c.unit != "" {
+			opts = append(opts, metric.WithUnit(c.unit))
+		}
+
+		instrument, err := meter.Int64ObservableCounter(c.name, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("error while creating %s counter: %w", c.name, err)
+		}
+
+		instruments[i] = instrument
+		observables[i] = instrument
+	}
+
+	attrs := metric.WithAttributes(attribute.String("stream", streamName))
+
+	registration, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stats := stream.Stats()
+		for i, c := range otelCounters {
+			o.ObserveInt64(instruments[i], c.value(stats), attrs)
+		}
+
+		return nil
+	}, observables...)
+	if err != nil {
+		return nil, fmt.Errorf("error while registering stream metrics callback: %w", err)
+	}
+
+	return registration, nil
+}
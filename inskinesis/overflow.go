@@ -0,0 +1,223 @@
+package inskinesis
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// OverflowPolicy decides what Put does with a record when the log channel is full.
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"       // Put waits until the log channel has room.
+	OverflowDropNewest OverflowPolicy = "drop-newest" // Put drops the record.
+	OverflowDropOldest OverflowPolicy = "drop-oldest" // Put drops the oldest record of the log channel to make room.
+	OverflowSpill      OverflowPolicy = "spill"       // Put writes the record to a file, sent with the next flush.
+)
+
+// ErrBufferFull is returned by TryPut when the log channel is full.
+var ErrBufferFull = errors.New("log channel is full")
+
+func (p OverflowPolicy) validate() error {
+	switch p {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowSpill:
+		return nil
+	default:
+		return fmt.Errorf("unknown overflow policy %q", p)
+	}
+}
+
+// overflow handles a record that does not fit in the full log channel, following the overflow policy.
+func (s *stream) overflow(record interface{}) {
+	switch s.overflowPolicy {
+	case OverflowDropNewest:
+		s.drop(1)
+	case OverflowDropOldest:
+		s.wgLogChan.Add(1)
+		for {
+			select {
+			case s.logChannel <- record:
+				return
+			default:
+			}
+
+			// Waits until either the record fits or an oldest record can be dropped, rather than spinning.
+			select {
+			case s.logChannel <- record:
+				return
+			case <-s.logChannel:
+				s.drop(1)
+				s.wgLogChan.Done()
+			}
+		}
+	case OverflowSpill:
+		entry, err := s.transformRecord(record)
+		if err != nil {
+			s.stats.failed.Add(1)
+			s.fail(record, ErrorCodeMarshalFailed, err.Error())
+			s.sendError(err)
+			return
+		}
+
+		if err := s.spill.write(entry); err != nil {
+			s.drop(1)
+			s.sendError(fmt.Errorf("failed to spill record of Kinesis stream %s: %w", s.name, err))
+			return
+		}
+
+		s.stats.spilled.Add(1)
+	default:
+		s.wgLogChan.Add(1)
+		s.logChannel <- record
+	}
+}
+
+func (s *stream) drop(count int) {
+	s.stats.dropped.Add(int64(count))
+	s.printf("Dropped %d records of Kinesis stream %s\n", count, s.name)
+}
+
+// spillEntry is the Kinesis entry of a record written to the spill file, encoded before it is spilled.
+type spillEntry struct {
+	PartitionKey    string `json:"partitionKey"`
+	ExplicitHashKey string `json:"explicitHashKey,omitempty"`
+	Data            []byte `json:"data"`
+}
+
+func newSpillEntry(entry types.PutRecordsRequestEntry) spillEntry {
+	return spillEntry{
+		PartitionKey:    aws.ToString(entry.PartitionKey),
+		ExplicitHashKey: aws.ToString(entry.ExplicitHashKey),
+		Data:            entry.Data,
+	}
+}
+
+func (e spillEntry) toEntry() types.PutRecordsRequestEntry {
+	entry := types.PutRecordsRequestEntry{
+		Data:         e.Data,
+		PartitionKey: aws.String(e.PartitionKey),
+	}
+
+	if e.ExplicitHashKey != "" {
+		entry.ExplicitHashKey = aws.String(e.ExplicitHashKey)
+	}
+
+	return entry
+}
+
+// spilledRecord is a record read back from the spill file, sent as its spilled entry.
+type spilledRecord struct {
+	entry spillEntry
+}
+
+// spillFile stores Kinesis entries as JSON lines in a temporary file until they are drained.
+type spillFile struct {
+	mu   sync.Mutex
+	dir  string
+	file *os.File // Opened on the first write.
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &spillFile{dir: dir}, nil
+}
+
+func (f *spillFile) write(entry types.PutRecordsRequestEntry) error {
+	line, err := json.Marshal(newSpillEntry(entry))
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if f.file, err = os.CreateTemp(f.dir, "inskinesis-*.spill"); err != nil {
+			return err
+		}
+	}
+
+	_, err = f.file.Write(append(line, outputSeparator))
+	return err
+}
+
+// drain returns the spilled records, in the order they were written, and empties the file.
+func (f *spillFile) drain() ([]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil, nil
+	}
+
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	records, readErr := readSpilledRecords(f.file)
+
+	// The file is emptied even if it could not be read to the end, so that a corrupted line is not read again.
+	if err := f.file.Truncate(0); err != nil {
+		return records, err
+	}
+
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return records, err
+	}
+
+	return records, readErr
+}
+
+func readSpilledRecords(r io.Reader) ([]interface{}, error) {
+	var records []interface{}
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes(outputSeparator)
+		if len(line) > 1 {
+			var entry spillEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return records, err
+			}
+
+			records = append(records, spilledRecord{entry: entry})
+		}
+
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+
+		if err != nil {
+			return records, err
+		}
+	}
+}
+
+// close removes the spill file.
+func (f *spillFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	name := f.file.Name()
+	err := f.file.Close()
+	f.file = nil
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+
+	return err
+}
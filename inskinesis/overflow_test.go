@@ -0,0 +1,240 @@
+package inskinesis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// newFullTestStream returns a test stream, not started yet, whose log channel holds a single record.
+func newFullTestStream(kc KinesisInterface, policy OverflowPolicy) *stream {
+	s := newTestStream(kc, 100, 1)
+	s.logChannel = make(chan interface{}, 1)
+	s.overflowPolicy = policy
+
+	return s
+}
+
+// expectSentData expects a single PutRecords call and returns the data of the records it sends once the stream stops.
+func expectSentData(mockKinesis *MockKinesisInterface) *[]string {
+	var data []string
+	mockKinesis.EXPECT().
+		PutRecords(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+			for _, r := range input.Records {
+				data = append(data, string(r.Data))
+			}
+			return successPutOutput(), nil
+		})
+
+	return &data
+}
+
+func TestNewKinesis_overflow(t *testing.T) {
+	t.Run("it_should_apply_channel_and_policy_defaults", func(t *testing.T) {
+		si, err := NewKinesis(Config{Region: "eu-west-1", StreamName: "test"})
+		require.NoError(t, err)
+
+		s := si.(*stream)
+		assert.Equal(t, 2000, cap(s.logChannel))
+		assert.Equal(t, 100, cap(s.batchChannel))
+		assert.Equal(t, 100, cap(s.errChannel))
+		assert.Equal(t, OverflowBlock, s.overflowPolicy)
+		assert.Nil(t, s.spill)
+
+		si.FlushAndStopStreaming()
+	})
+
+	t.Run("it_should_use_configured_channel_sizes", func(t *testing.T) {
+		si, err := NewKinesis(Config{Region: "eu-west-1", StreamName: "test", LogChannelSize: 10, BatchChannelSize: 5, ErrorChannelSize: 1})
+		require.NoError(t, err)
+
+		s := si.(*stream)
+		assert.Equal(t, 10, cap(s.logChannel))
+		assert.Equal(t, 5, cap(s.batchChannel))
+		assert.Equal(t, 1, cap(s.errChannel))
+
+		si.FlushAndStopStreaming()
+	})
+
+	t.Run("it_should_validate_the_overflow_policy", func(t *testing.T) {
+		_, err := NewKinesis(Config{Region: "eu-west-1", StreamName: "test", OverflowPolicy: "drop-all"})
+		assert.EqualError(t, err, `unknown overflow policy "drop-all"`)
+
+		_, err = NewKinesis(Config{Region: "eu-west-1", StreamName: "test", OverflowPolicy: OverflowSpill})
+		assert.EqualError(t, err, "spill directory is required")
+	})
+}
+
+func TestStream_TryPut(t *testing.T) {
+	t.Run("it_should_return_an_error_when_the_log_channel_is_full", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newFullTestStream(mockKinesis, OverflowDropOldest)
+
+		assert.NoError(t, s.TryPut(map[string]int{"i": 0}))
+		assert.ErrorIs(t, s.TryPut(map[string]int{"i": 1}), ErrBufferFull)
+		assert.Zero(t, s.Dropped(), "TryPut should not apply the overflow policy")
+
+		data := expectSentData(mockKinesis)
+		s.start()
+		s.FlushAndStopStreaming()
+
+		assert.Equal(t, []string{"{\"i\":0}\n"}, *data)
+	})
+}
+
+func TestStream_PutContext(t *testing.T) {
+	t.Run("it_should_give_up_when_the_context_is_done", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newFullTestStream(mockKinesis, OverflowBlock)
+
+		require.NoError(t, s.PutContext(context.Background(), map[string]int{"i": 0}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := s.PutContext(ctx, map[string]int{"i": 1})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		data := expectSentData(mockKinesis)
+		s.start()
+		s.FlushAndStopStreaming()
+
+		assert.Equal(t, []string{"{\"i\":0}\n"}, *data)
+	})
+}
+
+func TestStream_Put_overflow(t *testing.T) {
+	t.Run("it_should_drop_the_newest_records", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newFullTestStream(mockKinesis, OverflowDropNewest)
+
+		for i := 0; i < 3; i++ {
+			s.Put(map[string]int{"i": i})
+		}
+
+		assert.Equal(t, int64(2), s.Dropped())
+
+		data := expectSentData(mockKinesis)
+		s.start()
+		s.FlushAndStopStreaming()
+
+		assert.Equal(t, []string{"{\"i\":0}\n"}, *data)
+	})
+
+	t.Run("it_should_drop_the_oldest_records", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newFullTestStream(mockKinesis, OverflowDropOldest)
+
+		for i := 0; i < 3; i++ {
+			s.Put(map[string]int{"i": i})
+		}
+
+		assert.Equal(t, int64(2), s.Dropped())
+
+		data := expectSentData(mockKinesis)
+		s.start()
+		s.FlushAndStopStreaming()
+
+		assert.Equal(t, []string{"{\"i\":2}\n"}, *data)
+	})
+
+	t.Run("it_should_wait_for_room_when_there_is_no_record_to_drop", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newFullTestStream(mockKinesis, OverflowDropOldest)
+		s.logChannel = make(chan interface{})
+
+		put := make(chan struct{})
+		go func() {
+			defer close(put)
+			s.Put(map[string]int{"i": 0})
+		}()
+
+		select {
+		case <-put:
+			t.Fatal("Put should wait while the log channel has no room and no record")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		data := expectSentData(mockKinesis)
+		s.start()
+		<-put
+		s.FlushAndStopStreaming()
+
+		assert.Zero(t, s.Dropped())
+		assert.Equal(t, []string{"{\"i\":0}\n"}, *data)
+	})
+
+	t.Run("it_should_spill_records_to_disk_and_send_them_on_flush", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newFullTestStream(mockKinesis, OverflowSpill)
+
+		dir := t.TempDir()
+		spill, err := newSpillFile(dir)
+		require.NoError(t, err)
+		s.spill = spill
+
+		s.Put(map[string]int{"i": 0})
+		s.Put(map[string]int{"i": 1})
+		s.Put(keyedRecord{Value: "v", key: "key", hash: "42"})
+
+		assert.Zero(t, s.Dropped())
+		assert.Equal(t, int64(2), s.Stats().Spilled)
+
+		var keys []string
+		mockKinesis.EXPECT().
+			PutRecords(gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(_ context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+				require.Len(t, input.Records, 3)
+				assert.Equal(t, "{\"i\":0}\n", string(input.Records[0].Data))
+				assert.Equal(t, "{\"i\":1}\n", string(input.Records[1].Data))
+				assert.Equal(t, "{\"value\":\"v\"}\n", string(input.Records[2].Data))
+
+				for _, r := range input.Records {
+					keys = append(keys, aws.ToString(r.PartitionKey))
+				}
+				assert.Equal(t, "42", aws.ToString(input.Records[2].ExplicitHashKey))
+
+				return successPutOutput(), nil
+			})
+
+		s.start()
+		s.FlushAndStopStreaming()
+
+		assert.Equal(t, []string{testPartition, testPartition, "key"}, keys, "spilled records should keep their keys")
+		assert.Equal(t, int64(3), s.Stats().Put)
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, files, "the spill file should be removed")
+	})
+}
+
+func TestStream_sendError(t *testing.T) {
+	t.Run("it_should_count_errors_dropped_when_the_channel_is_full", func(t *testing.T) {
+		s := newTestStream(nil, 100, 1)
+		s.errChannel = make(chan error, 1)
+
+		s.sendError(errors.New("first"))
+		s.sendError(errors.New("second"))
+
+		assert.EqualError(t, <-s.Error(), "first")
+		assert.Equal(t, int64(1), s.Stats().ErrorsDropped)
+	})
+}
@@ -1,10 +1,34 @@
 package inskinesis
 
-import uuid "github.com/google/uuid"
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	uuid "github.com/google/uuid"
+)
+
+// maxPartitionKeyLength is the maximum length of a Kinesis partition key.
+const maxPartitionKeyLength = 256
 
 // PartitionerFunction is the common signature of all partitioners, it maps a record to a partition key.
+// The record is passed as its encoded bytes, so partitioners reading JSON fields require the JSON encoder.
 type PartitionerFunction func(record interface{}) string
 
+// PartitionKeyer is implemented by records choosing their own partition key, taking precedence over the partitioner.
+// Records returning an empty key are partitioned by the partitioner.
+type PartitionKeyer interface {
+	PartitionKey() string
+}
+
+// ExplicitHashKeyer is implemented by records choosing the hash key that determines their shard,
+// instead of the MD5 hash of the partition key. Records returning an empty key are hashed by partition key.
+type ExplicitHashKeyer interface {
+	ExplicitHashKey() string
+}
+
 type partitionersCollection struct{}
 
 var Partitioners = partitionersCollection{}
@@ -15,6 +39,74 @@ func (p *partitionersCollection) UUID(_ interface{}) string {
 	return uuid.New().String()
 }
 
+// Hash partitioner returns the hex encoded MD5 hash of the record, so identical records land on the same shard.
+// Example: `Partitioner: PartitionerPointer(Partitioners.Hash)`
+func (p *partitionersCollection) Hash(record interface{}) string {
+	sum := md5.Sum(recordBytes(record))
+	return hex.EncodeToString(sum[:])
+}
+
+// JSONField returns a partitioner using the value of a field of the record as partition key, so records sharing the
+// value land on the same shard. Nested fields are separated by dots. Values that are not strings are used in their
+// JSON form, and values longer than the partition key limit are hashed.
+// Records without the field fall back to the UUID partitioner.
+// Example: `Partitioner: PartitionerPointer(Partitioners.JSONField("user.id"))`
+func (p *partitionersCollection) JSONField(path string) PartitionerFunction {
+	fields := strings.Split(path, ".")
+
+	return func(record interface{}) string {
+		key := jsonField(recordBytes(record), fields)
+		if key == "" {
+			return p.UUID(nil)
+		}
+
+		if len(key) > maxPartitionKeyLength {
+			return p.Hash([]byte(key))
+		}
+
+		return key
+	}
+}
+
+// jsonField returns the value of a nested field of a JSON object, or an empty string if it is missing or null.
+func jsonField(data []byte, fields []string) string {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return ""
+	}
+
+	for _, field := range fields {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+
+		value = object[field]
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		js, _ := json.Marshal(v)
+		return string(js)
+	}
+}
+
+// recordBytes returns the marshalled record without its output separator, marshalling records that are not bytes.
+func recordBytes(record interface{}) []byte {
+	data, ok := record.([]byte)
+	if !ok {
+		data, _ = json.Marshal(record)
+	}
+
+	return bytes.TrimSuffix(data, []byte{outputSeparator})
+}
+
 // PartitionerPointer returns a pointer to the PartitionerPointer value passed in.
 func PartitionerPointer(function PartitionerFunction) *PartitionerFunction {
 	fn := &function
@@ -0,0 +1,111 @@
+package inskinesis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPartitioners_Hash(t *testing.T) {
+	t.Run("it_should_return_the_same_key_for_the_same_record", func(t *testing.T) {
+		a := Partitioners.Hash([]byte(`{"k":"v"}`))
+
+		assert.Len(t, a, 32)
+		assert.Equal(t, a, Partitioners.Hash([]byte("{\"k\":\"v\"}\n")), "the output separator should be ignored")
+		assert.Equal(t, a, Partitioners.Hash(map[string]string{"k": "v"}))
+		assert.NotEqual(t, a, Partitioners.Hash([]byte(`{"k":"w"}`)))
+	})
+}
+
+func TestPartitioners_JSONField(t *testing.T) {
+	partitioner := Partitioners.JSONField("user.id")
+
+	t.Run("it_should_use_the_value_of_a_nested_field", func(t *testing.T) {
+		assert.Equal(t, "42", partitioner([]byte(`{"user":{"id":"42"}}`)))
+		assert.Equal(t, "12345678901234567890", partitioner([]byte(`{"user":{"id":12345678901234567890}}`)))
+		assert.Equal(t, `{"a":1}`, partitioner([]byte(`{"user":{"id":{"a":1}}}`)))
+	})
+
+	t.Run("it_should_fall_back_to_uuid_without_the_field", func(t *testing.T) {
+		a := partitioner([]byte(`{"user":{}}`))
+		b := partitioner([]byte(`{"user":{"id":null}}`))
+
+		assert.Len(t, a, 36)
+		assert.NotEqual(t, a, b)
+		assert.Len(t, partitioner([]byte(`not json`)), 36)
+	})
+
+	t.Run("it_should_hash_values_longer_than_the_key_limit", func(t *testing.T) {
+		long := strings.Repeat("x", maxPartitionKeyLength+1)
+
+		assert.Equal(t, Partitioners.Hash([]byte(long)), partitioner([]byte(`{"user":{"id":"`+long+`"}}`)))
+	})
+}
+
+type keyedRecord struct {
+	Value string `json:"value"`
+	key   string
+	hash  string
+}
+
+func (r keyedRecord) PartitionKey() string {
+	return r.key
+}
+
+func (r keyedRecord) ExplicitHashKey() string {
+	return r.hash
+}
+
+func Test_transformRecord_keyers(t *testing.T) {
+	s := stream{partitioner: PartitionerPointer(fakePartitioner), encoder: Encoders.JSON(), framing: FramingNewline}
+
+	t.Run("it_should_use_keys_chosen_by_the_record", func(t *testing.T) {
+		keyed, err := s.transformRecord(keyedRecord{Value: "a", key: "key", hash: "170141183460469231731687303715884105728"})
+		require.NoError(t, err)
+
+		unkeyed, err := s.transformRecord(keyedRecord{Value: "b"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "key", aws.ToString(keyed.PartitionKey))
+		assert.Equal(t, "170141183460469231731687303715884105728", aws.ToString(keyed.ExplicitHashKey))
+		assert.Equal(t, testPartition, aws.ToString(unkeyed.PartitionKey), "empty keys should fall back to the partitioner")
+		assert.Nil(t, unkeyed.ExplicitHashKey)
+	})
+}
+
+func Test_putRecords_keepsKeysOnRetry(t *testing.T) {
+	t.Run("it_should_retry_failed_records_with_their_keys", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.partitioner = PartitionerPointer(Partitioners.UUID)
+
+		records := []types.PutRecordsRequestEntry{
+			{Data: []byte("a\n"), PartitionKey: aws.String("key-a")},
+			{Data: []byte("b\n"), PartitionKey: aws.String("key-b"), ExplicitHashKey: aws.String("1")},
+		}
+
+		gomock.InOrder(
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(&kinesis.PutRecordsOutput{
+				FailedRecordCount: aws.Int32(1),
+				Records:           []types.PutRecordsResultEntry{{}, {ErrorCode: aws.String("ProvisionedThroughputExceededException")}},
+			}, nil),
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), &kinesis.PutRecordsInput{
+				Records:    records[1:],
+				StreamName: aws.String(s.name),
+			}).Return(successPutOutput(), nil),
+		)
+
+		failed, err := s.putRecords(context.Background(), records, 1)
+
+		assert.NoError(t, err)
+		assert.Zero(t, failed)
+	})
+}
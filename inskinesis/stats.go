@@ -0,0 +1,67 @@
+package inskinesis
+
+import (
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// Stats is a snapshot of the counters of a stream, all counted since the stream was created.
+type Stats struct {
+	Put           int64 // Records put into the log buffer, from the log channel or the spill file.
+	Batched       int64 // Records split into batches to be sent.
+	Sent          int64 // Records sent to Kinesis successfully.
+	Failed        int64 // Records that could not be sent, after retries.
+	Retried       int64 // Records sent again after Kinesis rejected them.
+	Dropped       int64 // Records dropped by Put, following the overflow policy or failing to be spilled.
+	Spilled       int64 // Records spilled to disk by Put.
+	ErrorsDropped int64 // Errors dropped because the error channel was full.
+	Bytes         int64 // Bytes of the data of the Kinesis records accepted by Kinesis, aggregated records included.
+}
+
+// streamStats holds the counters of a stream, safe to update from concurrent goroutines.
+type streamStats struct {
+	put           atomic.Int64
+	batched       atomic.Int64
+	sent          atomic.Int64
+	failed        atomic.Int64
+	retried       atomic.Int64
+	dropped       atomic.Int64
+	spilled       atomic.Int64
+	errorsDropped atomic.Int64
+	bytes         atomic.Int64
+}
+
+func (s *streamStats) snapshot() Stats {
+	return Stats{
+		Put:           s.put.Load(),
+		Batched:       s.batched.Load(),
+		Sent:          s.sent.Load(),
+		Failed:        s.failed.Load(),
+		Retried:       s.retried.Load(),
+		Dropped:       s.dropped.Load(),
+		Spilled:       s.spilled.Load(),
+		ErrorsDropped: s.errorsDropped.Load(),
+		Bytes:         s.bytes.Load(),
+	}
+}
+
+// Stats returns the counters of the stream. It is safe to call while records are being sent.
+func (s *stream) Stats() Stats {
+	return s.stats.snapshot()
+}
+
+// acceptedBytes returns the size of the data of the entries accepted by Kinesis.
+func acceptedBytes(response *kinesis.PutRecordsOutput, entries []types.PutRecordsRequestEntry) int64 {
+	var size int64
+	for i, entry := range entries {
+		if i < len(response.Records) && response.Records[i].ErrorCode != nil {
+			continue
+		}
+
+		size += int64(len(entry.Data))
+	}
+
+	return size
+}
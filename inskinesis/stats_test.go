@@ -0,0 +1,123 @@
+package inskinesis
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/mock/gomock"
+)
+
+func TestStream_Stats(t *testing.T) {
+	t.Run("it_should_count_records_through_the_stream", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+		s.start()
+
+		gomock.InOrder(
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(&kinesis.PutRecordsOutput{
+				FailedRecordCount: aws.Int32(1),
+				Records:           []types.PutRecordsResultEntry{{}, {ErrorCode: aws.String("ProvisionedThroughputExceededException")}, {}},
+			}, nil),
+			mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(&kinesis.PutRecordsOutput{
+				FailedRecordCount: aws.Int32(1),
+				Records:           []types.PutRecordsResultEntry{{ErrorCode: aws.String("ProvisionedThroughputExceededException")}},
+			}, nil),
+		)
+
+		for i := 0; i < 3; i++ {
+			s.Put(map[string]int{"i": i})
+		}
+		s.FlushAndStopStreaming()
+
+		assert.Equal(t, Stats{
+			Put:     3,
+			Batched: 3,
+			Sent:    2,
+			Failed:  1,
+			Retried: 1,
+			Bytes:   int64(2 * len("{\"i\":0}\n")),
+		}, s.Stats())
+	})
+
+	t.Run("it_should_be_safe_with_concurrent_batches", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 1, 4)
+		s.maxStreamBatchSize = 1
+		s.start()
+
+		mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).AnyTimes().Return(successPutOutput(), nil)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 25; i++ {
+					s.Put(map[string]int{"i": i})
+					_ = s.Stats()
+				}
+			}()
+		}
+		wg.Wait()
+		s.FlushAndStopStreaming()
+
+		stats := s.Stats()
+		assert.Equal(t, int64(100), stats.Put)
+		assert.Equal(t, int64(100), stats.Sent)
+		assert.Zero(t, stats.Failed)
+	})
+}
+
+type statsStream struct {
+	StreamInterface
+	stats Stats
+}
+
+func (s statsStream) Stats() Stats {
+	return s.stats
+}
+
+func TestRegisterOTelMetrics(t *testing.T) {
+	t.Run("it_should_observe_the_stream_stats", func(t *testing.T) {
+		reader := metric.NewManualReader()
+		provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+		stream := statsStream{stats: Stats{Put: 10, Sent: 7, Failed: 1, Dropped: 2, Bytes: 1024}}
+		registration, err := RegisterOTelMetrics(provider.Meter("inskinesis"), "test-stream", stream)
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, registration.Unregister())
+		}()
+
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+		require.Len(t, rm.ScopeMetrics, 1)
+
+		metrics := make(map[string]metricdata.Sum[int64])
+		for _, m := range rm.ScopeMetrics[0].Metrics {
+			metrics[m.Name] = m.Data.(metricdata.Sum[int64])
+		}
+
+		assert.Len(t, metrics, len(otelCounters))
+		assert.Equal(t, int64(10), metrics["inskinesis.records.put"].DataPoints[0].Value)
+		assert.Equal(t, int64(7), metrics["inskinesis.records.sent"].DataPoints[0].Value)
+		assert.Equal(t, int64(1), metrics["inskinesis.records.failed"].DataPoints[0].Value)
+		assert.Equal(t, int64(2), metrics["inskinesis.records.dropped"].DataPoints[0].Value)
+		assert.Equal(t, int64(1024), metrics["inskinesis.bytes"].DataPoints[0].Value)
+		assert.True(t, metrics["inskinesis.bytes"].IsMonotonic)
+
+		name, ok := metrics["inskinesis.bytes"].DataPoints[0].Attributes.Value("stream")
+		require.True(t, ok)
+		assert.Equal(t, "test-stream", name.AsString())
+	})
+}
@@ -0,0 +1,327 @@
+package inskinesis
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// DefaultMaxRetryWaitTime is the upper bound of the wait between retries of throttled records.
+const DefaultMaxRetryWaitTime = 5 * time.Second
+
+// errorCodeThroughputExceeded is the error code of records rejected because their shard is over its limits.
+const errorCodeThroughputExceeded = "ProvisionedThroughputExceededException"
+
+// Write limits of a Kinesis shard.
+const (
+	shardBytesPerSecond   = 1024 * 1024
+	shardRecordsPerSecond = 1000
+)
+
+// shardRefreshInterval is how often the shards of the stream are listed, to follow resharding.
+const shardRefreshInterval = time.Minute
+
+// shardRefreshBackoff is the wait before listing the shards again after a failure, doubled at every consecutive failure
+// up to the refresh interval.
+const shardRefreshBackoff = time.Second
+
+// retryDelay returns the wait before the given retry of failed entries, one for the first retry.
+// Throttled entries wait exponentially longer at every retry, from the retry wait time up to the max retry wait time,
+// with full jitter so concurrent batches do not retry in lockstep. Other failures wait the retry wait time.
+func (s *stream) retryDelay(failures []entryFailure, retry int) time.Duration {
+	throttled := false
+	for _, f := range failures {
+		if f.errorCode == errorCodeThroughputExceeded {
+			throttled = true
+			break
+		}
+	}
+
+	if !throttled || retry <= 0 {
+		return s.retryWaitTime
+	}
+
+	d := s.retryWaitTime
+	for i := 1; i < retry && d < s.maxRetryWaitTime; i++ {
+		d *= 2
+	}
+
+	if d > s.maxRetryWaitTime {
+		d = s.maxRetryWaitTime
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// sleep pauses for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// KinesisShardLister lists the shards of a stream, used to predict the shard of the records when rate limiting.
+type KinesisShardLister interface {
+	ListShards(ctx context.Context, params *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error)
+}
+
+// shardRange is the hash key range of an open shard.
+type shardRange struct {
+	id    string
+	start *big.Int
+	end   *big.Int
+}
+
+// tokenBucket tracks the write budget of a shard, going negative when records are sent ahead of the budget.
+type tokenBucket struct {
+	bytes   float64
+	records float64
+	last    time.Time
+}
+
+// shardMap keeps the open shards of a stream, listing them again every refresh interval to follow resharding.
+// Shards are listed without holding the lock, by a single caller at a time, and the shard list is replaced rather than
+// modified, so callers keep using the shards listed before while a refresh is in progress.
+type shardMap struct {
+	lister     KinesisShardLister
+	streamName string
+
+	refreshInterval time.Duration
+	refreshBackoff  time.Duration
+	now             func() time.Time
+
+	mu          sync.Mutex
+	shards      []shardRange // Open shards, sorted by starting hash key.
+	refreshing  bool         // Whether a caller is listing the shards.
+	nextRefresh time.Time    // Time from which the shards are listed again.
+	failures    int          // Number of consecutive failures to list the shards.
+}
+
+func newShardMap(lister KinesisShardLister, streamName string) *shardMap {
+	return &shardMap{
+		lister:     lister,
+		streamName: streamName,
+
+		refreshInterval: shardRefreshInterval,
+		refreshBackoff:  shardRefreshBackoff,
+		now:             time.Now,
+	}
+}
+
+// get returns the open shards of the stream, listing them first when they are due for a refresh and no other caller
+// is already listing them.
+//
+// Returns:
+// - shards: The open shards, sorted by starting hash key, or the shards listed before if listing them fails.
+// - err: The error listing the shards.
+func (m *shardMap) get(ctx context.Context) ([]shardRange, error) {
+	m.mu.Lock()
+	if m.refreshing || m.now().Before(m.nextRefresh) {
+		defer m.mu.Unlock()
+		return m.shards, nil
+	}
+
+	m.refreshing = true
+	m.mu.Unlock()
+
+	shards, err := m.list(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshing = false
+	if err != nil {
+		backoff := m.refreshBackoff
+		for i := 0; i < m.failures && backoff < m.refreshInterval; i++ {
+			backoff *= 2
+		}
+
+		if backoff > m.refreshInterval {
+			backoff = m.refreshInterval
+		}
+
+		m.failures++
+		m.nextRefresh = m.now().Add(backoff)
+		return m.shards, err
+	}
+
+	m.failures = 0
+	m.nextRefresh = m.now().Add(m.refreshInterval)
+	m.shards = shards
+	return shards, nil
+}
+
+// list lists the open shards of the stream.
+func (m *shardMap) list(ctx context.Context) ([]shardRange, error) {
+	var shards []shardRange
+	input := &kinesis.ListShardsInput{StreamName: aws.String(m.streamName)}
+	for {
+		res, err := m.lister.ListShards(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("error listing shards of Kinesis stream %s: %w", m.streamName, err)
+		}
+
+		for _, shard := range res.Shards {
+			if shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil {
+				continue
+			}
+
+			r, ok := newShardRange(shard)
+			if !ok {
+				return nil, fmt.Errorf("invalid hash key range of shard %s of Kinesis stream %s", aws.ToString(shard.ShardId), m.streamName)
+			}
+
+			shards = append(shards, r)
+		}
+
+		if res.NextToken == nil {
+			break
+		}
+
+		input = &kinesis.ListShardsInput{NextToken: res.NextToken}
+	}
+
+	sort.Slice(shards, func(i, j int) bool {
+		return shards[i].start.Cmp(shards[j].start) < 0
+	})
+
+	return shards, nil
+}
+
+// predictShard returns the id of the shard whose hash key range holds the hash key of an entry, the explicit hash
+// key if set or the MD5 of the partition key otherwise, or an empty id if no shard does.
+func predictShard(shards []shardRange, entry types.PutRecordsRequestEntry) string {
+	hashKey := new(big.Int)
+	if entry.ExplicitHashKey != nil {
+		if _, ok := hashKey.SetString(*entry.ExplicitHashKey, 10); !ok {
+			return ""
+		}
+	} else {
+		sum := md5.Sum([]byte(aws.ToString(entry.PartitionKey)))
+		hashKey.SetBytes(sum[:])
+	}
+
+	i := sort.Search(len(shards), func(i int) bool {
+		return shards[i].end.Cmp(hashKey) >= 0
+	})
+
+	if i == len(shards) || shards[i].start.Cmp(hashKey) > 0 {
+		return ""
+	}
+
+	return shards[i].id
+}
+
+// shardLimiter delays batches so that the records predicted to land on every shard stay within the shard limits.
+type shardLimiter struct {
+	shards *shardMap
+
+	bytesPerSecond   float64
+	recordsPerSecond float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newShardLimiter(shards *shardMap) *shardLimiter {
+	return &shardLimiter{
+		shards: shards,
+
+		bytesPerSecond:   shardBytesPerSecond,
+		recordsPerSecond: shardRecordsPerSecond,
+
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// reserve takes the write budget of entries from the buckets of their shards.
+//
+// Returns:
+// - delay: How long to wait before sending the entries so that every shard stays within its limits.
+// - err: The error listing the shards, entries are then limited by the shards listed before, if any.
+func (l *shardLimiter) reserve(ctx context.Context, entries []types.PutRecordsRequestEntry) (time.Duration, error) {
+	shards, err := l.shards.get(ctx)
+	if len(shards) == 0 {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.shards.now()
+	var delay time.Duration
+	for _, entry := range entries {
+		shardId := predictShard(shards, entry)
+		if shardId == "" {
+			continue
+		}
+
+		bucket, ok := l.buckets[shardId]
+		if !ok {
+			bucket = &tokenBucket{bytes: l.bytesPerSecond, records: l.recordsPerSecond, last: now}
+			l.buckets[shardId] = bucket
+		}
+
+		if d := l.take(bucket, now, len(entry.Data)+len(aws.ToString(entry.PartitionKey))); d > delay {
+			delay = d
+		}
+	}
+
+	return delay, err
+}
+
+// take refills a bucket for the time elapsed, up to one second of budget, and takes the budget of a record from it.
+//
+// Returns:
+// - delay: How long until the bucket has no debt.
+func (l *shardLimiter) take(bucket *tokenBucket, now time.Time, size int) time.Duration {
+	elapsed := now.Sub(bucket.last).Seconds()
+	bucket.last = now
+	bucket.bytes = math.Min(bucket.bytes+elapsed*l.bytesPerSecond, l.bytesPerSecond) - float64(size)
+	bucket.records = math.Min(bucket.records+elapsed*l.recordsPerSecond, l.recordsPerSecond) - 1
+
+	debt := math.Max(-bucket.bytes/l.bytesPerSecond, -bucket.records/l.recordsPerSecond)
+	if debt <= 0 {
+		return 0
+	}
+
+	return time.Duration(debt * float64(time.Second))
+}
+
+func newShardRange(shard types.Shard) (shardRange, bool) {
+	if shard.HashKeyRange == nil {
+		return shardRange{}, false
+	}
+
+	start, ok := new(big.Int).SetString(aws.ToString(shard.HashKeyRange.StartingHashKey), 10)
+	if !ok {
+		return shardRange{}, false
+	}
+
+	end, ok := new(big.Int).SetString(aws.ToString(shard.HashKeyRange.EndingHashKey), 10)
+	if !ok {
+		return shardRange{}, false
+	}
+
+	return shardRange{id: aws.ToString(shard.ShardId), start: start, end: end}, true
+}
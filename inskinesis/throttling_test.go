@@ -0,0 +1,336 @@
+package inskinesis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// halfHashKey is the first hash key of the upper half of the hash key space.
+var halfHashKey = new(big.Int).Lsh(big.NewInt(1), 127)
+
+// fakeShardLister lists a page of shards per call.
+type fakeShardLister struct {
+	pages [][]types.Shard
+	err   error
+	calls int
+}
+
+func (l *fakeShardLister) ListShards(_ context.Context, input *kinesis.ListShardsInput, _ ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+	l.calls++
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	page := 0
+	if input.NextToken != nil {
+		page = int(aws.ToString(input.NextToken)[0] - '0')
+	}
+
+	out := &kinesis.ListShardsOutput{Shards: l.pages[page]}
+	if page+1 < len(l.pages) {
+		out.NextToken = aws.String(string(rune('0' + page + 1)))
+	}
+
+	return out, nil
+}
+
+func testShard(id string, start, end *big.Int, closed bool) types.Shard {
+	shard := types.Shard{
+		ShardId: aws.String(id),
+		HashKeyRange: &types.HashKeyRange{
+			StartingHashKey: aws.String(start.String()),
+			EndingHashKey:   aws.String(end.String()),
+		},
+		SequenceNumberRange: &types.SequenceNumberRange{StartingSequenceNumber: aws.String("1")},
+	}
+
+	if closed {
+		shard.SequenceNumberRange.EndingSequenceNumber = aws.String("2")
+	}
+
+	return shard
+}
+
+// newTestShardMap returns a shard map of two shards splitting the hash key space in halves, at a fixed time.
+func newTestShardMap(now *time.Time) (*shardMap, *fakeShardLister) {
+	maxHashKey := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+	lister := &fakeShardLister{pages: [][]types.Shard{
+		{testShard("shard-closed", big.NewInt(0), maxHashKey, true), testShard("shard-high", halfHashKey, maxHashKey, false)},
+		{testShard("shard-low", big.NewInt(0), new(big.Int).Sub(halfHashKey, big.NewInt(1)), false)},
+	}}
+
+	m := newShardMap(lister, "test-stream")
+	m.now = func() time.Time { return *now }
+
+	return m, lister
+}
+
+// newTestShardLimiter returns a limiter of the shards of newTestShardMap.
+func newTestShardLimiter(now *time.Time) (*shardLimiter, *fakeShardLister) {
+	m, lister := newTestShardMap(now)
+	return newShardLimiter(m), lister
+}
+
+// blockingShardLister lists shards once release is closed, signaling on listing when a call starts.
+type blockingShardLister struct {
+	fakeShardLister
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (l *blockingShardLister) ListShards(ctx context.Context, input *kinesis.ListShardsInput, optFns ...func(*kinesis.Options)) (*kinesis.ListShardsOutput, error) {
+	l.listing <- struct{}{}
+	<-l.release
+
+	return l.fakeShardLister.ListShards(ctx, input, optFns...)
+}
+
+func hashKeyEntry(hashKey *big.Int, size int) types.PutRecordsRequestEntry {
+	return types.PutRecordsRequestEntry{
+		Data:            make([]byte, size),
+		PartitionKey:    aws.String("k"),
+		ExplicitHashKey: aws.String(hashKey.String()),
+	}
+}
+
+func TestNewKinesis_throttling(t *testing.T) {
+	t.Run("it_should_apply_defaults", func(t *testing.T) {
+		si, err := NewKinesis(Config{Region: "eu-west-1", StreamName: "test"})
+		require.NoError(t, err)
+
+		s := si.(*stream)
+		assert.Equal(t, DefaultMaxRetryWaitTime, s.maxRetryWaitTime)
+		assert.Nil(t, s.limiter)
+
+		si.FlushAndStopStreaming()
+	})
+
+	t.Run("it_should_enable_the_shard_rate_limit", func(t *testing.T) {
+		si, err := NewKinesis(Config{Region: "eu-west-1", StreamName: "test", ShardRateLimit: true})
+		require.NoError(t, err)
+
+		s := si.(*stream)
+		require.NotNil(t, s.limiter)
+		assert.Equal(t, "test", s.limiter.shards.streamName)
+
+		si.FlushAndStopStreaming()
+	})
+}
+
+func TestStream_retryDelay(t *testing.T) {
+	s := newTestStream(nil, 100, 1)
+	s.retryWaitTime = 100 * time.Millisecond
+	s.maxRetryWaitTime = time.Second
+
+	throttled := []entryFailure{{errorCode: "InternalFailure"}, {errorCode: errorCodeThroughputExceeded}}
+
+	t.Run("it_should_wait_the_retry_wait_time_for_other_failures", func(t *testing.T) {
+		assert.Equal(t, 100*time.Millisecond, s.retryDelay([]entryFailure{{errorCode: "InternalFailure"}}, 3))
+	})
+
+	t.Run("it_should_back_off_exponentially_with_jitter_when_throttled", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			assert.LessOrEqual(t, s.retryDelay(throttled, 1), 100*time.Millisecond)
+			assert.LessOrEqual(t, s.retryDelay(throttled, 3), 400*time.Millisecond)
+			assert.LessOrEqual(t, s.retryDelay(throttled, 10), time.Second)
+		}
+
+		delays := make(map[time.Duration]bool)
+		for i := 0; i < 20; i++ {
+			delays[s.retryDelay(throttled, 10)] = true
+		}
+		assert.Greater(t, len(delays), 1, "delays should be jittered")
+	})
+}
+
+func Test_sleep(t *testing.T) {
+	t.Run("it_should_stop_waiting_when_the_context_is_done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.ErrorIs(t, sleep(ctx, time.Hour), context.Canceled)
+	})
+}
+
+func TestShardMap_get(t *testing.T) {
+	now := time.Now()
+	m, lister := newTestShardMap(&now)
+	shards, err := m.get(context.Background())
+	require.NoError(t, err)
+
+	t.Run("it_should_list_open_shards_of_every_page", func(t *testing.T) {
+		assert.Equal(t, 2, lister.calls)
+		require.Len(t, shards, 2)
+		assert.Equal(t, "shard-low", shards[0].id)
+		assert.Equal(t, "shard-high", shards[1].id)
+	})
+
+	t.Run("it_should_list_shards_again_after_the_refresh_interval", func(t *testing.T) {
+		_, err := m.get(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, lister.calls)
+
+		now = now.Add(shardRefreshInterval)
+		_, err = m.get(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 4, lister.calls)
+	})
+
+	t.Run("it_should_back_off_after_failures", func(t *testing.T) {
+		now := time.Now()
+		m, lister := newTestShardMap(&now)
+		lister.err = errors.New("access denied")
+
+		_, err := m.get(context.Background())
+		assert.ErrorContains(t, err, "access denied")
+
+		_, err = m.get(context.Background())
+		assert.NoError(t, err, "shards should not be listed again before the backoff")
+		assert.Equal(t, 1, lister.calls)
+
+		now = now.Add(shardRefreshBackoff)
+		_, err = m.get(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, 2, lister.calls)
+
+		now = now.Add(shardRefreshBackoff)
+		_, _ = m.get(context.Background())
+		assert.Equal(t, 2, lister.calls, "the backoff should double after consecutive failures")
+
+		now = now.Add(shardRefreshBackoff)
+		lister.err = nil
+		shards, err := m.get(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, shards, 2)
+		assert.Equal(t, 4, lister.calls)
+	})
+
+	t.Run("it_should_return_the_shards_listed_before_while_listing", func(t *testing.T) {
+		now := time.Now()
+		m, _ := newTestShardMap(&now)
+		lister := &blockingShardLister{fakeShardLister: *m.lister.(*fakeShardLister), listing: make(chan struct{}), release: make(chan struct{})}
+		m.lister = lister
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			shards, err := m.get(context.Background())
+			assert.NoError(t, err)
+			assert.Len(t, shards, 2)
+		}()
+
+		<-lister.listing
+		shards, err := m.get(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, shards, "callers should not wait for another caller listing the shards")
+
+		close(lister.release)
+		<-lister.listing
+		<-done
+	})
+}
+
+func Test_predictShard(t *testing.T) {
+	now := time.Now()
+	m, _ := newTestShardMap(&now)
+	shards, err := m.get(context.Background())
+	require.NoError(t, err)
+
+	t.Run("it_should_use_the_explicit_hash_key", func(t *testing.T) {
+		assert.Equal(t, "shard-low", predictShard(shards, hashKeyEntry(big.NewInt(0), 1)))
+		assert.Equal(t, "shard-low", predictShard(shards, hashKeyEntry(new(big.Int).Sub(halfHashKey, big.NewInt(1)), 1)))
+		assert.Equal(t, "shard-high", predictShard(shards, hashKeyEntry(halfHashKey, 1)))
+		assert.Empty(t, predictShard(shards, types.PutRecordsRequestEntry{ExplicitHashKey: aws.String("not a number")}))
+	})
+
+	t.Run("it_should_use_the_md5_of_the_partition_key", func(t *testing.T) {
+		// MD5("a") starts with 0x0c and MD5("b") with 0x92.
+		assert.Equal(t, "shard-low", predictShard(shards, types.PutRecordsRequestEntry{PartitionKey: aws.String("a")}))
+		assert.Equal(t, "shard-high", predictShard(shards, types.PutRecordsRequestEntry{PartitionKey: aws.String("b")}))
+	})
+}
+
+func TestShardLimiter_reserve(t *testing.T) {
+	t.Run("it_should_delay_records_over_the_shard_record_limit", func(t *testing.T) {
+		now := time.Now()
+		l, _ := newTestShardLimiter(&now)
+
+		entries := make([]types.PutRecordsRequestEntry, shardRecordsPerSecond)
+		for i := range entries {
+			entries[i] = hashKeyEntry(big.NewInt(0), 1)
+		}
+
+		delay, err := l.reserve(context.Background(), entries)
+		require.NoError(t, err)
+		assert.Zero(t, delay, "a second of records should be sent at once")
+
+		delay, err = l.reserve(context.Background(), entries[:10])
+		require.NoError(t, err)
+		assert.InDelta(t, 10*time.Millisecond, delay, float64(time.Microsecond))
+
+		delay, err = l.reserve(context.Background(), []types.PutRecordsRequestEntry{hashKeyEntry(halfHashKey, 1)})
+		require.NoError(t, err)
+		assert.Zero(t, delay, "other shards should not be delayed")
+
+		now = now.Add(time.Second)
+		delay, err = l.reserve(context.Background(), entries[:10])
+		require.NoError(t, err)
+		assert.Zero(t, delay, "the budget should be refilled over time")
+	})
+
+	t.Run("it_should_delay_records_over_the_shard_byte_limit", func(t *testing.T) {
+		now := time.Now()
+		l, _ := newTestShardLimiter(&now)
+
+		delay, err := l.reserve(context.Background(), []types.PutRecordsRequestEntry{
+			hashKeyEntry(halfHashKey, shardBytesPerSecond),
+			hashKeyEntry(halfHashKey, shardBytesPerSecond/2-1),
+		})
+
+		require.NoError(t, err)
+		assert.InDelta(t, 500*time.Millisecond, delay, float64(time.Millisecond))
+	})
+
+	t.Run("it_should_not_delay_records_without_shards", func(t *testing.T) {
+		now := time.Now()
+		l, lister := newTestShardLimiter(&now)
+		lister.err = errors.New("access denied")
+
+		delay, err := l.reserve(context.Background(), []types.PutRecordsRequestEntry{hashKeyEntry(big.NewInt(0), 1)})
+		assert.ErrorContains(t, err, "access denied")
+		assert.Zero(t, delay)
+
+		_, err = l.reserve(context.Background(), nil)
+		assert.NoError(t, err, "shards should not be listed again before the backoff")
+		assert.Equal(t, 1, lister.calls)
+	})
+}
+
+func TestStream_putRecords_withShardRateLimit(t *testing.T) {
+	t.Run("it_should_reserve_the_budget_of_the_sent_records", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockKinesis := NewMockKinesisInterface(ctrl)
+		s := newTestStream(mockKinesis, 100, 1)
+
+		now := time.Now()
+		s.limiter, _ = newTestShardLimiter(&now)
+
+		mockKinesis.EXPECT().PutRecords(gomock.Any(), gomock.Any()).Return(successPutOutput(), nil)
+
+		failed, err := s.putRecords(context.Background(), []types.PutRecordsRequestEntry{hashKeyEntry(big.NewInt(0), 10)}, 1)
+
+		require.NoError(t, err)
+		assert.Zero(t, failed)
+		assert.Equal(t, float64(shardRecordsPerSecond-1), s.limiter.buckets["shard-low"].records)
+	})
+}
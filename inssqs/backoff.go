@@ -0,0 +1,93 @@
+package inssqs
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// DefaultRetryMaxDelay is the upper bound of the delay between retry attempts when a base delay is configured.
+const DefaultRetryMaxDelay = 5 * time.Second
+
+// backoff computes the delays between the package-level retry attempts of a batch operation.
+// These are independent of the retries made by the AWS SDK within a single request.
+type backoff struct {
+	attempts  int // Number of attempts the operation starts with, used to derive the retry number.
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	deadline  time.Time // Time after which no retry is started, zero when retries are not time limited.
+}
+
+// newBackoff creates the backoff of an operation starting now.
+func (q *queue) newBackoff() backoff {
+	b := backoff{
+		attempts:  q.retryCount + 1,
+		baseDelay: q.retryBaseDelay,
+		maxDelay:  q.retryMaxDelay,
+	}
+
+	if q.retryDeadline > 0 {
+		b.deadline = time.Now().Add(q.retryDeadline)
+	}
+
+	return b
+}
+
+// delay returns the delay before the given retry, growing exponentially from the base delay up to the max delay,
+// with full jitter so concurrent callers do not retry in lockstep.
+func (b backoff) delay(retry int) time.Duration {
+	if b.baseDelay <= 0 || retry <= 0 {
+		return 0
+	}
+
+	d := b.baseDelay
+	for i := 1; i < retry && (b.maxDelay <= 0 || d < b.maxDelay); i++ {
+		d *= 2
+	}
+
+	if b.maxDelay > 0 && d > b.maxDelay {
+		d = b.maxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// wait pauses before a retry attempt, given the retry count left for the operation.
+//
+// Returns:
+// - err: ErrRetryDeadlineExceeded if the retry would start after the deadline, the context error if ctx is canceled
+// while waiting, nil otherwise. No pause is made before the first attempt.
+func (b backoff) wait(ctx context.Context, retryCount int) error {
+	retry := b.retry(retryCount)
+	if retry == 0 {
+		return nil
+	}
+
+	d := b.delay(retry)
+	if !b.deadline.IsZero() && time.Now().Add(d).After(b.deadline) {
+		return ErrRetryDeadlineExceeded
+	}
+
+	if d == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retry returns the number of the retry attempt given the retry count left for the operation, zero for the first attempt.
+func (b backoff) retry(retryCount int) int {
+	if retry := b.attempts - retryCount; retry > 0 {
+		return retry
+	}
+
+	return 0
+}
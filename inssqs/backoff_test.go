@@ -0,0 +1,117 @@
+package inssqs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestBackoff_delay(t *testing.T) {
+	t.Run("it_should_not_delay_without_base_delay", func(t *testing.T) {
+		b := backoff{maxDelay: time.Second}
+
+		assert.Zero(t, b.delay(3))
+	})
+
+	t.Run("it_should_stay_within_exponential_bounds", func(t *testing.T) {
+		b := backoff{baseDelay: 10 * time.Millisecond, maxDelay: 50 * time.Millisecond}
+
+		for i := 0; i < 100; i++ {
+			assert.LessOrEqual(t, b.delay(1), 10*time.Millisecond)
+			assert.LessOrEqual(t, b.delay(3), 40*time.Millisecond)
+			assert.LessOrEqual(t, b.delay(30), 50*time.Millisecond)
+			assert.GreaterOrEqual(t, b.delay(30), time.Duration(0))
+		}
+	})
+}
+
+func TestBackoff_wait(t *testing.T) {
+	t.Run("it_should_not_wait_before_the_first_attempt", func(t *testing.T) {
+		b := backoff{attempts: 4, baseDelay: time.Hour, deadline: time.Now()}
+
+		assert.NoError(t, b.wait(context.Background(), 4))
+	})
+
+	t.Run("it_should_fail_when_retry_would_pass_the_deadline", func(t *testing.T) {
+		b := backoff{attempts: 4, deadline: time.Now().Add(-time.Millisecond)}
+
+		assert.ErrorIs(t, b.wait(context.Background(), 3), ErrRetryDeadlineExceeded)
+	})
+
+	t.Run("it_should_stop_waiting_when_context_is_canceled", func(t *testing.T) {
+		b := backoff{attempts: 4, baseDelay: time.Hour, maxDelay: time.Hour}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := b.wait(ctx, 3)
+
+		// a zero jitter is possible but practically never drawn from an hour long range
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestQueue_SendMessageBatch_withBackoff(t *testing.T) {
+	t.Run("it_should_wait_between_retry_attempts", func(t *testing.T) {
+		q, client := newQueue(t)
+		q.retryBaseDelay = 20 * time.Millisecond
+		q.retryMaxDelay = 20 * time.Millisecond
+
+		var calls []time.Time
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(4).
+			DoAndReturn(func(context.Context, *awssqs.SendMessageBatchInput, ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				calls = append(calls, time.Now())
+				return nil, assert.AnError
+			})
+
+		_, err := q.SendMessageBatch([]SQSMessageEntry{{Id: aws.String("test-id")}})
+
+		assert.ErrorIs(t, err, ErrRetryCountExceeded)
+		require.Len(t, calls, 4)
+		assert.LessOrEqual(t, calls[3].Sub(calls[0]), time.Second, "delays should be capped by the max delay")
+	})
+
+	t.Run("it_should_stop_retrying_after_the_deadline", func(t *testing.T) {
+		q, client := newQueue(t)
+		q.retryDeadline = 30 * time.Millisecond
+		collected := collectDeadLetters(&q)
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			MinTimes(1).
+			DoAndReturn(func(context.Context, *awssqs.SendMessageBatchInput, ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				time.Sleep(20 * time.Millisecond)
+				return nil, assert.AnError
+			})
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{{Id: aws.String("test-id")}})
+
+		require.Len(t, failed, 1)
+		assert.ErrorIs(t, err, ErrRetryDeadlineExceeded)
+		assert.Len(t, *collected, 1, "entries out of retry time should be routed as exhausted")
+	})
+}
+
+func TestConfig_setDefaults_retryMaxDelay(t *testing.T) {
+	t.Run("it_should_default_max_delay_when_base_delay_is_set", func(t *testing.T) {
+		c := Config{RetryBaseDelay: time.Millisecond}
+		c.setDefaults()
+
+		assert.Equal(t, DefaultRetryMaxDelay, c.RetryMaxDelay)
+	})
+
+	t.Run("it_should_leave_backoff_disabled_by_default", func(t *testing.T) {
+		c := Config{}
+		c.setDefaults()
+
+		assert.Zero(t, c.RetryBaseDelay)
+		assert.Zero(t, c.RetryMaxDelay)
+	})
+}
@@ -0,0 +1,12 @@
+package inssqs
+
+import "github.com/useinsider/go-pkg/insdash"
+
+// createBatches splits entries into batches holding at most recordLimit entries and byteLimit bytes,
+// measuring each entry by the size SQS accounts for it rather than its JSON representation.
+// An entry larger than byteLimit is put into a batch of its own.
+func createBatches[T entry](entries []T, recordLimit int, byteLimit int) [][]T {
+	return insdash.CreateBatchesFunc(entries, recordLimit, byteLimit, func(e T) int {
+		return e.size()
+	})
+}
@@ -0,0 +1,54 @@
+package inssqs
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_createBatches(t *testing.T) {
+	t.Run("it_should_split_by_record_limit", func(t *testing.T) {
+		entries := []SQSMessageEntry{
+			{MessageBody: aws.String("a")},
+			{MessageBody: aws.String("b")},
+			{MessageBody: aws.String("c")},
+		}
+
+		batches := createBatches(entries, 2, 1024)
+
+		assert.Len(t, batches, 2)
+		assert.Len(t, batches[0], 2)
+		assert.Len(t, batches[1], 1)
+	})
+
+	t.Run("it_should_count_message_attributes_towards_the_byte_limit", func(t *testing.T) {
+		entries := []SQSMessageEntry{
+			{MessageBody: aws.String("12345"), MessageAttributes: map[string]SQSMessageAttribute{
+				"tenant": StringAttribute("acme"),
+			}},
+			{MessageBody: aws.String("12345")},
+		}
+
+		// first entry: 5 body + 6 name + 6 data type + 4 value = 21 bytes
+		assert.Equal(t, 21, entries[0].size())
+		assert.Len(t, createBatches(entries, 10, 26), 1)
+		assert.Len(t, createBatches(entries, 10, 25), 2)
+	})
+
+	t.Run("it_should_put_an_oversized_entry_in_its_own_batch", func(t *testing.T) {
+		entries := []SQSMessageEntry{
+			{MessageBody: aws.String("small")},
+			{MessageBody: aws.String("this body is larger than the limit")},
+			{MessageBody: aws.String("small")},
+		}
+
+		batches := createBatches(entries, 10, 10)
+
+		assert.Len(t, batches, 3)
+	})
+
+	t.Run("it_should_return_no_batches_for_no_entries", func(t *testing.T) {
+		assert.Empty(t, createBatches([]SQSDeleteMessageEntry{}, 10, 1024))
+	})
+}
@@ -0,0 +1,357 @@
+package inssqs
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pkg/errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// producerErrorChannelSize is the capacity of the error channel of a buffered producer.
+// Errors are dropped when it is full, so a producer never blocks on an unread error channel. Dropped errors are counted
+// and handed to the DroppedErrorHandler of the producer, if any.
+const producerErrorChannelSize = 100
+
+// BufferedProducerInterface defines the interface for an asynchronous producer batching single messages.
+type BufferedProducerInterface interface {
+	Put(entry SQSMessageEntry) error
+	Error() <-chan error
+	Flush(ctx context.Context) error
+	Close(ctx context.Context) error
+	DroppedErrors() int64
+}
+
+// ProducerError reports the messages of a buffered producer that could not be sent.
+type ProducerError struct {
+	Entries []SQSMessageEntry
+	Err     error
+}
+
+func (e *ProducerError) Error() string {
+	return fmt.Sprintf("failed to send %d messages: %v", len(e.Entries), e.Err)
+}
+
+func (e *ProducerError) Unwrap() error {
+	return e.Err
+}
+
+type bufferedProducer struct {
+	queue Interface
+
+	maxBatchSize      int
+	maxBatchSizeBytes int
+	linger            time.Duration
+
+	mu        sync.RWMutex // Guards closed, held for reading while a Put hands over its entry.
+	closed    bool
+	closeOnce sync.Once
+
+	entryChannel chan SQSMessageEntry
+	flushChannel chan chan struct{} // Flush requests, the channel is closed once the flush is done.
+	stopChannel  chan struct{}
+	done         chan struct{} // Closed once the background loop has drained everything and stopped.
+	errChannel   chan error
+
+	droppedErrors       atomic.Int64             // Number of errors dropped because the error channel was full.
+	droppedErrorHandler func(err *ProducerError) // Optional function receiving the dropped errors.
+
+	limiter chan struct{} // Limits the number of batches sent concurrently.
+	wg      sync.WaitGroup
+
+	buffer      []SQSMessageEntry
+	bufferBytes int
+	lingerTimer *time.Timer // Runs while the buffer is not empty, only used by the background loop.
+}
+
+// BufferedProducerConfig represents the configuration settings of a buffered producer.
+type BufferedProducerConfig struct {
+	MaxBatchSize      int           // Number of buffered messages triggering a send, at most 10.
+	MaxBatchSizeBytes int           // Buffered message size in bytes triggering a send.
+	Linger            time.Duration // Maximum time a message waits in the buffer before it is sent.
+	BufferSize        int           // Number of messages Put accepts before blocking while the producer is busy.
+	MaxInFlight       int           // Maximum number of batches sent concurrently.
+
+	// DroppedErrorHandler optionally receives the errors dropped because the error channel is full.
+	// It is called from the goroutine sending the batch, so it must not block for long.
+	DroppedErrorHandler func(err *ProducerError)
+}
+
+// NewBufferedProducer creates a producer accepting single messages and sending them in the background,
+// as soon as a full batch is buffered or the linger time of the oldest buffered message elapses.
+// Messages that cannot be sent are reported on the Error channel as *ProducerError. If the channel is full, the error is
+// dropped, counted by DroppedErrors and handed to the DroppedErrorHandler, if any.
+func NewBufferedProducer(q Interface, config BufferedProducerConfig) BufferedProducerInterface {
+	config.setDefaults()
+
+	p := &bufferedProducer{
+		queue:             q,
+		maxBatchSize:      config.MaxBatchSize,
+		maxBatchSizeBytes: config.MaxBatchSizeBytes,
+		linger:            config.Linger,
+
+		entryChannel: make(chan SQSMessageEntry, config.BufferSize),
+		flushChannel: make(chan chan struct{}),
+		stopChannel:  make(chan struct{}),
+		done:         make(chan struct{}),
+		errChannel:   make(chan error, producerErrorChannelSize),
+		limiter:      make(chan struct{}, config.MaxInFlight),
+
+		droppedErrorHandler: config.DroppedErrorHandler,
+	}
+
+	go p.run()
+
+	return p
+}
+
+func (c *BufferedProducerConfig) setDefaults() {
+	if c.MaxBatchSize == 0 {
+		c.MaxBatchSize = 10
+	}
+
+	if c.MaxBatchSizeBytes == 0 {
+		c.MaxBatchSizeBytes = 64 * 1024
+	}
+
+	if c.Linger == 0 {
+		c.Linger = 100 * time.Millisecond
+	}
+
+	if c.BufferSize == 0 {
+		c.BufferSize = 1000
+	}
+
+	if c.MaxInFlight == 0 {
+		c.MaxInFlight = 1
+	}
+}
+
+// Put adds a message to the buffer. It blocks while the buffer is full.
+//
+// Returns:
+// - err: ErrProducerClosed if the producer is closed, nil otherwise.
+func (p *bufferedProducer) Put(entry SQSMessageEntry) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	p.entryChannel <- entry
+
+	return nil
+}
+
+// Error returns the channel reporting the messages that could not be sent. It is closed by Close.
+func (p *bufferedProducer) Error() <-chan error {
+	return p.errChannel
+}
+
+// DroppedErrors returns the number of errors dropped so far because the error channel was full.
+func (p *bufferedProducer) DroppedErrors() int64 {
+	return p.droppedErrors.Load()
+}
+
+// Flush sends every message put before the call and waits until they are sent or reported as failed.
+//
+// Returns:
+// - err: ErrProducerClosed if the producer is closed, the context error if ctx is canceled before the flush
+// is done, nil otherwise. The flush continues in the background when ctx is canceled.
+func (p *bufferedProducer) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case p.flushChannel <- flushed:
+	case <-p.done:
+		return ErrProducerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages, sends every buffered message and closes the error channel.
+// Calling Close more than once only waits for the producer to stop.
+//
+// Returns:
+// - err: The context error if ctx is canceled before the producer stopped, nil otherwise.
+// The producer keeps draining in the background when ctx is canceled.
+func (p *bufferedProducer) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+
+		close(p.stopChannel)
+	})
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run buffers incoming messages and sends them until the producer is closed.
+func (p *bufferedProducer) run() {
+	defer close(p.done)
+	defer close(p.errChannel)
+
+	p.lingerTimer = time.NewTimer(p.linger)
+	p.stopLingerTimer()
+
+	for {
+		select {
+		case e := <-p.entryChannel:
+			p.add(e)
+		case <-p.lingerTimer.C:
+			p.sendBuffer()
+		case flushed := <-p.flushChannel:
+			p.drain()
+			p.sendBuffer()
+			p.wg.Wait()
+			close(flushed)
+		case <-p.stopChannel:
+			// no Put is in progress once closed is set, so the entry channel holds every remaining message.
+			p.drain()
+			p.sendBuffer()
+			p.wg.Wait()
+			return
+		}
+	}
+}
+
+// drain moves the messages waiting in the entry channel to the buffer.
+func (p *bufferedProducer) drain() {
+	for {
+		select {
+		case e := <-p.entryChannel:
+			p.add(e)
+		default:
+			return
+		}
+	}
+}
+
+// add appends a message to the buffer, sending the buffer first if the message would exceed the byte limit
+// and afterwards if it reached the size limit.
+func (p *bufferedProducer) add(e SQSMessageEntry) {
+	if len(p.buffer) > 0 && p.bufferBytes+e.size() > p.maxBatchSizeBytes {
+		p.sendBuffer()
+	}
+
+	if len(p.buffer) == 0 {
+		p.lingerTimer.Reset(p.linger)
+	}
+
+	p.buffer = append(p.buffer, e)
+	p.bufferBytes += e.size()
+
+	if len(p.buffer) >= p.maxBatchSize || p.bufferBytes >= p.maxBatchSizeBytes {
+		p.sendBuffer()
+	}
+}
+
+// sendBuffer sends the buffered messages in the background, waiting while MaxInFlight batches are being sent.
+func (p *bufferedProducer) sendBuffer() {
+	if len(p.buffer) == 0 {
+		return
+	}
+
+	p.stopLingerTimer()
+
+	batch := p.buffer
+	p.buffer = nil
+	p.bufferBytes = 0
+
+	p.limiter <- struct{}{}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.limiter
+			p.wg.Done()
+		}()
+
+		failed, err := p.sendBatch(batch)
+		if err != nil || len(failed) > 0 {
+			p.reportError(&ProducerError{Entries: failed, Err: err})
+		}
+	}()
+}
+
+// sendBatch sends a batch of messages put independently, whose ids may collide. Messages are sent with their index
+// in the batch as id, and the failed messages and the failures of a *BatchError are given back the ids of the callers.
+func (p *bufferedProducer) sendBatch(batch []SQSMessageEntry) ([]SQSMessageEntry, error) {
+	entries := make([]SQSMessageEntry, len(batch))
+	for i, e := range batch {
+		e.Id = aws.String(strconv.Itoa(i))
+		entries[i] = e
+	}
+
+	callerId := func(id string) (*string, bool) {
+		i, err := strconv.Atoi(id)
+		if err != nil || i < 0 || i >= len(batch) {
+			return nil, false
+		}
+
+		return batch[i].Id, true
+	}
+
+	failed, err := p.queue.SendMessageBatchWithContext(context.Background(), entries)
+	for i := range failed {
+		if id, ok := callerId(aws.ToString(failed[i].Id)); ok {
+			failed[i].Id = id
+		}
+	}
+
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		mapped := &BatchError{Failures: make([]EntryFailure, len(batchErr.Failures)), Err: batchErr.Err}
+		for i, f := range batchErr.Failures {
+			if id, ok := callerId(f.Id); ok {
+				f.Id = aws.ToString(id)
+			}
+
+			mapped.Failures[i] = f
+		}
+
+		err = mapped
+	}
+
+	return failed, err
+}
+
+// stopLingerTimer stops the linger timer and discards a pending expiry, so a later Reset starts afresh.
+func (p *bufferedProducer) stopLingerTimer() {
+	if !p.lingerTimer.Stop() {
+		select {
+		case <-p.lingerTimer.C:
+		default:
+		}
+	}
+}
+
+// reportError publishes an error on the error channel. If the channel is full, the error is counted as dropped
+// and handed to the dropped error handler, if any.
+func (p *bufferedProducer) reportError(err *ProducerError) {
+	select {
+	case p.errChannel <- err:
+	default:
+		p.droppedErrors.Add(1)
+		if p.droppedErrorHandler != nil {
+			p.droppedErrorHandler(err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package inssqs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type recordingQueue struct {
+	Interface
+	mu      sync.Mutex
+	batches [][]SQSMessageEntry
+	err     error
+}
+
+func (q *recordingQueue) SendMessageBatchWithContext(_ context.Context, entries []SQSMessageEntry) ([]SQSMessageEntry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.err != nil {
+		return entries, q.err
+	}
+
+	q.batches = append(q.batches, entries)
+
+	return nil, nil
+}
+
+func (q *recordingQueue) sent() [][]SQSMessageEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.batches
+}
+
+func newEntry(i int) SQSMessageEntry {
+	return SQSMessageEntry{Id: aws.String(strconv.Itoa(i)), MessageBody: aws.String("body")}
+}
+
+func TestBufferedProducer(t *testing.T) {
+	t.Run("it_should_send_when_max_batch_size_is_reached", func(t *testing.T) {
+		q := &recordingQueue{}
+		p := NewBufferedProducer(q, BufferedProducerConfig{MaxBatchSize: 3, Linger: time.Hour})
+
+		for i := 0; i < 7; i++ {
+			require.NoError(t, p.Put(newEntry(i)))
+		}
+
+		assert.Eventually(t, func() bool { return len(q.sent()) == 2 }, time.Second, time.Millisecond)
+		require.NoError(t, p.Close(context.Background()))
+
+		batches := q.sent()
+		require.Len(t, batches, 3)
+		assert.Len(t, batches[0], 3)
+		assert.Len(t, batches[1], 3)
+		assert.Len(t, batches[2], 1, "close should send the remaining message")
+	})
+
+	t.Run("it_should_send_before_exceeding_max_batch_size_bytes", func(t *testing.T) {
+		q := &recordingQueue{}
+		p := NewBufferedProducer(q, BufferedProducerConfig{MaxBatchSizeBytes: 10, Linger: time.Hour})
+
+		require.NoError(t, p.Put(SQSMessageEntry{Id: aws.String("1"), MessageBody: aws.String(strings.Repeat("a", 6))}))
+		require.NoError(t, p.Put(SQSMessageEntry{Id: aws.String("2"), MessageBody: aws.String(strings.Repeat("b", 6))}))
+		require.NoError(t, p.Flush(context.Background()))
+
+		batches := q.sent()
+		require.Len(t, batches, 2)
+		assert.Equal(t, "aaaaaa", aws.ToString(batches[0][0].MessageBody))
+		assert.Equal(t, "bbbbbb", aws.ToString(batches[1][0].MessageBody))
+	})
+
+	t.Run("it_should_send_after_linger_time", func(t *testing.T) {
+		q := &recordingQueue{}
+		p := NewBufferedProducer(q, BufferedProducerConfig{Linger: 10 * time.Millisecond})
+		defer p.Close(context.Background())
+
+		require.NoError(t, p.Put(newEntry(1)))
+
+		assert.Eventually(t, func() bool { return len(q.sent()) == 1 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("it_should_send_everything_on_flush_and_keep_accepting", func(t *testing.T) {
+		q := &recordingQueue{}
+		p := NewBufferedProducer(q, BufferedProducerConfig{Linger: time.Hour})
+
+		require.NoError(t, p.Put(newEntry(1)))
+		require.NoError(t, p.Put(newEntry(2)))
+		require.NoError(t, p.Flush(context.Background()))
+		require.Len(t, q.sent(), 1)
+		assert.Len(t, q.sent()[0], 2)
+
+		require.NoError(t, p.Put(newEntry(3)))
+		require.NoError(t, p.Close(context.Background()))
+		assert.Len(t, q.sent(), 2)
+	})
+
+	t.Run("it_should_report_failed_messages_on_error_channel", func(t *testing.T) {
+		q := &recordingQueue{err: assert.AnError}
+		p := NewBufferedProducer(q, BufferedProducerConfig{})
+
+		require.NoError(t, p.Put(newEntry(1)))
+		require.NoError(t, p.Close(context.Background()))
+
+		var errs []error
+		for err := range p.Error() {
+			errs = append(errs, err)
+		}
+
+		require.Len(t, errs, 1)
+		var producerErr *ProducerError
+		require.True(t, errors.As(errs[0], &producerErr))
+		assert.ErrorIs(t, producerErr, assert.AnError)
+		assert.Len(t, producerErr.Entries, 1)
+	})
+
+	t.Run("it_should_count_and_hand_over_errors_dropped_when_the_error_channel_is_full", func(t *testing.T) {
+		q := &recordingQueue{err: assert.AnError}
+		var mu sync.Mutex
+		var dropped []*ProducerError
+		p := NewBufferedProducer(q, BufferedProducerConfig{
+			MaxBatchSize: 1,
+			DroppedErrorHandler: func(err *ProducerError) {
+				mu.Lock()
+				defer mu.Unlock()
+				dropped = append(dropped, err)
+			},
+		})
+
+		for i := 0; i < producerErrorChannelSize+5; i++ {
+			require.NoError(t, p.Put(newEntry(i)))
+		}
+		require.NoError(t, p.Close(context.Background()))
+
+		reported := 0
+		for range p.Error() {
+			reported++
+		}
+
+		assert.Equal(t, producerErrorChannelSize, reported)
+		assert.Equal(t, int64(5), p.DroppedErrors())
+		require.Len(t, dropped, 5)
+		assert.ErrorIs(t, dropped[0], assert.AnError)
+		assert.Len(t, dropped[0].Entries, 1)
+	})
+
+	t.Run("it_should_reject_messages_after_close", func(t *testing.T) {
+		p := NewBufferedProducer(&recordingQueue{}, BufferedProducerConfig{})
+		require.NoError(t, p.Close(context.Background()))
+		require.NoError(t, p.Close(context.Background()), "closing twice should not fail")
+
+		assert.ErrorIs(t, p.Put(newEntry(1)), ErrProducerClosed)
+		assert.ErrorIs(t, p.Flush(context.Background()), ErrProducerClosed)
+	})
+
+	t.Run("it_should_not_lose_messages_put_concurrently", func(t *testing.T) {
+		q := &recordingQueue{}
+		p := NewBufferedProducer(q, BufferedProducerConfig{BufferSize: 5, MaxInFlight: 4})
+
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					_ = p.Put(newEntry(w*50 + i))
+				}
+			}(w)
+		}
+
+		wg.Wait()
+		require.NoError(t, p.Close(context.Background()))
+
+		total := 0
+		for _, b := range q.sent() {
+			assert.LessOrEqual(t, len(b), 10)
+			total += len(b)
+		}
+
+		assert.Equal(t, 400, total)
+	})
+
+	t.Run("it_should_send_messages_put_with_the_same_id_and_report_them_with_their_id", func(t *testing.T) {
+		sqsQueue, client := newQueue(t)
+		sqsQueue.maxBatchSize = 10
+		sqsQueue.maxBatchSizeBytes = 64 * 1024
+		sqsQueue.workers = 1
+		sqsQueue.retryCount = 0
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				require.Len(t, in.Entries, 2)
+				assert.NotEqual(t, aws.ToString(in.Entries[0].Id), aws.ToString(in.Entries[1].Id), "ids should be distinct")
+
+				return &awssqs.SendMessageBatchOutput{Failed: []types.BatchResultErrorEntry{
+					{Id: in.Entries[1].Id, Code: aws.String("InvalidMessageContents"), SenderFault: true},
+				}}, nil
+			})
+
+		p := NewBufferedProducer(&sqsQueue, BufferedProducerConfig{})
+		require.NoError(t, p.Put(SQSMessageEntry{Id: aws.String("1"), MessageBody: aws.String("first")}))
+		require.NoError(t, p.Put(SQSMessageEntry{Id: aws.String("1"), MessageBody: aws.String("second")}))
+		require.NoError(t, p.Close(context.Background()))
+
+		err := <-p.Error()
+		var producerErr *ProducerError
+		require.True(t, errors.As(err, &producerErr))
+		require.Len(t, producerErr.Entries, 1)
+		assert.Equal(t, "1", aws.ToString(producerErr.Entries[0].Id))
+		assert.Equal(t, "second", aws.ToString(producerErr.Entries[0].MessageBody))
+
+		var batchErr *BatchError
+		require.True(t, errors.As(err, &batchErr))
+		require.Len(t, batchErr.Failures, 1)
+		assert.Equal(t, "1", batchErr.Failures[0].Id)
+		assert.Equal(t, "InvalidMessageContents", batchErr.Failures[0].Code)
+	})
+}
@@ -0,0 +1,130 @@
+package inssqs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"io"
+)
+
+// Codec converts values of T to message bodies and back.
+type Codec[T any] interface {
+	Encode(v T) (string, error)
+	Decode(body string) (T, error)
+}
+
+type jsonCodec[T any] struct{}
+
+// JSONCodec creates a Codec encoding values as JSON.
+func JSONCodec[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+func (jsonCodec[T]) Encode(v T) (string, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "error while encoding json")
+	}
+
+	return string(js), nil
+}
+
+func (jsonCodec[T]) Decode(body string) (T, error) {
+	var v T
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return v, errors.Wrap(err, "error while decoding json")
+	}
+
+	return v, nil
+}
+
+type protobufCodec[T proto.Message] struct{}
+
+// ProtobufCodec creates a Codec encoding protobuf messages in their binary wire format.
+// The encoded message is base64 encoded, since SQS only accepts text bodies.
+func ProtobufCodec[T proto.Message]() Codec[T] {
+	return protobufCodec[T]{}
+}
+
+func (protobufCodec[T]) Encode(v T) (string, error) {
+	b, err := proto.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "error while encoding protobuf")
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (protobufCodec[T]) Decode(body string) (T, error) {
+	var zero T
+
+	b, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return zero, errors.Wrap(err, "error while decoding base64")
+	}
+
+	// generated messages support ProtoReflect on nil pointers, which gives access to their type.
+	v, ok := zero.ProtoReflect().Type().New().Interface().(T)
+	if !ok {
+		return zero, errors.Errorf("unexpected protobuf message type %T", zero)
+	}
+
+	if err = proto.Unmarshal(b, v); err != nil {
+		return zero, errors.Wrap(err, "error while decoding protobuf")
+	}
+
+	return v, nil
+}
+
+type gzipCodec[T any] struct {
+	inner Codec[T]
+}
+
+// GzipCodec wraps a Codec, compressing its output with gzip and encoding the result as base64.
+func GzipCodec[T any](inner Codec[T]) Codec[T] {
+	return gzipCodec[T]{inner: inner}
+}
+
+func (c gzipCodec[T]) Encode(v T) (string, error) {
+	body, err := c.inner.Encode(v)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err = zw.Write([]byte(body)); err != nil {
+		return "", errors.Wrap(err, "error while compressing body")
+	}
+
+	if err = zw.Close(); err != nil {
+		return "", errors.Wrap(err, "error while compressing body")
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func (c gzipCodec[T]) Decode(body string) (T, error) {
+	var zero T
+
+	b, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return zero, errors.Wrap(err, "error while decoding base64")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return zero, errors.Wrap(err, "error while decompressing body")
+	}
+	defer zr.Close()
+
+	decompressed, err := io.ReadAll(zr)
+	if err != nil {
+		return zero, errors.Wrap(err, "error while decompressing body")
+	}
+
+	return c.inner.Decode(string(decompressed))
+}
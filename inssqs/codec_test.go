@@ -0,0 +1,79 @@
+package inssqs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecTestPayload struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestJSONCodec(t *testing.T) {
+	t.Run("it_should_round_trip_values", func(t *testing.T) {
+		codec := JSONCodec[codecTestPayload]()
+
+		body, err := codec.Encode(codecTestPayload{Name: "a", Count: 1})
+		require.NoError(t, err)
+		assert.Equal(t, `{"name":"a","count":1}`, body)
+
+		v, err := codec.Decode(body)
+		require.NoError(t, err)
+		assert.Equal(t, codecTestPayload{Name: "a", Count: 1}, v)
+	})
+
+	t.Run("it_should_fail_on_invalid_body", func(t *testing.T) {
+		_, err := JSONCodec[codecTestPayload]().Decode("not json")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("it_should_fail_on_unsupported_values", func(t *testing.T) {
+		_, err := JSONCodec[func()]().Encode(func() {})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestProtobufCodec(t *testing.T) {
+	t.Run("it_should_round_trip_messages", func(t *testing.T) {
+		codec := ProtobufCodec[*wrapperspb.StringValue]()
+
+		body, err := codec.Encode(wrapperspb.String("hello"))
+		require.NoError(t, err)
+
+		v, err := codec.Decode(body)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", v.GetValue())
+	})
+
+	t.Run("it_should_fail_on_invalid_base64", func(t *testing.T) {
+		_, err := ProtobufCodec[*wrapperspb.StringValue]().Decode("%%%")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestGzipCodec(t *testing.T) {
+	t.Run("it_should_round_trip_through_the_inner_codec", func(t *testing.T) {
+		codec := GzipCodec(JSONCodec[codecTestPayload]())
+
+		body, err := codec.Encode(codecTestPayload{Name: "compressed", Count: 3})
+		require.NoError(t, err)
+		assert.NotContains(t, body, "compressed")
+
+		v, err := codec.Decode(body)
+		require.NoError(t, err)
+		assert.Equal(t, codecTestPayload{Name: "compressed", Count: 3}, v)
+	})
+
+	t.Run("it_should_fail_on_uncompressed_body", func(t *testing.T) {
+		_, err := GzipCodec(JSONCodec[codecTestPayload]()).Decode("aGVsbG8=")
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,310 @@
+package inssqs
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/pkg/errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// receiveErrorWaitTime is the time the consumer waits before polling again after a failed ReceiveMessage call.
+const receiveErrorWaitTime = time.Second
+
+// maxDeleteBatchSize is the maximum number of entries SQS accepts in a single DeleteMessageBatch call.
+const maxDeleteBatchSize = 10
+
+// MessageHandler processes a single received message.
+// Returning nil marks the message as processed and schedules it for deletion,
+// returning an error leaves it on the queue to be redelivered after its visibility timeout.
+type MessageHandler func(ctx context.Context, message SQSMessage) error
+
+// ConsumerInterface defines the interface for a long-polling SQS consumer.
+type ConsumerInterface interface {
+	Start(ctx context.Context) error
+}
+
+type consumer struct {
+	queue   *queue
+	handler MessageHandler
+
+	waitTimeSeconds     int32
+	maxNumberOfMessages int32
+	visibilityTimeout   int32
+	workers             int
+	deleteFlushInterval time.Duration
+	heartbeatInterval   time.Duration
+}
+
+// ConsumerConfig represents the configuration settings required for consuming messages from an SQS queue.
+type ConsumerConfig struct {
+	WaitTimeSeconds     int32         // Long-polling wait time of each ReceiveMessage call, at most 20 seconds.
+	MaxNumberOfMessages int32         // Maximum number of messages returned by each ReceiveMessage call, at most 10.
+	VisibilityTimeout   int32         // Visibility timeout in seconds applied to received messages, queue default if zero.
+	MaxWorkers          int           // Maximum number of handlers running concurrently.
+	DeleteFlushInterval time.Duration // Maximum time a processed message waits before its deletion batch is sent.
+	HeartbeatInterval   time.Duration // Interval at which the visibility of in-flight messages is extended, disabled if zero.
+}
+
+// NewConsumer creates a consumer that long-polls the given queue and dispatches each message to the handler.
+// The queue must be created with New or NewSQS.
+func NewConsumer(q Interface, config ConsumerConfig, handler MessageHandler) (ConsumerInterface, error) {
+	impl, ok := q.(*queue)
+	if !ok {
+		return nil, ErrUnsupportedQueue
+	}
+
+	if handler == nil {
+		return nil, ErrHandlerNotSet
+	}
+
+	config.setDefaults()
+
+	// every heartbeat extends the visibility by VisibilityTimeout, so it must outlast the interval between heartbeats.
+	if config.HeartbeatInterval > 0 && time.Duration(config.VisibilityTimeout)*time.Second <= config.HeartbeatInterval {
+		return nil, ErrVisibilityTimeoutTooShort
+	}
+
+	return &consumer{
+		queue:               impl,
+		handler:             handler,
+		waitTimeSeconds:     config.WaitTimeSeconds,
+		maxNumberOfMessages: config.MaxNumberOfMessages,
+		visibilityTimeout:   config.VisibilityTimeout,
+		workers:             config.MaxWorkers,
+		deleteFlushInterval: config.DeleteFlushInterval,
+		heartbeatInterval:   config.HeartbeatInterval,
+	}, nil
+}
+
+func (c *ConsumerConfig) setDefaults() {
+	if c.WaitTimeSeconds == 0 {
+		c.WaitTimeSeconds = 20
+	}
+
+	if c.MaxNumberOfMessages == 0 {
+		c.MaxNumberOfMessages = 10
+	}
+
+	if c.MaxWorkers == 0 {
+		c.MaxWorkers = 1
+	}
+
+	if c.DeleteFlushInterval == 0 {
+		c.DeleteFlushInterval = time.Second
+	}
+
+	if c.HeartbeatInterval > 0 && c.VisibilityTimeout == 0 {
+		c.VisibilityTimeout = int32(math.Ceil((2 * c.HeartbeatInterval).Seconds()))
+	}
+}
+
+// Start polls the queue and dispatches received messages to the handler until the context is canceled.
+//
+// Cancelling the context stops polling only; messages that were already received are still handled,
+// and the receipt handles of successfully processed messages are deleted before Start returns.
+// The offloaded payloads of deleted messages are then deleted from the payload store.
+// Handlers receive a context carrying the values of ctx that is not canceled along with it.
+// Bodies offloaded to the payload store of the queue are resolved before the handler is called,
+// and the trace context propagated in the message attributes is extracted into the handler context.
+// If a heartbeat interval is configured, the visibility of messages is extended until their handler returns.
+//
+// Returns:
+// - err: An error if the queue url cannot be resolved, nil after a graceful shutdown.
+func (c *consumer) Start(ctx context.Context) error {
+	url, err := c.queue.getQueueUrl(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error while getting queue url")
+	}
+
+	messages := make(chan receivedMessage)
+	processed := make(chan SQSMessage, maxDeleteBatchSize)
+	handlerCtx := detachedContext{parent: ctx}
+
+	var hb *heartbeat
+	if c.heartbeatInterval > 0 {
+		hb = newHeartbeat(c.queue, c.heartbeatInterval, c.visibilityTimeout)
+		hb.start()
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range messages {
+				if c.process(handlerCtx, m) {
+					processed <- m.message
+				}
+			}
+		}()
+	}
+
+	deleterDone := make(chan struct{})
+	go func() {
+		defer close(deleterDone)
+		c.deleteProcessed(processed)
+	}()
+
+	c.poll(ctx, url, hb, messages)
+
+	close(messages)
+	wg.Wait()
+	if hb != nil {
+		hb.stop()
+	}
+	close(processed)
+	<-deleterDone
+
+	return nil
+}
+
+// receivedMessage is a message waiting for or being handled by a worker, with the function untracking it from the
+// heartbeat once it is handled.
+type receivedMessage struct {
+	message SQSMessage
+	untrack func()
+}
+
+// poll receives messages until the context is canceled and hands them over to the workers.
+// Messages are tracked by the heartbeat, if any, as soon as they are received,
+// so that messages waiting for a free worker are extended too.
+func (c *consumer) poll(ctx context.Context, url *string, hb *heartbeat, messages chan<- receivedMessage) {
+	for ctx.Err() == nil {
+		res, err := c.queue.client.ReceiveMessage(ctx, &awssqs.ReceiveMessageInput{
+			QueueUrl:              url,
+			MaxNumberOfMessages:   c.maxNumberOfMessages,
+			WaitTimeSeconds:       c.waitTimeSeconds,
+			VisibilityTimeout:     c.visibilityTimeout,
+			AttributeNames:        []types.QueueAttributeName{types.QueueAttributeNameAll},
+			MessageAttributeNames: []string{"All"},
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			c.queue.logger.Errorf("Error receiving messages from SQS: %v\n", err)
+			sleepWithContext(ctx, receiveErrorWaitTime)
+			continue
+		}
+
+		for _, m := range res.Messages {
+			received := receivedMessage{message: newSQSMessage(m), untrack: func() {}}
+			if hb != nil {
+				received.untrack = hb.track(received.message)
+			}
+
+			messages <- received
+		}
+	}
+}
+
+// process handles a single message and untracks it from the heartbeat, if any, once the handler returns.
+// Pointer messages are resolved to their offloaded payload before being handed to the handler.
+func (c *consumer) process(ctx context.Context, received receivedMessage) bool {
+	defer received.untrack()
+
+	m, err := c.queue.resolvePayload(ctx, received.message)
+	if err != nil {
+		c.queue.logger.Errorf("Error resolving payload of SQS message %s: %v\n", aws.ToString(m.MessageId), err)
+		return false
+	}
+
+	return c.handle(extractTraceContext(ctx, m), m)
+}
+
+// handle runs the handler for a single message and reports whether it was processed successfully.
+func (c *consumer) handle(ctx context.Context, m SQSMessage) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.queue.logger.Errorf("Panic while handling SQS message %s: %v\n", aws.ToString(m.MessageId), r)
+			ok = false
+		}
+	}()
+
+	if err := c.handler(ctx, m); err != nil {
+		c.queue.logger.Errorf("Error handling SQS message %s: %v\n", aws.ToString(m.MessageId), err)
+		return false
+	}
+
+	return true
+}
+
+// deleteProcessed accumulates processed messages and deletes them in batches, flushing whenever a batch is full
+// or the flush interval elapses, until the channel is closed. The payloads of deleted pointer messages are deleted too.
+func (c *consumer) deleteProcessed(processed <-chan SQSMessage) {
+	ticker := time.NewTicker(c.deleteFlushInterval)
+	defer ticker.Stop()
+
+	pending := make([]SQSMessage, 0, maxDeleteBatchSize)
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+
+		entries := make([]SQSDeleteMessageEntry, len(pending))
+		for i, m := range pending {
+			entries[i] = m.toDeleteMessageEntry()
+		}
+
+		// failures are logged by DeleteMessageBatch, the messages will be redelivered after their visibility timeout,
+		// so their payloads are kept.
+		failed, _ := c.queue.DeleteMessageBatch(entries)
+		c.queue.deletePayloads(context.Background(), pending, failed)
+		pending = make([]SQSMessage, 0, maxDeleteBatchSize)
+	}
+
+	for {
+		select {
+		case m, ok := <-processed:
+			if !ok {
+				flush()
+				return
+			}
+
+			pending = append(pending, m)
+			if len(pending) >= maxDeleteBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// sleepWithContext pauses for the given duration or until the context is canceled, whichever comes first.
+func sleepWithContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// detachedContext carries the values of its parent but is never canceled,
+// so in-flight handlers can finish while the consumer is shutting down.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key any) any {
+	return c.parent.Value(key)
+}
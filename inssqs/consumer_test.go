@@ -0,0 +1,228 @@
+package inssqs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/useinsider/go-pkg/inssqs/sqs"
+	"go.uber.org/mock/gomock"
+)
+
+func newConsumerQueue(t *testing.T) (*queue, *sqs.MockAPI) {
+	q, client := newQueue(t)
+	q.url = aws.String("test-queue-url")
+	q.maxBatchSize = 10
+	q.maxBatchSizeBytes = 64 * 1024
+	q.workers = 1
+
+	return &q, client
+}
+
+// expectReceive returns the given messages on the first ReceiveMessage call,
+// and blocks subsequent calls until the context is canceled.
+func expectReceive(client *sqs.MockAPI, messages ...types.Message) {
+	first := true
+	var mu sync.Mutex
+
+	client.EXPECT().
+		ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ *awssqs.ReceiveMessageInput, _ ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error) {
+			mu.Lock()
+			isFirst := first
+			first = false
+			mu.Unlock()
+
+			if isFirst {
+				return &awssqs.ReceiveMessageOutput{Messages: messages}, nil
+			}
+
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}).
+		AnyTimes()
+}
+
+// recordDeletes captures the receipt handles of every DeleteMessageBatch call.
+func recordDeletes(client *sqs.MockAPI) func() []string {
+	var mu sync.Mutex
+	var handles []string
+
+	client.EXPECT().
+		DeleteMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, in *awssqs.DeleteMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.DeleteMessageBatchOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, e := range in.Entries {
+				handles = append(handles, aws.ToString(e.ReceiptHandle))
+			}
+
+			return &awssqs.DeleteMessageBatchOutput{}, nil
+		}).
+		AnyTimes()
+
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), handles...)
+	}
+}
+
+func newMessage(id string) types.Message {
+	return types.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String("rh-" + id),
+		Body:          aws.String("body-" + id),
+	}
+}
+
+func TestNewConsumer(t *testing.T) {
+	t.Run("it_should_reject_queues_not_created_with_new_sqs", func(t *testing.T) {
+		c, err := NewConsumer(&FakeQueue{}, ConsumerConfig{}, func(context.Context, SQSMessage) error { return nil })
+
+		assert.ErrorIs(t, err, ErrUnsupportedQueue)
+		assert.Nil(t, c)
+	})
+
+	t.Run("it_should_reject_nil_handler", func(t *testing.T) {
+		q, _ := newConsumerQueue(t)
+
+		c, err := NewConsumer(q, ConsumerConfig{}, nil)
+
+		assert.ErrorIs(t, err, ErrHandlerNotSet)
+		assert.Nil(t, c)
+	})
+
+	t.Run("it_should_reject_visibility_timeout_not_longer_than_heartbeat_interval", func(t *testing.T) {
+		q, _ := newConsumerQueue(t)
+		config := ConsumerConfig{VisibilityTimeout: 10, HeartbeatInterval: 10 * time.Second}
+
+		c, err := NewConsumer(q, config, func(context.Context, SQSMessage) error { return nil })
+
+		assert.ErrorIs(t, err, ErrVisibilityTimeoutTooShort)
+		assert.Nil(t, c)
+	})
+
+	t.Run("it_should_default_visibility_timeout_to_twice_the_heartbeat_interval", func(t *testing.T) {
+		q, _ := newConsumerQueue(t)
+
+		c, err := NewConsumer(q, ConsumerConfig{HeartbeatInterval: 1500 * time.Millisecond}, func(context.Context, SQSMessage) error {
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), c.(*consumer).visibilityTimeout)
+	})
+
+	t.Run("it_should_fill_defaults", func(t *testing.T) {
+		q, _ := newConsumerQueue(t)
+
+		c, err := NewConsumer(q, ConsumerConfig{}, func(context.Context, SQSMessage) error { return nil })
+
+		require.NoError(t, err)
+		impl := c.(*consumer)
+		assert.Equal(t, int32(20), impl.waitTimeSeconds)
+		assert.Equal(t, int32(10), impl.maxNumberOfMessages)
+		assert.Equal(t, 1, impl.workers)
+		assert.Equal(t, time.Second, impl.deleteFlushInterval)
+	})
+}
+
+func TestConsumer_Start(t *testing.T) {
+	t.Run("it_should_delete_only_successfully_handled_messages", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		expectReceive(client, newMessage("1"), newMessage("2"), newMessage("3"))
+		deleted := recordDeletes(client)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		handled := sync.WaitGroup{}
+		handled.Add(3)
+
+		c, err := NewConsumer(q, ConsumerConfig{MaxWorkers: 3}, func(_ context.Context, m SQSMessage) error {
+			defer handled.Done()
+			if aws.ToString(m.MessageId) == "2" {
+				return assert.AnError
+			}
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		go func() {
+			handled.Wait()
+			cancel()
+		}()
+
+		require.NoError(t, c.Start(ctx))
+		assert.ElementsMatch(t, []string{"rh-1", "rh-3"}, deleted())
+	})
+
+	t.Run("it_should_finish_in_flight_handlers_before_returning", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		expectReceive(client, newMessage("1"))
+		deleted := recordDeletes(client)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+		var handlerErr error
+
+		c, err := NewConsumer(q, ConsumerConfig{}, func(hctx context.Context, _ SQSMessage) error {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			handlerErr = hctx.Err()
+			return nil
+		})
+		require.NoError(t, err)
+
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		require.NoError(t, c.Start(ctx))
+		assert.NoError(t, handlerErr, "handler context should not be canceled with the consumer")
+		assert.Equal(t, []string{"rh-1"}, deleted())
+	})
+
+	t.Run("it_should_recover_from_handler_panics", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		expectReceive(client, newMessage("1"))
+		client.EXPECT().DeleteMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		c, err := NewConsumer(q, ConsumerConfig{}, func(context.Context, SQSMessage) error {
+			defer cancel()
+			panic("boom")
+		})
+		require.NoError(t, err)
+
+		assert.NoError(t, c.Start(ctx))
+	})
+
+	t.Run("it_should_keep_polling_after_receive_errors", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		client.EXPECT().
+			ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, assert.AnError)
+		client.EXPECT().
+			ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(context.Context, *awssqs.ReceiveMessageInput, ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error) {
+				cancel()
+				return &awssqs.ReceiveMessageOutput{}, nil
+			})
+
+		c, err := NewConsumer(q, ConsumerConfig{}, func(context.Context, SQSMessage) error { return nil })
+		require.NoError(t, err)
+
+		assert.NoError(t, c.Start(ctx))
+	})
+}
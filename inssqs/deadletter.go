@@ -0,0 +1,145 @@
+package inssqs
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"os"
+	"sync"
+)
+
+// DeadLetterErrorCodeAttribute is the message attribute holding the last AWS error code
+// of entries routed to a dead-letter queue.
+const DeadLetterErrorCodeAttribute = "inssqs.ErrorCode"
+
+// DeadLetterEntry is an entry that could not be sent after all retry attempts.
+type DeadLetterEntry struct {
+	Entry        SQSMessageEntry
+	ErrorCode    string // AWS error code of the last failure, empty if unknown.
+	ErrorMessage string // AWS error message of the last failure.
+}
+
+// DeadLetterSink receives the entries that could not be sent after all retry attempts.
+type DeadLetterSink interface {
+	Send(ctx context.Context, entries []DeadLetterEntry) error
+}
+
+// DeadLetterFunc is an adapter allowing the use of an ordinary function as a DeadLetterSink.
+type DeadLetterFunc func(ctx context.Context, entries []DeadLetterEntry) error
+
+func (f DeadLetterFunc) Send(ctx context.Context, entries []DeadLetterEntry) error {
+	return f(ctx, entries)
+}
+
+type queueDeadLetterSink struct {
+	queue Interface
+}
+
+// NewQueueDeadLetterSink creates a DeadLetterSink sending the entries to another queue.
+// The last error code is added to each entry as a message attribute if the entry has room for one more attribute.
+func NewQueueDeadLetterSink(q Interface) DeadLetterSink {
+	return &queueDeadLetterSink{queue: q}
+}
+
+func (s *queueDeadLetterSink) Send(ctx context.Context, entries []DeadLetterEntry) error {
+	messages := make([]SQSMessageEntry, len(entries))
+	for i, e := range entries {
+		messages[i] = e.Entry
+		if e.ErrorCode == "" || len(e.Entry.MessageAttributes) >= maxMessageAttributes {
+			continue
+		}
+
+		attributes := make(map[string]SQSMessageAttribute, len(e.Entry.MessageAttributes)+1)
+		for k, a := range e.Entry.MessageAttributes {
+			attributes[k] = a
+		}
+		attributes[DeadLetterErrorCodeAttribute] = StringAttribute(e.ErrorCode)
+		messages[i].MessageAttributes = attributes
+	}
+
+	_, err := s.queue.SendMessageBatchWithContext(ctx, messages)
+
+	return err
+}
+
+type fileDeadLetterSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+// spooledEntry is the JSON line written by the file dead-letter sink for each entry.
+type spooledEntry struct {
+	Id                     string                         `json:"id"`
+	MessageBody            string                         `json:"messageBody"`
+	DelaySeconds           int32                          `json:"delaySeconds,omitempty"`
+	MessageDeduplicationId string                         `json:"messageDeduplicationId,omitempty"`
+	MessageGroupId         string                         `json:"messageGroupId,omitempty"`
+	MessageAttributes      map[string]SQSMessageAttribute `json:"messageAttributes,omitempty"`
+	ErrorCode              string                         `json:"errorCode,omitempty"`
+	ErrorMessage           string                         `json:"errorMessage,omitempty"`
+}
+
+// NewFileDeadLetterSink creates a DeadLetterSink appending each entry as a JSON line to the file at the given path.
+func NewFileDeadLetterSink(path string) DeadLetterSink {
+	return &fileDeadLetterSink{path: path}
+}
+
+func (s *fileDeadLetterSink) Send(_ context.Context, entries []DeadLetterEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		err = enc.Encode(spooledEntry{
+			Id:                     aws.ToString(e.Entry.Id),
+			MessageBody:            aws.ToString(e.Entry.MessageBody),
+			DelaySeconds:           e.Entry.DelaySeconds,
+			MessageDeduplicationId: aws.ToString(e.Entry.MessageDeduplicationId),
+			MessageGroupId:         aws.ToString(e.Entry.MessageGroupId),
+			MessageAttributes:      e.Entry.MessageAttributes,
+			ErrorCode:              e.ErrorCode,
+			ErrorMessage:           e.ErrorMessage,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// routeToDeadLetterSink hands the failed entries that exhausted their retry attempts or were rejected because of
+// a sender fault to the dead-letter sink, together with their last recorded failure.
+func (q *queue) routeToDeadLetterSink(ctx context.Context, failedEntries []SQSMessageEntry, failures *batchFailures) {
+	if q.deadLetterSink == nil {
+		return
+	}
+
+	entries := make([]DeadLetterEntry, 0, len(failedEntries))
+	for _, e := range failedEntries {
+		f, ok := failures.get(aws.ToString(e.Id))
+		if !ok || !(f.RetriesExhausted || f.SenderFault) {
+			continue
+		}
+
+		entries = append(entries, DeadLetterEntry{
+			Entry:        e,
+			ErrorCode:    f.Code,
+			ErrorMessage: f.Message,
+		})
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	if err := q.deadLetterSink.Send(ctx, entries); err != nil {
+		q.logger.Errorf("Error routing %d messages to dead-letter sink: %v\n", len(entries), err)
+	}
+}
@@ -0,0 +1,132 @@
+package inssqs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func collectDeadLetters(q *queue) *[]DeadLetterEntry {
+	var collected []DeadLetterEntry
+	q.deadLetterSink = DeadLetterFunc(func(_ context.Context, entries []DeadLetterEntry) error {
+		collected = append(collected, entries...)
+		return nil
+	})
+
+	return &collected
+}
+
+func TestQueue_SendMessageBatch_withDeadLetterSink(t *testing.T) {
+	t.Run("it_should_route_exhausted_entries_with_their_last_error_code", func(t *testing.T) {
+		q, client := newQueue(t)
+		collected := collectDeadLetters(&q)
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(4).
+			Return(&awssqs.SendMessageBatchOutput{
+				Failed: []types.BatchResultErrorEntry{
+					{Id: aws.String("test-id"), Code: aws.String("InternalError"), Message: aws.String("try again")},
+				},
+			}, nil)
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{{Id: aws.String("test-id")}})
+
+		assert.ErrorIs(t, err, ErrRetryCountExceeded)
+		assert.Len(t, failed, 1, "routed entries should still be reported as failed")
+		require.Len(t, *collected, 1)
+		assert.Equal(t, "test-id", aws.ToString((*collected)[0].Entry.Id))
+		assert.Equal(t, "InternalError", (*collected)[0].ErrorCode)
+		assert.Equal(t, "try again", (*collected)[0].ErrorMessage)
+	})
+
+	t.Run("it_should_use_the_api_error_code_when_the_request_fails", func(t *testing.T) {
+		q, client := newQueue(t)
+		collected := collectDeadLetters(&q)
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(4).
+			Return(nil, &smithy.GenericAPIError{Code: "ThrottlingException", Message: "slow down"})
+
+		_, err := q.SendMessageBatch([]SQSMessageEntry{{Id: aws.String("test-id")}})
+
+		assert.Error(t, err)
+		require.Len(t, *collected, 1)
+		assert.Equal(t, "ThrottlingException", (*collected)[0].ErrorCode)
+	})
+
+	t.Run("it_should_not_route_entries_that_were_not_attempted", func(t *testing.T) {
+		q, client := newQueue(t)
+		collected := collectDeadLetters(&q)
+		client.EXPECT().SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := q.SendMessageBatchWithContext(ctx, []SQSMessageEntry{{Id: aws.String("test-id")}})
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Empty(t, *collected)
+	})
+}
+
+func TestQueueDeadLetterSink_Send(t *testing.T) {
+	t.Run("it_should_send_entries_with_the_error_code_attribute", func(t *testing.T) {
+		dlq := &FakeQueue{}
+		attributes := map[string]SQSMessageAttribute{"tenant": StringAttribute("acme")}
+
+		err := NewQueueDeadLetterSink(dlq).Send(context.Background(), []DeadLetterEntry{
+			{Entry: SQSMessageEntry{Id: aws.String("1"), MessageAttributes: attributes}, ErrorCode: "InternalError"},
+			{Entry: SQSMessageEntry{Id: aws.String("2")}},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, dlq.Data, 2)
+		assert.Equal(t, "InternalError", aws.ToString(dlq.Data[0].MessageAttributes[DeadLetterErrorCodeAttribute].StringValue))
+		assert.Equal(t, "acme", aws.ToString(dlq.Data[0].MessageAttributes["tenant"].StringValue))
+		assert.NotContains(t, attributes, DeadLetterErrorCodeAttribute, "caller attributes should not be modified")
+		assert.Nil(t, dlq.Data[1].MessageAttributes)
+	})
+}
+
+func TestFileDeadLetterSink_Send(t *testing.T) {
+	t.Run("it_should_append_entries_as_json_lines", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+		sink := NewFileDeadLetterSink(path)
+
+		require.NoError(t, sink.Send(context.Background(), []DeadLetterEntry{
+			{Entry: SQSMessageEntry{Id: aws.String("1"), MessageBody: aws.String("a")}, ErrorCode: "InternalError"},
+		}))
+		require.NoError(t, sink.Send(context.Background(), []DeadLetterEntry{
+			{Entry: SQSMessageEntry{Id: aws.String("2"), MessageBody: aws.String("b")}},
+		}))
+
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+
+		var lines []spooledEntry
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var e spooledEntry
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+			lines = append(lines, e)
+		}
+
+		require.Len(t, lines, 2)
+		assert.Equal(t, spooledEntry{Id: "1", MessageBody: "a", ErrorCode: "InternalError"}, lines[0])
+		assert.Equal(t, spooledEntry{Id: "2", MessageBody: "b"}, lines[1])
+	})
+}
@@ -0,0 +1,115 @@
+package inssqs
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/useinsider/go-pkg/inssqs/sqs"
+)
+
+func TestQueue_withEmulator(t *testing.T) {
+	t.Run("it_should_consume_sent_messages_and_delete_them", func(t *testing.T) {
+		e := sqs.NewEmulator()
+		e.CreateQueue("queue", sqs.QueueConfig{})
+
+		q, err := New(Config{QueueName: "queue"}, WithClient(e))
+		require.NoError(t, err)
+
+		entries := make([]SQSMessageEntry, 25)
+		for i := range entries {
+			entries[i] = SQSMessageEntry{Id: aws.String(strconv.Itoa(i)), MessageBody: aws.String("message-" + strconv.Itoa(i))}
+		}
+
+		failed, err := q.SendMessageBatch(entries)
+		require.NoError(t, err)
+		require.Empty(t, failed)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var mu sync.Mutex
+		received := make(map[string]bool)
+
+		c, err := NewConsumer(q, ConsumerConfig{WaitTimeSeconds: 1, DeleteFlushInterval: 1}, func(_ context.Context, m SQSMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			received[aws.ToString(m.Body)] = true
+			if len(received) == len(entries) {
+				cancel()
+			}
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, c.Start(ctx))
+		assert.Len(t, received, len(entries))
+		assert.Empty(t, e.Bodies("queue"), "processed messages should be deleted")
+	})
+
+	t.Run("it_should_retry_injected_partial_failures", func(t *testing.T) {
+		e := sqs.NewEmulator()
+		e.CreateQueue("queue", sqs.QueueConfig{})
+
+		var mu sync.Mutex
+		attempts := 0
+		e.InjectFailures(func(operation string, entryId string) *types.BatchResultErrorEntry {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if entryId == "1" && attempts == 0 {
+				attempts++
+				return &types.BatchResultErrorEntry{Code: aws.String("InternalError")}
+			}
+
+			return nil
+		})
+
+		q, err := New(Config{QueueName: "queue"}, WithClient(e))
+		require.NoError(t, err)
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			{Id: aws.String("0"), MessageBody: aws.String("a")},
+			{Id: aws.String("1"), MessageBody: aws.String("b")},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+		assert.Equal(t, []string{"a", "b"}, e.Bodies("queue"))
+	})
+
+	t.Run("it_should_keep_the_order_of_a_fifo_group_when_a_message_is_retried", func(t *testing.T) {
+		e := sqs.NewEmulator()
+		e.CreateQueue("orders.fifo", sqs.QueueConfig{ContentBasedDeduplication: true})
+
+		var mu sync.Mutex
+		attempts := 0
+		e.InjectFailures(func(operation string, entryId string) *types.BatchResultErrorEntry {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if entryId == "a2" && attempts == 0 {
+				attempts++
+				return &types.BatchResultErrorEntry{Code: aws.String("InternalError")}
+			}
+
+			return nil
+		})
+
+		q, err := New(Config{QueueName: "orders.fifo"}, WithClient(e))
+		require.NoError(t, err)
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			newFIFOEntry("a1", "a"), newFIFOEntry("a2", "a"), newFIFOEntry("a3", "a"),
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+		assert.Equal(t, []string{"body-a1", "body-a2", "body-a3"}, e.Bodies("orders.fifo"))
+	})
+}
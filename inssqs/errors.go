@@ -5,3 +5,12 @@ import "github.com/pkg/errors"
 var ErrRetryCountExceeded = errors.New("retry count exceeded")
 var ErrRegionNotSet = errors.New("region not set")
 var ErrQueueNameNotSet = errors.New("queue name not set")
+var ErrHandlerNotSet = errors.New("handler not set")
+var ErrVisibilityTimeoutTooShort = errors.New("visibility timeout must be longer than the heartbeat interval")
+var ErrUnsupportedQueue = errors.New("queue must be created with New or NewSQS")
+var ErrPayloadNotFound = errors.New("payload not found")
+var ErrInvalidPayloadKey = errors.New("invalid payload key")
+var ErrAttributeLimitExceeded = errors.New("message attribute limit exceeded")
+var ErrSenderFault = errors.New("entry rejected because of a sender fault")
+var ErrRetryDeadlineExceeded = errors.New("retry deadline exceeded")
+var ErrProducerClosed = errors.New("producer closed")
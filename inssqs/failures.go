@@ -0,0 +1,199 @@
+package inssqs
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// EntryFailure describes the last failure of an entry of a batch operation.
+type EntryFailure struct {
+	Id               string
+	Code             string // AWS error code of the last failure, empty if unknown.
+	Message          string // AWS error message of the last failure.
+	SenderFault      bool   // Whether the entry itself caused the failure, such entries are not retried.
+	Attempts         int    // Number of attempts made for the entry.
+	RetriesExhausted bool   // Whether the entry ran out of retry attempts.
+}
+
+// BatchError is returned by batch operations when some of the entries failed.
+// It matches ErrRetryCountExceeded if an entry ran out of retry attempts, ErrSenderFault if an entry
+// was rejected because of a sender fault, and otherwise unwraps to the error that ended the operation.
+type BatchError struct {
+	Failures []EntryFailure
+	Err      error // Error that ended the operation, such as ErrRetryCountExceeded or a context error.
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d entries failed: %v", len(e.Failures), e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BatchError) Is(target error) bool {
+	for _, f := range e.Failures {
+		if target == ErrRetryCountExceeded && f.RetriesExhausted {
+			return true
+		}
+
+		if target == ErrSenderFault && f.SenderFault {
+			return true
+		}
+	}
+
+	return false
+}
+
+// batchFailures records the last failure of each entry, keyed by entry id, across the retry attempts
+// of a batch operation. A nil *batchFailures records nothing.
+type batchFailures struct {
+	mu       sync.Mutex
+	failures map[string]*EntryFailure
+}
+
+func newBatchFailures() *batchFailures {
+	return &batchFailures{failures: make(map[string]*EntryFailure)}
+}
+
+func (f *batchFailures) failure(id string) *EntryFailure {
+	ef, ok := f.failures[id]
+	if !ok {
+		ef = &EntryFailure{Id: id}
+		f.failures[id] = ef
+	}
+
+	return ef
+}
+
+// recordResultFailures records the per-entry failures returned in a batch response.
+func (f *batchFailures) recordResultFailures(failed []types.BatchResultErrorEntry) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range failed {
+		ef := f.failure(aws.ToString(e.Id))
+		ef.Code = aws.ToString(e.Code)
+		ef.Message = aws.ToString(e.Message)
+		ef.SenderFault = e.SenderFault
+	}
+}
+
+// get returns the last recorded failure of an entry.
+func (f *batchFailures) get(id string) (EntryFailure, bool) {
+	if f == nil {
+		return EntryFailure{}, false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ef, ok := f.failures[id]
+	if !ok {
+		return EntryFailure{}, false
+	}
+
+	return *ef, true
+}
+
+// recordAttempt counts an attempt for every entry of the batch.
+func recordAttempt[T entry](f *batchFailures, entries []T) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range entries {
+		f.failure(aws.ToString(e.getId())).Attempts++
+	}
+}
+
+// recordRequestError records an error failing the whole batch request for every entry of the batch.
+func recordRequestError[T entry](f *batchFailures, entries []T, err error) {
+	if f == nil {
+		return
+	}
+
+	code, message := "", err.Error()
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code, message = apiErr.ErrorCode(), apiErr.ErrorMessage()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range entries {
+		ef := f.failure(aws.ToString(e.getId()))
+		ef.Code = code
+		ef.Message = message
+	}
+}
+
+// markExhausted records that the entries ran out of retry attempts.
+func markExhausted[T entry](f *batchFailures, entries []T) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range entries {
+		f.failure(aws.ToString(e.getId())).RetriesExhausted = true
+	}
+}
+
+// newBatchError builds a BatchError listing the recorded failure of every failed entry.
+func newBatchError[T entry](failedEntries []T, f *batchFailures, err error) *BatchError {
+	failures := make([]EntryFailure, len(failedEntries))
+	for i, e := range failedEntries {
+		id := aws.ToString(e.getId())
+		ef, ok := f.get(id)
+		if !ok {
+			ef = EntryFailure{Id: id}
+		}
+
+		failures[i] = ef
+	}
+
+	return &BatchError{Failures: failures, Err: err}
+}
+
+// partitionSenderFaults splits failed entries, ordered as the failed results returned by getFailedEntries,
+// into entries worth retrying and entries rejected because of a sender fault.
+func partitionSenderFaults[T entry](failedEntries []T, failed []types.BatchResultErrorEntry) (retryable []T, senderFaults []T) {
+	for i, e := range failedEntries {
+		if i < len(failed) && failed[i].SenderFault {
+			senderFaults = append(senderFaults, e)
+			continue
+		}
+
+		retryable = append(retryable, e)
+	}
+
+	return retryable, senderFaults
+}
+
+// withSenderFaults adds the entries rejected because of a sender fault to the result of retrying the others.
+func withSenderFaults[T entry](failed []T, err error, senderFaults []T) ([]T, error) {
+	if len(senderFaults) == 0 {
+		return failed, err
+	}
+
+	if err == nil {
+		err = ErrSenderFault
+	}
+
+	return append(senderFaults, failed...), err
+}
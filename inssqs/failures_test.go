@@ -0,0 +1,132 @@
+package inssqs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestQueue_SendMessageBatch_failureReasons(t *testing.T) {
+	t.Run("it_should_report_failure_reason_of_each_entry", func(t *testing.T) {
+		q, client := newQueue(t)
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(4).
+			DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				failed := []types.BatchResultErrorEntry{
+					{Id: aws.String("retryable"), Code: aws.String("InternalError"), Message: aws.String("try again")},
+				}
+				if len(in.Entries) == 2 {
+					failed = append(failed, types.BatchResultErrorEntry{
+						Id: aws.String("invalid"), Code: aws.String("InvalidParameterValue"), Message: aws.String("bad"), SenderFault: true,
+					})
+				}
+
+				return &awssqs.SendMessageBatchOutput{Failed: failed}, nil
+			})
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			{Id: aws.String("retryable")},
+			{Id: aws.String("invalid")},
+		})
+
+		require.Len(t, failed, 2)
+
+		var batchErr *BatchError
+		require.True(t, errors.As(err, &batchErr))
+		assert.ErrorIs(t, err, ErrRetryCountExceeded)
+		assert.ErrorIs(t, err, ErrSenderFault)
+		assert.ElementsMatch(t, []EntryFailure{
+			{Id: "invalid", Code: "InvalidParameterValue", Message: "bad", SenderFault: true, Attempts: 1},
+			{Id: "retryable", Code: "InternalError", Message: "try again", Attempts: 4, RetriesExhausted: true},
+		}, batchErr.Failures)
+	})
+
+	t.Run("it_should_not_retry_sender_fault_entries", func(t *testing.T) {
+		q, client := newQueue(t)
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(&awssqs.SendMessageBatchOutput{
+				Failed: []types.BatchResultErrorEntry{
+					{Id: aws.String("invalid"), Code: aws.String("InvalidParameterValue"), SenderFault: true},
+				},
+			}, nil)
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{{Id: aws.String("valid")}, {Id: aws.String("invalid")}})
+
+		require.Len(t, failed, 1)
+		assert.Equal(t, "invalid", aws.ToString(failed[0].Id))
+		assert.ErrorIs(t, err, ErrSenderFault)
+		assert.NotErrorIs(t, err, ErrRetryCountExceeded)
+	})
+
+	t.Run("it_should_route_sender_fault_entries_to_dead_letter_sink", func(t *testing.T) {
+		q, client := newQueue(t)
+		collected := collectDeadLetters(&q)
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&awssqs.SendMessageBatchOutput{
+				Failed: []types.BatchResultErrorEntry{
+					{Id: aws.String("invalid"), Code: aws.String("InvalidParameterValue"), SenderFault: true},
+				},
+			}, nil)
+
+		_, err := q.SendMessageBatch([]SQSMessageEntry{{Id: aws.String("invalid")}})
+
+		assert.Error(t, err)
+		require.Len(t, *collected, 1)
+		assert.Equal(t, "InvalidParameterValue", (*collected)[0].ErrorCode)
+	})
+
+	t.Run("it_should_keep_context_errors_unwrappable", func(t *testing.T) {
+		q, _ := newQueue(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		failed, err := q.SendMessageBatchWithContext(ctx, []SQSMessageEntry{{Id: aws.String("test-id")}})
+
+		require.Len(t, failed, 1)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		var batchErr *BatchError
+		require.True(t, errors.As(err, &batchErr))
+		assert.Equal(t, []EntryFailure{{Id: "test-id"}}, batchErr.Failures)
+	})
+}
+
+func TestQueue_DeleteMessageBatch_failureReasons(t *testing.T) {
+	t.Run("it_should_not_retry_invalid_receipt_handles", func(t *testing.T) {
+		q, client := newQueue(t)
+
+		client.EXPECT().
+			DeleteMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(&awssqs.DeleteMessageBatchOutput{
+				Failed: []types.BatchResultErrorEntry{
+					{Id: aws.String("test-id"), Code: aws.String("ReceiptHandleIsInvalid"), SenderFault: true},
+				},
+			}, nil)
+
+		failed, err := q.DeleteMessageBatch([]SQSDeleteMessageEntry{{Id: aws.String("test-id"), ReceiptHandle: aws.String("rh")}})
+
+		require.Len(t, failed, 1)
+
+		var batchErr *BatchError
+		require.True(t, errors.As(err, &batchErr))
+		assert.Equal(t, []EntryFailure{
+			{Id: "test-id", Code: "ReceiptHandleIsInvalid", SenderFault: true, Attempts: 1},
+		}, batchErr.Failures)
+	})
+}
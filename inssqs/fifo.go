@@ -0,0 +1,141 @@
+package inssqs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fifoSuffix is the suffix SQS requires in the name of FIFO queues.
+const fifoSuffix = ".fifo"
+
+// withDeduplicationIds returns the entries with a content-based MessageDeduplicationId added to those missing one.
+// The id is the SHA-256 hash of the body, as SQS computes it for queues with content-based deduplication,
+// so resending a failed entry within the deduplication interval does not create a duplicate.
+func withDeduplicationIds(entries []SQSMessageEntry) []SQSMessageEntry {
+	result := make([]SQSMessageEntry, len(entries))
+	for i, e := range entries {
+		if e.MessageDeduplicationId == nil {
+			hash := sha256.Sum256([]byte(aws.ToString(e.MessageBody)))
+			e.MessageDeduplicationId = aws.String(hex.EncodeToString(hash[:]))
+		}
+
+		result[i] = e
+	}
+
+	return result
+}
+
+// groupByMessageGroupId partitions the entries by message group id, keeping their order within each group
+// and ordering the groups by their first entry.
+func groupByMessageGroupId(entries []SQSMessageEntry) [][]SQSMessageEntry {
+	var groups [][]SQSMessageEntry
+	index := make(map[string]int)
+	for _, e := range entries {
+		id := aws.ToString(e.MessageGroupId)
+		i, ok := index[id]
+		if !ok {
+			i = len(groups)
+			index[id] = i
+			groups = append(groups, nil)
+		}
+
+		groups[i] = append(groups[i], e)
+	}
+
+	return groups
+}
+
+// sendGroups sends message groups in rounds. Each round packs the next entry of every group into shared batches
+// and sends the batches concurrently. A group's next entry is only sent once its previous one has been accepted,
+// retries included, so messages of a group reach the queue in order: SQS would drop a later entry accepted before
+// a failed one as a duplicate if it was sent again, so a batch never holds more than one entry of a group.
+// Once an entry of a group cannot be sent, the rest of the group is not sent and is returned as failed.
+// Entries rejected because of a sender fault are skipped, since they can never be sent.
+//
+// Parameters:
+// - ctx: A context passed to every batch operation.
+// - groups: A slice of slices, each containing the entries of a single message group in order.
+// - failures: A record of the last failure of each entry, filled during the operation.
+//
+// Returns:
+// - failedEntries: A slice of SQSMessageEntry containing the failed entries across all groups.
+// - err: An error indicating any failure during the sending process, nil if all operations succeeded.
+func (q *queue) sendGroups(ctx context.Context, groups [][]SQSMessageEntry, failures *batchFailures) ([]SQSMessageEntry, error) {
+	b := q.newBackoff()
+	send := func(ctx context.Context, batch []SQSMessageEntry, retryCount int) ([]SQSMessageEntry, error) {
+		return q.sendMessageBatch(ctx, batch, retryCount, failures, b)
+	}
+
+	var failedEntries []SQSMessageEntry
+	var outerErr error
+	for len(groups) > 0 {
+		var batches [][]SQSMessageEntry
+		batches, groups = packGroups(groups, q.maxBatchSize, q.maxBatchSizeBytes)
+
+		failed, err := doConcurrently(ctx, batches, q.workers, q.retryCount, send)
+		failedEntries = append(failedEntries, failed...)
+		if err == nil {
+			continue
+		}
+
+		if outerErr == nil || outerErr == ErrSenderFault {
+			outerErr = err
+		}
+
+		blocked := make(map[string]bool)
+		for _, e := range failed {
+			if ef, ok := failures.get(aws.ToString(e.Id)); !ok || !ef.SenderFault {
+				blocked[aws.ToString(e.MessageGroupId)] = true
+			}
+		}
+
+		remaining := groups[:0]
+		for _, group := range groups {
+			if blocked[aws.ToString(group[0].MessageGroupId)] {
+				failedEntries = append(failedEntries, group...)
+				continue
+			}
+
+			remaining = append(remaining, group)
+		}
+
+		groups = remaining
+	}
+
+	return failedEntries, outerErr
+}
+
+// packGroups packs the first entry of each group into batches holding at most recordLimit entries and byteLimit bytes,
+// so batches of the same round can be sent and retried concurrently without reordering a group.
+// An entry larger than byteLimit is put into a batch of its own.
+//
+// Returns:
+// - batches: The batches to send in this round, following the order of the groups.
+// - rest: The entries of each group left for the next rounds, groups that were fully packed are omitted.
+func packGroups(groups [][]SQSMessageEntry, recordLimit int, byteLimit int) (batches [][]SQSMessageEntry, rest [][]SQSMessageEntry) {
+	var batch []SQSMessageEntry
+	batchSize := 0
+	for _, group := range groups {
+		entrySize := group[0].size()
+		if len(batch) > 0 && (len(batch) == recordLimit || batchSize+entrySize > byteLimit) {
+			batches = append(batches, batch)
+			batch = nil
+			batchSize = 0
+		}
+
+		batch = append(batch, group[0])
+		batchSize += entrySize
+
+		if len(group) > 1 {
+			rest = append(rest, group[1:])
+		}
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches, rest
+}
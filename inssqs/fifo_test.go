@@ -0,0 +1,270 @@
+package inssqs
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func newFIFOEntry(id, group string) SQSMessageEntry {
+	return SQSMessageEntry{Id: aws.String(id), MessageBody: aws.String("body-" + id), MessageGroupId: aws.String(group)}
+}
+
+func batchIds(in *awssqs.SendMessageBatchInput) []string {
+	ids := make([]string, len(in.Entries))
+	for i, e := range in.Entries {
+		ids[i] = aws.ToString(e.Id)
+	}
+
+	return ids
+}
+
+func TestWithDeduplicationIds(t *testing.T) {
+	t.Run("it_should_add_content_based_ids_to_entries_missing_one", func(t *testing.T) {
+		entries := []SQSMessageEntry{
+			{Id: aws.String("1"), MessageBody: aws.String("hello")},
+			{Id: aws.String("2"), MessageBody: aws.String("hello"), MessageDeduplicationId: aws.String("explicit")},
+		}
+
+		result := withDeduplicationIds(entries)
+
+		assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", aws.ToString(result[0].MessageDeduplicationId))
+		assert.Equal(t, "explicit", aws.ToString(result[1].MessageDeduplicationId))
+		assert.Nil(t, entries[0].MessageDeduplicationId, "given entries should not be modified")
+	})
+}
+
+func TestGroupByMessageGroupId(t *testing.T) {
+	t.Run("it_should_keep_order_within_groups", func(t *testing.T) {
+		groups := groupByMessageGroupId([]SQSMessageEntry{
+			newFIFOEntry("a1", "a"), newFIFOEntry("b1", "b"), newFIFOEntry("a2", "a"), newFIFOEntry("b2", "b"),
+		})
+
+		require.Len(t, groups, 2)
+		assert.Equal(t, []SQSMessageEntry{newFIFOEntry("a1", "a"), newFIFOEntry("a2", "a")}, groups[0])
+		assert.Equal(t, []SQSMessageEntry{newFIFOEntry("b1", "b"), newFIFOEntry("b2", "b")}, groups[1])
+	})
+}
+
+func TestPackGroups(t *testing.T) {
+	t.Run("it_should_pack_the_first_entry_of_each_group", func(t *testing.T) {
+		groups := [][]SQSMessageEntry{
+			{newFIFOEntry("a1", "a"), newFIFOEntry("a2", "a"), newFIFOEntry("a3", "a")},
+			{newFIFOEntry("b1", "b"), newFIFOEntry("b2", "b")},
+			{newFIFOEntry("c1", "c")},
+		}
+
+		batches, rest := packGroups(groups, 2, 1024)
+
+		assert.Equal(t, [][]SQSMessageEntry{
+			{newFIFOEntry("a1", "a"), newFIFOEntry("b1", "b")},
+			{newFIFOEntry("c1", "c")},
+		}, batches)
+		assert.Equal(t, [][]SQSMessageEntry{
+			{newFIFOEntry("a2", "a"), newFIFOEntry("a3", "a")},
+			{newFIFOEntry("b2", "b")},
+		}, rest)
+	})
+
+	t.Run("it_should_respect_the_byte_limit", func(t *testing.T) {
+		groups := [][]SQSMessageEntry{
+			{newFIFOEntry("a1", "a"), newFIFOEntry("a2", "a")},
+			{newFIFOEntry("b1", "b")},
+		}
+		size := groups[0][0].size()
+
+		batches, rest := packGroups(groups, 10, size)
+
+		assert.Equal(t, [][]SQSMessageEntry{{newFIFOEntry("a1", "a")}, {newFIFOEntry("b1", "b")}}, batches)
+		assert.Equal(t, [][]SQSMessageEntry{{newFIFOEntry("a2", "a")}}, rest)
+	})
+}
+
+func TestQueue_SendMessageBatch_fifo(t *testing.T) {
+	useFIFO := func(q *queue) {
+		q.fifo = true
+		q.maxBatchSize = 2
+		q.maxBatchSizeBytes = 1024
+		q.workers = 4
+	}
+
+	t.Run("it_should_pack_groups_into_shared_batches", func(t *testing.T) {
+		q, client := newQueue(t)
+		useFIFO(&q)
+		q.maxBatchSize = 10
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				for _, e := range in.Entries {
+					assert.NotNil(t, e.MessageDeduplicationId)
+				}
+
+				assert.Equal(t, []string{"a1", "b1", "c1"}, batchIds(in))
+				return &awssqs.SendMessageBatchOutput{}, nil
+			})
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			newFIFOEntry("a1", "a"), newFIFOEntry("b1", "b"), newFIFOEntry("c1", "c"),
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+	})
+
+	t.Run("it_should_send_single_message_groups_in_full_batches", func(t *testing.T) {
+		q, client := newQueue(t)
+		useFIFO(&q)
+		q.maxBatchSize = 10
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(3).
+			Return(&awssqs.SendMessageBatchOutput{}, nil)
+
+		entries := make([]SQSMessageEntry, 25)
+		for i := range entries {
+			id := strconv.Itoa(i)
+			entries[i] = newFIFOEntry(id, "group-"+id)
+		}
+
+		failed, err := q.SendMessageBatch(entries)
+
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+	})
+
+	t.Run("it_should_send_the_later_messages_of_a_group_after_its_earlier_ones", func(t *testing.T) {
+		q, client := newQueue(t)
+		useFIFO(&q)
+		q.maxBatchSize = 10
+
+		var mu sync.Mutex
+		var sent [][]string
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(3).
+			DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				sent = append(sent, batchIds(in))
+
+				return &awssqs.SendMessageBatchOutput{}, nil
+			})
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			newFIFOEntry("a1", "a"), newFIFOEntry("b1", "b"), newFIFOEntry("a2", "a"), newFIFOEntry("a3", "a"),
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+		assert.Equal(t, [][]string{{"a1", "b1"}, {"a2"}, {"a3"}}, sent)
+	})
+
+	t.Run("it_should_not_send_the_rest_of_a_group_after_a_failed_batch", func(t *testing.T) {
+		q, client := newQueue(t)
+		useFIFO(&q)
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(4).
+			DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				assert.Equal(t, []string{"a1"}, batchIds(in))
+				return nil, assert.AnError
+			})
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			newFIFOEntry("a1", "a"), newFIFOEntry("a2", "a"), newFIFOEntry("a3", "a"),
+		})
+
+		assert.ErrorIs(t, err, ErrRetryCountExceeded)
+		require.Len(t, failed, 3)
+		assert.Equal(t, "a3", aws.ToString(failed[2].Id))
+		assert.NotNil(t, failed[2].MessageDeduplicationId, "failed entries should keep their deduplication id")
+	})
+
+	t.Run("it_should_hold_back_the_rest_of_a_group_until_its_failed_entry_is_retried", func(t *testing.T) {
+		q, client := newQueue(t)
+		useFIFO(&q)
+		q.maxBatchSize = 10
+
+		gomock.InOrder(
+			client.EXPECT().
+				SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+					assert.Equal(t, []string{"a1", "b1"}, batchIds(in))
+					return &awssqs.SendMessageBatchOutput{
+						Failed: []types.BatchResultErrorEntry{{Id: aws.String("a1"), Code: aws.String("InternalError")}},
+					}, nil
+				}),
+			client.EXPECT().
+				SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+					assert.Equal(t, []string{"a1"}, batchIds(in), "only the failed entry should be retried")
+					return &awssqs.SendMessageBatchOutput{}, nil
+				}),
+			client.EXPECT().
+				SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+					assert.Equal(t, []string{"a2"}, batchIds(in), "a2 should only be sent once a1 has been accepted")
+					return &awssqs.SendMessageBatchOutput{}, nil
+				}),
+		)
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			newFIFOEntry("a1", "a"), newFIFOEntry("b1", "b"), newFIFOEntry("a2", "a"),
+		})
+
+		assert.NoError(t, err)
+		assert.Empty(t, failed)
+	})
+
+	t.Run("it_should_skip_sender_fault_entries_and_continue_the_group", func(t *testing.T) {
+		q, client := newQueue(t)
+		useFIFO(&q)
+		q.maxBatchSize = 1
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(2).
+			DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				if aws.ToString(in.Entries[0].Id) == "a1" {
+					return &awssqs.SendMessageBatchOutput{
+						Failed: []types.BatchResultErrorEntry{{Id: aws.String("a1"), Code: aws.String("InvalidParameterValue"), SenderFault: true}},
+					}, nil
+				}
+
+				return &awssqs.SendMessageBatchOutput{}, nil
+			})
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{newFIFOEntry("a1", "a"), newFIFOEntry("a2", "a")})
+
+		assert.ErrorIs(t, err, ErrSenderFault)
+		require.Len(t, failed, 1)
+		assert.Equal(t, "a1", aws.ToString(failed[0].Id))
+	})
+}
+
+func TestConfig_setDefaults_fifo(t *testing.T) {
+	t.Run("it_should_enable_fifo_for_fifo_queue_names", func(t *testing.T) {
+		c := Config{QueueName: "orders.fifo"}
+		c.setDefaults()
+
+		assert.True(t, c.FIFO)
+	})
+
+	t.Run("it_should_not_enable_fifo_for_standard_queue_names", func(t *testing.T) {
+		c := Config{QueueName: "orders"}
+		c.setDefaults()
+
+		assert.False(t, c.FIFO)
+	})
+}
@@ -0,0 +1,98 @@
+package inssqs
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// heartbeat periodically extends the visibility timeout of in-flight messages until their handlers return,
+// coalescing the extensions of all in-flight messages into ChangeMessageVisibilityBatch calls.
+type heartbeat struct {
+	queue             *queue
+	interval          time.Duration
+	visibilityTimeout int32
+
+	mu       sync.Mutex
+	seq      uint64
+	inFlight map[string]*string // receipt handles of in-flight messages keyed by their batch entry id.
+
+	stopChannel chan struct{}
+	done        chan struct{}
+}
+
+func newHeartbeat(q *queue, interval time.Duration, visibilityTimeout int32) *heartbeat {
+	return &heartbeat{
+		queue:             q,
+		interval:          interval,
+		visibilityTimeout: visibilityTimeout,
+		inFlight:          make(map[string]*string),
+		stopChannel:       make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+}
+
+// track registers a message as in-flight and returns a function that unregisters it.
+func (h *heartbeat) track(m SQSMessage) (untrack func()) {
+	h.mu.Lock()
+	h.seq++
+	id := strconv.FormatUint(h.seq, 10)
+	h.inFlight[id] = m.ReceiptHandle
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		delete(h.inFlight, id)
+		h.mu.Unlock()
+	}
+}
+
+// start extends the visibility of in-flight messages on every tick until stop is called.
+func (h *heartbeat) start() {
+	go func() {
+		defer close(h.done)
+
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.extend()
+			case <-h.stopChannel:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops the heartbeat and waits for an ongoing extension to finish.
+func (h *heartbeat) stop() {
+	close(h.stopChannel)
+	<-h.done
+}
+
+// extend sends a visibility change for every message that is in-flight at the time of the call.
+func (h *heartbeat) extend() {
+	h.mu.Lock()
+	entries := make([]SQSChangeMessageVisibilityEntry, 0, len(h.inFlight))
+	for id, receiptHandle := range h.inFlight {
+		entries = append(entries, SQSChangeMessageVisibilityEntry{
+			Id:                aws.String(id),
+			ReceiptHandle:     receiptHandle,
+			VisibilityTimeout: h.visibilityTimeout,
+		})
+	}
+	h.mu.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+
+	failed, err := h.queue.changeMessageVisibilityBatches(context.Background(), entries)
+	if err != nil {
+		h.queue.logger.Errorf("Error extending visibility of %d in-flight messages: %v\n", len(failed), err)
+	}
+}
@@ -0,0 +1,154 @@
+package inssqs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestHeartbeat_extend(t *testing.T) {
+	t.Run("it_should_coalesce_in_flight_messages_into_one_batch", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		hb := newHeartbeat(q, time.Hour, 30)
+
+		hb.track(SQSMessage{ReceiptHandle: aws.String("rh-1")})
+		hb.track(SQSMessage{ReceiptHandle: aws.String("rh-2")})
+		untrack := hb.track(SQSMessage{ReceiptHandle: aws.String("rh-3")})
+		untrack()
+
+		client.EXPECT().
+			ChangeMessageVisibilityBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, in *awssqs.ChangeMessageVisibilityBatchInput, _ ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityBatchOutput, error) {
+				handles := make([]string, len(in.Entries))
+				for i, e := range in.Entries {
+					handles[i] = aws.ToString(e.ReceiptHandle)
+					assert.Equal(t, int32(30), e.VisibilityTimeout)
+				}
+				assert.ElementsMatch(t, []string{"rh-1", "rh-2"}, handles)
+
+				return &awssqs.ChangeMessageVisibilityBatchOutput{}, nil
+			})
+
+		hb.extend()
+	})
+
+	t.Run("it_should_not_call_sqs_when_nothing_is_in_flight", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		hb := newHeartbeat(q, time.Hour, 30)
+
+		client.EXPECT().ChangeMessageVisibilityBatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		hb.extend()
+	})
+
+	t.Run("it_should_retry_failed_entries", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		hb := newHeartbeat(q, time.Hour, 30)
+		hb.track(SQSMessage{ReceiptHandle: aws.String("rh-1")})
+
+		gomock.InOrder(
+			client.EXPECT().
+				ChangeMessageVisibilityBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(&awssqs.ChangeMessageVisibilityBatchOutput{
+					Failed: []types.BatchResultErrorEntry{{Id: aws.String("1")}},
+				}, nil),
+			client.EXPECT().
+				ChangeMessageVisibilityBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(&awssqs.ChangeMessageVisibilityBatchOutput{}, nil),
+		)
+
+		hb.extend()
+	})
+}
+
+func TestConsumer_Start_withHeartbeat(t *testing.T) {
+	t.Run("it_should_extend_visibility_until_the_handler_returns", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		expectReceive(client, newMessage("1"))
+		deleted := recordDeletes(client)
+
+		var mu sync.Mutex
+		extensions := 0
+		client.EXPECT().
+			ChangeMessageVisibilityBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, in *awssqs.ChangeMessageVisibilityBatchInput, _ ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityBatchOutput, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				require.Len(t, in.Entries, 1)
+				assert.Equal(t, "rh-1", aws.ToString(in.Entries[0].ReceiptHandle))
+				extensions++
+
+				return &awssqs.ChangeMessageVisibilityBatchOutput{}, nil
+			}).
+			MinTimes(1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		c, err := NewConsumer(q, ConsumerConfig{HeartbeatInterval: 10 * time.Millisecond}, func(context.Context, SQSMessage) error {
+			defer cancel()
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), c.(*consumer).visibilityTimeout, "visibility timeout should default to twice the interval")
+
+		require.NoError(t, c.Start(ctx))
+		assert.Equal(t, []string{"rh-1"}, deleted())
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.GreaterOrEqual(t, extensions, 1)
+	})
+
+	t.Run("it_should_extend_messages_waiting_for_a_free_worker", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		expectReceive(client, newMessage("1"), newMessage("2"))
+		deleted := recordDeletes(client)
+
+		extended := make(chan []string, 100)
+		client.EXPECT().
+			ChangeMessageVisibilityBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, in *awssqs.ChangeMessageVisibilityBatchInput, _ ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityBatchOutput, error) {
+				handles := make([]string, len(in.Entries))
+				for i, e := range in.Entries {
+					handles[i] = aws.ToString(e.ReceiptHandle)
+				}
+				extended <- handles
+
+				return &awssqs.ChangeMessageVisibilityBatchOutput{}, nil
+			}).
+			MinTimes(1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		release := make(chan struct{})
+
+		c, err := NewConsumer(q, ConsumerConfig{HeartbeatInterval: 10 * time.Millisecond}, func(_ context.Context, m SQSMessage) error {
+			if aws.ToString(m.MessageId) == "1" {
+				<-release
+			} else {
+				cancel()
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		done := make(chan error)
+		go func() {
+			done <- c.Start(ctx)
+		}()
+
+		assert.ElementsMatch(t, []string{"rh-1", "rh-2"}, <-extended, "the waiting message should be extended")
+		close(release)
+
+		require.NoError(t, <-done)
+		assert.ElementsMatch(t, []string{"rh-1", "rh-2"}, deleted())
+	})
+}
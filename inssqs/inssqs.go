@@ -9,28 +9,43 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/aws/smithy-go/middleware"
 	"github.com/pkg/errors"
-	"github.com/useinsider/go-pkg/insdash"
 	"github.com/useinsider/go-pkg/inslogger"
 	"github.com/useinsider/go-pkg/inssqs/sqs"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Interface interface {
 	SendMessageBatch(entries []SQSMessageEntry) (failed []SQSMessageEntry, err error)
+	SendMessageBatchWithContext(ctx context.Context, entries []SQSMessageEntry) (failed []SQSMessageEntry, err error)
 	DeleteMessageBatch(entries []SQSDeleteMessageEntry) (failed []SQSDeleteMessageEntry, err error)
+	DeleteMessageBatchWithContext(ctx context.Context, entries []SQSDeleteMessageEntry) (failed []SQSDeleteMessageEntry, err error)
 }
 
 type queue struct {
 	client   sqs.API
 	name     string
+	urlMu    sync.Mutex // Guards the lazy resolution of url.
 	url      *string
 	endpoint string
 
-	retryCount int
+	retryCount     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	retryDeadline  time.Duration
 
 	maxBatchSize      int
 	maxBatchSizeBytes int
 	workers           int
+	fifo              bool
+
+	payloadStore         PayloadStore
+	payloadSizeThreshold int
+
+	deadLetterSink DeadLetterSink
+
+	metrics Metrics
 
 	logger inslogger.Interface
 }
@@ -44,59 +59,124 @@ type Config struct {
 	MaxBatchSizeBytes int    // Maximum size of a message batch in bytes.
 	MaxWorkers        int    // Maximum number of workers for concurrent operations.
 	LogLevel          string // Log level for SQS operations.
+	FIFO              bool   // Whether messages are sent in message group order, enabled for queue names ending with .fifo.
+
+	RetryBaseDelay time.Duration // Delay before the first retry attempt, doubled for every further attempt with full jitter. No delay when zero.
+	RetryMaxDelay  time.Duration // Upper bound of the delay between retry attempts.
+	RetryDeadline  time.Duration // Total time allowed for retrying a batch operation, unlimited when zero.
+
+	PayloadStore         PayloadStore // Optional store for message bodies larger than PayloadSizeThreshold.
+	PayloadSizeThreshold int          // Message size in bytes, body and attributes, above which bodies are offloaded to PayloadStore.
+
+	DeadLetterSink DeadLetterSink // Optional sink receiving the messages that could not be sent after all retry attempts.
+
+	Metrics Metrics // Optional recorder of the batch requests, see NewOTelMetrics.
 
 	EndpointUrl string // Endpoint URL for AWS operations.
 }
 
+// NewSQS creates a queue and resolves its URL, panicking on failure.
+// It is equivalent to New followed by resolving the queue URL, see New for an error-returning alternative.
 func NewSQS(config Config) Interface {
-	if config.Region == "" {
-		panic(ErrRegionNotSet)
+	q, err := New(config)
+	if err != nil {
+		panic(err)
 	}
 
-	if config.QueueName == "" {
-		panic(ErrQueueNameNotSet)
+	if _, err = q.(*queue).getQueueUrl(context.Background()); err != nil {
+		panic(errors.Wrap(err, "error while getting queue url"))
 	}
 
-	config.setDefaults()
+	return q
+}
 
-	cfg, err := awsconfig.LoadDefaultConfig(context.Background(),
-		awsconfig.WithRegion(config.Region),
-		awsconfig.WithRetryMaxAttempts(config.RetryCount),
-		awsconfig.WithRetryMode(aws.RetryModeAdaptive))
-	if err != nil {
-		panic(errors.Wrap(err, "error while loading aws sqs config"))
+// New creates a queue from the configuration, customized by the options.
+// The queue URL is resolved on first use, so New does not call SQS.
+//
+// Parameters:
+// - config: The configuration of the queue. Region is required unless WithClient or WithAWSConfig is given.
+// - opts: Options injecting an SQS client, a logger or an AWS configuration.
+//
+// Returns:
+// - q: The queue.
+// - err: ErrRegionNotSet or ErrQueueNameNotSet for an incomplete configuration,
+// or an error if the default AWS configuration cannot be loaded.
+func New(config Config, opts ...Option) (Interface, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	// set endpoint url if provided
-	if config.EndpointUrl != "" {
-		cfg.BaseEndpoint = aws.String(config.EndpointUrl)
+	if config.QueueName == "" {
+		return nil, ErrQueueNameNotSet
 	}
 
-	var logger inslogger.Interface
-	if config.LogLevel == "" {
-		logger = inslogger.NewNopLogger()
-	} else {
-		logger = inslogger.NewLogger(inslogger.LogLevel(config.LogLevel))
+	config.setDefaults()
+
+	client, err := o.newClient(config)
+	if err != nil {
+		return nil, err
 	}
 
+	logger := o.newLogger(config)
+
 	q := &queue{
-		client:            sqs.NewSQSProxy(awssqs.NewFromConfig(cfg)),
+		client:            client,
 		name:              config.QueueName,
 		retryCount:        config.RetryCount,
+		retryBaseDelay:    config.RetryBaseDelay,
+		retryMaxDelay:     config.RetryMaxDelay,
+		retryDeadline:     config.RetryDeadline,
 		workers:           config.MaxWorkers,
 		logger:            logger,
 		maxBatchSize:      config.MaxBatchSize,
 		maxBatchSizeBytes: config.MaxBatchSizeBytes,
+		fifo:              config.FIFO,
+
+		payloadStore:         config.PayloadStore,
+		payloadSizeThreshold: config.PayloadSizeThreshold,
+
+		deadLetterSink: config.DeadLetterSink,
+
+		metrics: config.Metrics,
 	}
 
-	qUrl, err := q.getQueueUrl()
-	if err != nil {
-		panic(errors.Wrap(err, "error while getting queue url"))
+	return q, nil
+}
+
+// loadAWSConfig returns the AWS configuration of the SQS client, loading the default one if none is given.
+func loadAWSConfig(config Config, awsConfig *aws.Config) (aws.Config, error) {
+	var cfg aws.Config
+	if awsConfig != nil {
+		cfg = awsConfig.Copy()
+		if config.Region != "" {
+			cfg.Region = config.Region
+		}
+
+		if cfg.Region == "" {
+			return aws.Config{}, ErrRegionNotSet
+		}
+	} else {
+		if config.Region == "" {
+			return aws.Config{}, ErrRegionNotSet
+		}
+
+		var err error
+		cfg, err = awsconfig.LoadDefaultConfig(context.Background(),
+			awsconfig.WithRegion(config.Region),
+			awsconfig.WithRetryMaxAttempts(config.RetryCount),
+			awsconfig.WithRetryMode(aws.RetryModeAdaptive))
+		if err != nil {
+			return aws.Config{}, errors.Wrap(err, "error while loading aws sqs config")
+		}
 	}
 
-	q.url = qUrl
+	// set endpoint url if provided
+	if config.EndpointUrl != "" {
+		cfg.BaseEndpoint = aws.String(config.EndpointUrl)
+	}
 
-	return q
+	return cfg, nil
 }
 
 func (c *Config) setDefaults() {
@@ -115,29 +195,90 @@ func (c *Config) setDefaults() {
 	if c.RetryCount == 0 {
 		c.RetryCount = 3
 	}
+
+	if strings.HasSuffix(c.QueueName, fifoSuffix) {
+		c.FIFO = true
+	}
+
+	if c.RetryBaseDelay > 0 && c.RetryMaxDelay == 0 {
+		c.RetryMaxDelay = DefaultRetryMaxDelay
+	}
+
+	if c.PayloadStore != nil && c.PayloadSizeThreshold == 0 {
+		c.PayloadSizeThreshold = DefaultPayloadSizeThreshold
+	}
 }
 
 // SendMessageBatch sends a batch of messages to an SQS queue, handling retries and respecting batch size constraints.
+// It is equivalent to SendMessageBatchWithContext with a background context.
+func (q *queue) SendMessageBatch(entries []SQSMessageEntry) ([]SQSMessageEntry, error) {
+	return q.SendMessageBatchWithContext(context.Background(), entries)
+}
+
+// SendMessageBatchWithContext sends a batch of messages to an SQS queue, handling retries and respecting batch size constraints.
 //
 // Parameters:
+// - ctx: A context passed to every SQS call. Once it is canceled no new batches or retries are started.
 // - entries: A slice of SQSMessageEntry representing messages to be sent in batches to the SQS queue.
 //
+// If a payload store is configured, bodies larger than the payload size threshold are stored there
+// and sent as pointer messages, so batching is done on the pointer size.
+// The trace context of ctx is added to the message attributes using the global OpenTelemetry propagator.
+// In FIFO mode, messages missing a MessageDeduplicationId get a content-based one, and the messages of each
+// message group are sent in order: a batch holds at most one message of each group, a group's next message is only
+// sent after its previous one was accepted, and its remaining messages are returned as failed once one cannot be sent.
+//
 // Returns:
-// - failedEntries: A slice of SQSMessageEntry containing the messages that failed to be sent after all attempts.
+// - failedEntries: A slice of SQSMessageEntry containing the messages that failed to be sent after all attempts,
+// including the messages that were not sent because the context was canceled or the queue URL could not be resolved.
+// Offloaded messages that failed to be sent are returned with their pointer body, which can be sent again as is.
+// Messages that ran out of retry attempts or were rejected because of a sender fault are also handed
+// to the dead-letter sink, if one is configured.
 // - err: An error indicating any failure during the sending process, nil if all messages were sent successfully.
+// Sending failures are reported as a *BatchError listing the failure reason of every failed message.
 //
 // Note:
-// SendMessageBatch operation has an inherent concurrency limit.
+// SendMessageBatchWithContext operation has an inherent concurrency limit.
 // When multiple concurrent calls reach the maximum workers, the total worker count might exceed expectations.
 // Consider this while designing applications for optimal performance.
-func (q *queue) SendMessageBatch(entries []SQSMessageEntry) ([]SQSMessageEntry, error) {
-	// TODO: make concurrency as optional.
-	batches, err := insdash.CreateBatches(entries, q.maxBatchSize, q.maxBatchSizeBytes)
+func (q *queue) SendMessageBatchWithContext(ctx context.Context, entries []SQSMessageEntry) ([]SQSMessageEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	if _, err := q.getQueueUrl(ctx); err != nil {
+		q.logger.Errorf("Error sending %d messages to SQS: %v\n", len(entries), err)
+		return entries, errors.Wrap(err, "error while getting queue url")
+	}
+
+	if q.fifo {
+		entries = withDeduplicationIds(entries)
+	}
+
+	// The trace context is injected first, so that its attributes count towards the offload threshold.
+	ready, failedOffloads, offloadErr := q.offloadLargePayloads(ctx, q.injectTraceContext(ctx, entries))
+
+	failures := newBatchFailures()
+	var failedEntries []SQSMessageEntry
+	var err error
+	if q.fifo {
+		failedEntries, err = q.sendGroups(ctx, groupByMessageGroupId(ready), failures)
+	} else {
+		// TODO: make concurrency as optional.
+		batches := createBatches(ready, q.maxBatchSize, q.maxBatchSizeBytes)
+		failedEntries, err = q.sendBatchesConcurrently(ctx, batches, failures)
+	}
+
+	q.routeToDeadLetterSink(ctx, failedEntries, failures)
 	if err != nil {
-		return entries, err
+		err = newBatchError(failedEntries, failures, err)
+	}
+
+	failedEntries = append(failedEntries, failedOffloads...)
+	if err == nil {
+		err = offloadErr
 	}
 
-	failedEntries, err := q.sendBatchesConcurrently(batches)
 	if err != nil {
 		q.logger.Errorf("Error sending %d messages to SQS: %v\n", len(failedEntries), err)
 		return failedEntries, err
@@ -146,28 +287,45 @@ func (q *queue) SendMessageBatch(entries []SQSMessageEntry) ([]SQSMessageEntry,
 	return failedEntries, nil
 }
 
-// DeleteMessageBatch attempts to delete a batch of messages from an SQS queue using the provided entries,
+// DeleteMessageBatch attempts to delete a batch of messages from an SQS queue using the provided entries.
+// It is equivalent to DeleteMessageBatchWithContext with a background context.
+func (q *queue) DeleteMessageBatch(entries []SQSDeleteMessageEntry) (failed []SQSDeleteMessageEntry, err error) {
+	return q.DeleteMessageBatchWithContext(context.Background(), entries)
+}
+
+// DeleteMessageBatchWithContext attempts to delete a batch of messages from an SQS queue using the provided entries,
 // handling retries on failure and respecting the specified retry count.
 //
 // Parameters:
+// - ctx: A context passed to every SQS call. Once it is canceled no new batches or retries are started.
 // - entries: A slice of SQSDeleteMessageEntry representing messages to be deleted in batches from the SQS queue.
 //
 // Returns:
-// - failedEntries: A slice of SQSDeleteMessageEntry containing the messages that failed to be deleted after all attempts.
+// - failedEntries: A slice of SQSDeleteMessageEntry containing the messages that failed to be deleted after all attempts,
+// including the messages that were not deleted because the context was canceled or the queue URL could not be resolved.
 // - err: An error indicating any failure during the deletion process, nil if all messages were deleted successfully.
+// Deletion failures are reported as a *BatchError listing the failure reason of every failed message.
 //
-// DeleteMessageBatch operation has an inherent concurrency limit.
+// DeleteMessageBatchWithContext operation has an inherent concurrency limit.
 // When multiple concurrent calls reach the maximum workers, the total worker count might exceed expectations.
 // Consider this while designing applications for optimal performance.
-func (q *queue) DeleteMessageBatch(entries []SQSDeleteMessageEntry) (failed []SQSDeleteMessageEntry, err error) {
-	// TODO: make concurrency as optional.
-	batches, err := insdash.CreateBatches(entries, q.maxBatchSize, q.maxBatchSizeBytes)
-	if err != nil {
-		return entries, err
+func (q *queue) DeleteMessageBatchWithContext(ctx context.Context, entries []SQSDeleteMessageEntry) (failed []SQSDeleteMessageEntry, err error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	if _, err = q.getQueueUrl(ctx); err != nil {
+		q.logger.Errorf("Error deleting %d messages from SQS: %v\n", len(entries), err)
+		return entries, errors.Wrap(err, "error while getting queue url")
 	}
 
-	failedEntries, err := q.deleteBatchesConcurrently(batches)
+	// TODO: make concurrency as optional.
+	batches := createBatches(entries, q.maxBatchSize, q.maxBatchSizeBytes)
+
+	failures := newBatchFailures()
+	failedEntries, err := q.deleteBatchesConcurrently(ctx, batches, failures)
 	if err != nil {
+		err = newBatchError(failedEntries, failures, err)
 		q.logger.Errorf("Error deleting %d messages from SQS: %v\n", len(failedEntries), err)
 		return failedEntries, err
 	}
@@ -179,13 +337,20 @@ func (q *queue) DeleteMessageBatch(entries []SQSDeleteMessageEntry) (failed []SQ
 // on an SQS queue using a specified number of workers and retry logic.
 //
 // Parameters:
+// - ctx: A context passed to every batch operation.
 // - batches: A slice of slices, each containing SQSMessageEntry representing send operations in batches.
+// - failures: A record of the last failure of each entry, filled during the operation.
 //
 // Returns:
 // - failedEntries: A slice of SQSMessageEntry containing the failed send operations across all batches.
 // - err: An error indicating any failure during the concurrent sending process, nil if all operations succeeded.
-func (q *queue) sendBatchesConcurrently(batches [][]SQSMessageEntry) ([]SQSMessageEntry, error) {
-	failedEntries, err := doConcurrently(batches, q.workers, q.retryCount, q.sendMessageBatch)
+func (q *queue) sendBatchesConcurrently(ctx context.Context, batches [][]SQSMessageEntry, failures *batchFailures) ([]SQSMessageEntry, error) {
+	b := q.newBackoff()
+	send := func(ctx context.Context, entries []SQSMessageEntry, retryCount int) ([]SQSMessageEntry, error) {
+		return q.sendMessageBatch(ctx, entries, retryCount, failures, b)
+	}
+
+	failedEntries, err := doConcurrently(ctx, batches, q.workers, q.retryCount, send)
 
 	return failedEntries, err
 }
@@ -194,13 +359,20 @@ func (q *queue) sendBatchesConcurrently(batches [][]SQSMessageEntry) ([]SQSMessa
 // on an SQS queue using a specified number of workers and retry logic.
 //
 // Parameters:
+// - ctx: A context passed to every batch operation.
 // - batches: A slice of slices, each containing SQSDeleteMessageEntry representing delete operations in batches.
+// - failures: A record of the last failure of each entry, filled during the operation.
 //
 // Returns:
 // - failedEntries: A slice of SQSDeleteMessageEntry containing the failed delete operations across all batches.
 // - err: An error indicating any failure during the concurrent deletion process, nil if all operations succeeded.
-func (q *queue) deleteBatchesConcurrently(batches [][]SQSDeleteMessageEntry) ([]SQSDeleteMessageEntry, error) {
-	failedEntries, err := doConcurrently(batches, q.workers, q.retryCount, q.deleteMessageBatch)
+func (q *queue) deleteBatchesConcurrently(ctx context.Context, batches [][]SQSDeleteMessageEntry, failures *batchFailures) ([]SQSDeleteMessageEntry, error) {
+	b := q.newBackoff()
+	del := func(ctx context.Context, entries []SQSDeleteMessageEntry, retryCount int) ([]SQSDeleteMessageEntry, error) {
+		return q.deleteMessageBatch(ctx, entries, retryCount, failures, b)
+	}
+
+	failedEntries, err := doConcurrently(ctx, batches, q.workers, q.retryCount, del)
 
 	return failedEntries, err
 }
@@ -208,21 +380,41 @@ func (q *queue) deleteBatchesConcurrently(batches [][]SQSDeleteMessageEntry) ([]
 // deleteMessageBatch attempts to delete a batch of messages from an SQS queue, handling retries on failure.
 //
 // Parameters:
+// - ctx: A context passed to the SQS call, no retries are attempted once it is canceled.
 // - entries: A slice of SQSDeleteMessageEntry representing messages to be deleted in batches from the SQS queue.
 // - retryCount: An integer indicating the number of retry attempts allowed for deleting the messages.
+// - failures: A record of the last failure of each entry, may be nil.
+// - b: The backoff applied before every retry attempt.
+//
+// Entries rejected because of a sender fault, such as an invalid receipt handle, are not retried.
 //
 // Returns:
 // - failedEntries: A slice of SQSDeleteMessageEntry containing the messages that failed to be deleted after all attempts.
 // - err: An error indicating any failure during the deletion process, nil if all messages were deleted successfully.
-func (q *queue) deleteMessageBatch(entries []SQSDeleteMessageEntry, retryCount int) ([]SQSDeleteMessageEntry, error) {
+func (q *queue) deleteMessageBatch(ctx context.Context, entries []SQSDeleteMessageEntry, retryCount int, failures *batchFailures, b backoff) ([]SQSDeleteMessageEntry, error) {
 	if len(entries) == 0 {
 		return nil, nil
 	}
 
 	if retryCount == 0 {
+		markExhausted(failures, entries)
 		return entries, ErrRetryCountExceeded
 	}
 
+	if err := ctx.Err(); err != nil {
+		return entries, err
+	}
+
+	if err := b.wait(ctx, retryCount); err != nil {
+		if err == ErrRetryDeadlineExceeded {
+			markExhausted(failures, entries)
+		}
+
+		return entries, err
+	}
+
+	recordAttempt(failures, entries)
+
 	batchEntries := make([]types.DeleteMessageBatchRequestEntry, len(entries))
 	for i, e := range entries {
 		batchEntries[i] = e.toDeleteMessageBatchRequestEntry()
@@ -233,13 +425,17 @@ func (q *queue) deleteMessageBatch(entries []SQSDeleteMessageEntry, retryCount i
 		QueueUrl: q.url,
 	}
 
-	res, err := q.client.DeleteMessageBatch(context.Background(), batch)
+	start := time.Now()
+	res, err := q.client.DeleteMessageBatch(ctx, batch)
 	if err != nil {
+		recordBatch(ctx, q, OperationDeleteMessageBatch, entries, b.retry(retryCount), start, -1, 0, err)
 		q.logger.Errorf("Error deleting %d messages to SQS: %v\n", len(entries), err)
-		return q.deleteMessageBatch(entries, retryCount-1)
+		recordRequestError(failures, entries, err)
+		return q.deleteMessageBatch(ctx, entries, retryCount-1, failures, b)
 	}
 
 	attempts := getRequestAttemptCount(res.ResultMetadata)
+	recordBatch(ctx, q, OperationDeleteMessageBatch, entries, b.retry(retryCount), start, attempts, len(res.Failed), nil)
 
 	if len(res.Failed) == 0 {
 		q.logger.Logf("Successfully deleted %d messages to SQS after %d attempts\n", len(entries), attempts)
@@ -248,28 +444,53 @@ func (q *queue) deleteMessageBatch(entries []SQSDeleteMessageEntry, retryCount i
 	}
 
 	failedEntries := getFailedEntries(entries, res.Failed)
+	failures.recordResultFailures(res.Failed)
 	q.logger.Logf("Failed to delete %d messages to SQS after %d attempts\n", len(failedEntries), attempts)
 
-	return q.deleteMessageBatch(failedEntries, retryCount-1)
+	retryable, senderFaults := partitionSenderFaults(failedEntries, res.Failed)
+	failedRetries, err := q.deleteMessageBatch(ctx, retryable, retryCount-1, failures, b)
+
+	return withSenderFaults(failedRetries, err, senderFaults)
 }
 
 // sendMessageBatch sends a batch of SQS messages in multiple attempts based on batch size and size constraints.
 //
 // Parameters:
+// - ctx: A context passed to the SQS call, no retries are attempted once it is canceled.
 // - entries: A slice of SQSMessageEntry representing messages to be sent in batches to the SQS queue.
+// - retryCount: An integer indicating the number of retry attempts allowed for sending the messages.
+// - failures: A record of the last failure of each entry, may be nil.
+// - b: The backoff applied before every retry attempt.
+//
+// Entries rejected because of a sender fault, such as an invalid attribute, are not retried.
 //
 // Returns:
 // - failedEntries: A slice of SQSMessageEntry containing the messages that failed to be sent after all attempts.
 // - err: An error indicating any failure during the sending process, nil if all messages were sent successfully.
-func (q *queue) sendMessageBatch(entries []SQSMessageEntry, retryCount int) (failed []SQSMessageEntry, err error) {
+func (q *queue) sendMessageBatch(ctx context.Context, entries []SQSMessageEntry, retryCount int, failures *batchFailures, b backoff) (failed []SQSMessageEntry, err error) {
 	if len(entries) == 0 {
 		return nil, nil
 	}
 
 	if retryCount == 0 {
+		markExhausted(failures, entries)
 		return entries, ErrRetryCountExceeded
 	}
 
+	if err := ctx.Err(); err != nil {
+		return entries, err
+	}
+
+	if err := b.wait(ctx, retryCount); err != nil {
+		if err == ErrRetryDeadlineExceeded {
+			markExhausted(failures, entries)
+		}
+
+		return entries, err
+	}
+
+	recordAttempt(failures, entries)
+
 	batchEntries := make([]types.SendMessageBatchRequestEntry, len(entries))
 	for i, e := range entries {
 		batchEntries[i] = e.toSendMessageBatchRequestEntry()
@@ -280,13 +501,17 @@ func (q *queue) sendMessageBatch(entries []SQSMessageEntry, retryCount int) (fai
 		QueueUrl: q.url,
 	}
 
-	res, err := q.client.SendMessageBatch(context.Background(), batch)
+	start := time.Now()
+	res, err := q.client.SendMessageBatch(ctx, batch)
 	if err != nil {
+		recordBatch(ctx, q, OperationSendMessageBatch, entries, b.retry(retryCount), start, -1, 0, err)
 		q.logger.Errorf("Error sending %d messages to SQS: %v\n", len(entries), err)
-		return q.sendMessageBatch(entries, retryCount-1)
+		recordRequestError(failures, entries, err)
+		return q.sendMessageBatch(ctx, entries, retryCount-1, failures, b)
 	}
 
 	attempts := getRequestAttemptCount(res.ResultMetadata)
+	recordBatch(ctx, q, OperationSendMessageBatch, entries, b.retry(retryCount), start, attempts, len(res.Failed), nil)
 
 	if len(res.Failed) == 0 {
 		q.logger.Logf("Sent %d messages to SQS after %d attempts\n", len(entries), attempts)
@@ -294,35 +519,145 @@ func (q *queue) sendMessageBatch(entries []SQSMessageEntry, retryCount int) (fai
 	}
 
 	failedEntries := getFailedEntries(entries, res.Failed)
+	failures.recordResultFailures(res.Failed)
+
+	retryable, senderFaults := partitionSenderFaults(failedEntries, res.Failed)
+
+	failedRetries, err := q.sendMessageBatch(ctx, retryable, retryCount-1, failures, b)
+
+	return withSenderFaults(failedRetries, err, senderFaults)
+}
+
+// changeMessageVisibilityBatches concurrently processes multiple batches of visibility changes
+// on an SQS queue using a specified number of workers and retry logic.
+//
+// Parameters:
+// - ctx: A context passed to every batch operation.
+// - entries: A slice of SQSChangeMessageVisibilityEntry representing visibility changes to be applied in batches.
+//
+// Returns:
+// - failedEntries: A slice of SQSChangeMessageVisibilityEntry containing the changes that failed after all attempts.
+// - err: An error indicating any failure during the process, nil if all visibility changes succeeded.
+func (q *queue) changeMessageVisibilityBatches(ctx context.Context, entries []SQSChangeMessageVisibilityEntry) ([]SQSChangeMessageVisibilityEntry, error) {
+	batches := createBatches(entries, q.maxBatchSize, q.maxBatchSizeBytes)
+	b := q.newBackoff()
+	change := func(ctx context.Context, entries []SQSChangeMessageVisibilityEntry, retryCount int) ([]SQSChangeMessageVisibilityEntry, error) {
+		return q.changeMessageVisibilityBatch(ctx, entries, retryCount, nil, b)
+	}
 
-	return q.sendMessageBatch(failedEntries, retryCount-1)
+	return doConcurrently(ctx, batches, q.workers, q.retryCount, change)
+}
+
+// changeMessageVisibilityBatch changes the visibility timeout of a batch of messages, handling retries on failure.
+//
+// Parameters:
+// - ctx: A context passed to the SQS call, no retries are attempted once it is canceled.
+// - entries: A slice of SQSChangeMessageVisibilityEntry representing visibility changes to be applied.
+// - retryCount: An integer indicating the number of retry attempts allowed for the change.
+// - failures: A record of the last failure of each entry, may be nil.
+// - b: The backoff applied before every retry attempt.
+//
+// Entries rejected because of a sender fault, such as the receipt handle of a deleted message, are not retried.
+//
+// Returns:
+// - failedEntries: A slice of SQSChangeMessageVisibilityEntry containing the changes that failed after all attempts.
+// - err: An error indicating any failure during the process, nil if all visibility changes succeeded.
+func (q *queue) changeMessageVisibilityBatch(ctx context.Context, entries []SQSChangeMessageVisibilityEntry, retryCount int, failures *batchFailures, b backoff) ([]SQSChangeMessageVisibilityEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	if retryCount == 0 {
+		markExhausted(failures, entries)
+		return entries, ErrRetryCountExceeded
+	}
+
+	if err := ctx.Err(); err != nil {
+		return entries, err
+	}
+
+	if err := b.wait(ctx, retryCount); err != nil {
+		if err == ErrRetryDeadlineExceeded {
+			markExhausted(failures, entries)
+		}
+
+		return entries, err
+	}
+
+	recordAttempt(failures, entries)
+
+	batchEntries := make([]types.ChangeMessageVisibilityBatchRequestEntry, len(entries))
+	for i, e := range entries {
+		batchEntries[i] = e.toChangeMessageVisibilityBatchRequestEntry()
+	}
+
+	batch := &awssqs.ChangeMessageVisibilityBatchInput{
+		Entries:  batchEntries,
+		QueueUrl: q.url,
+	}
+
+	start := time.Now()
+	res, err := q.client.ChangeMessageVisibilityBatch(ctx, batch)
+	if err != nil {
+		recordBatch(ctx, q, OperationChangeMessageVisibilityBatch, entries, b.retry(retryCount), start, -1, 0, err)
+		q.logger.Errorf("Error changing visibility of %d messages in SQS: %v\n", len(entries), err)
+		recordRequestError(failures, entries, err)
+		return q.changeMessageVisibilityBatch(ctx, entries, retryCount-1, failures, b)
+	}
+
+	attempts := getRequestAttemptCount(res.ResultMetadata)
+	recordBatch(ctx, q, OperationChangeMessageVisibilityBatch, entries, b.retry(retryCount), start, attempts, len(res.Failed), nil)
+
+	if len(res.Failed) == 0 {
+		q.logger.Logf("Changed visibility of %d messages in SQS after %d attempts\n", len(entries), attempts)
+		return nil, nil
+	}
+
+	failedEntries := getFailedEntries(entries, res.Failed)
+	failures.recordResultFailures(res.Failed)
+
+	retryable, senderFaults := partitionSenderFaults(failedEntries, res.Failed)
+	failedRetries, err := q.changeMessageVisibilityBatch(ctx, retryable, retryCount-1, failures, b)
+
+	return withSenderFaults(failedRetries, err, senderFaults)
 }
 
 // getQueueUrl retrieves the URL of an SQS queue based on its name using the provided SQS client.
 //
 // This function fetches the queue URL if it's not already cached within the 'queue' instance.
+// Concurrent callers wait for a single resolution, and a failed resolution is attempted again on the next call.
+//
+// Parameters:
+// - ctx: A context passed to the GetQueueUrl calls.
 //
 // Returns:
 // - queueUrl: A pointer to a string containing the URL of the SQS queue.
 // - err: An error if fetching the queue URL fails after all retry attempts, nil otherwise.
-func (q *queue) getQueueUrl() (queueUrl *string, err error) {
+func (q *queue) getQueueUrl(ctx context.Context) (queueUrl *string, err error) {
+	q.urlMu.Lock()
+	defer q.urlMu.Unlock()
+
 	if q.url != nil {
 		return q.url, nil
 	}
 
-	return q.getQueueUrlWithRetry(q.retryCount)
+	return q.getQueueUrlWithRetry(ctx, q.retryCount)
 }
 
-func (q *queue) getQueueUrlWithRetry(retryCount int) (*string, error) {
+func (q *queue) getQueueUrlWithRetry(ctx context.Context, retryCount int) (*string, error) {
 	if retryCount == 0 {
 		return nil, ErrRetryCountExceeded
 	}
 
-	res, err := q.client.GetQueueUrl(context.Background(), &awssqs.GetQueueUrlInput{
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	res, err := q.client.GetQueueUrl(ctx, &awssqs.GetQueueUrlInput{
 		QueueName: aws.String(q.name),
 	})
 	if err != nil {
-		return q.getQueueUrlWithRetry(retryCount - 1)
+		return q.getQueueUrlWithRetry(ctx, retryCount-1)
 	}
 
 	q.url = res.QueueUrl
@@ -360,13 +695,16 @@ func getRequestAttemptCount(metadata middleware.Metadata) int {
 // managing parallel processing with specified worker count and retry logic.
 //
 // Parameters:
+//   - ctx: A context passed to f. Batches that have not been started when it is canceled are reported
+//     as failed together with the context error.
 //   - batches: A slice of slices, each containing elements of type T. Represents the batches
 //     of operations to be processed concurrently.
 //   - workers: An integer defining the maximum number of goroutines (workers) allowed to run
 //     simultaneously for executing the provided function.
 //   - retryCount: An integer indicating the number of retry attempts permitted for each batch operation.
 //   - f: A function that processes a single batch of elements of type T, given a retry count.
-//     It takes two parameters:
+//     It takes three parameters:
+//   - The context.
 //   - A slice of elements of type T to be processed.
 //   - An integer representing the retry count for the operation.
 //     It returns two values:
@@ -378,7 +716,7 @@ func getRequestAttemptCount(metadata middleware.Metadata) int {
 //     across all batches.
 //   - outerErr: An error variable that holds any errors encountered during the concurrent execution.
 //     It remains nil if no errors occurred during the execution.
-func doConcurrently[T any](batches [][]T, workers int, retryCount int, f func([]T, int) ([]T, error)) ([]T, error) {
+func doConcurrently[T any](ctx context.Context, batches [][]T, workers int, retryCount int, f func(context.Context, []T, int) ([]T, error)) ([]T, error) {
 	if len(batches) == 0 {
 		return nil, nil
 	}
@@ -403,7 +741,13 @@ func doConcurrently[T any](batches [][]T, workers int, retryCount int, f func([]
 		wg.Add(1)
 		go func(b []T) {
 			defer wg.Done()
-			concurrentLimiter <- struct{}{}
+			select {
+			case concurrentLimiter <- struct{}{}:
+			case <-ctx.Done():
+				setErr(ctx.Err())
+				failedEntriesChan <- b
+				return
+			}
 			defer func() { <-concurrentLimiter }()
 			defer func() {
 				if r := recover(); r != nil {
@@ -411,7 +755,7 @@ func doConcurrently[T any](batches [][]T, workers int, retryCount int, f func([]
 					failedEntriesChan <- b
 				}
 			}()
-			fe, err := f(b, retryCount+1)
+			fe, err := f(ctx, b, retryCount+1)
 			if err != nil {
 				setErr(err)
 			}
@@ -1,6 +1,7 @@
 package inssqs
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -162,11 +163,88 @@ func TestNewSQS(t *testing.T) {
 	})
 }
 
+func TestNew(t *testing.T) {
+	t.Run("it_should_return_errors_instead_of_panicking", func(t *testing.T) {
+		_, err := New(Config{QueueName: "q"})
+		assert.ErrorIs(t, err, ErrRegionNotSet)
+
+		_, err = New(Config{Region: "eu-west-1"})
+		assert.ErrorIs(t, err, ErrQueueNameNotSet)
+	})
+
+	t.Run("it_should_resolve_queue_url_lazily_and_cache_it", func(t *testing.T) {
+		setFakeAWSEnv(t)
+		ts, calls := newFakeSQSServer(t, http.StatusOK)
+
+		q, err := New(Config{Region: "eu-west-1", QueueName: "q", EndpointUrl: ts.URL})
+		require.NoError(t, err)
+		assert.Zero(t, atomic.LoadInt32(calls), "New must not call SQS")
+
+		for i := 0; i < 2; i++ {
+			failed, err := q.SendMessageBatch([]SQSMessageEntry{{Id: aws.String("test-id"), MessageBody: aws.String("body")}})
+			require.NoError(t, err)
+			assert.Empty(t, failed)
+		}
+
+		assert.Equal(t, int32(3), atomic.LoadInt32(calls), "queue url should be resolved once")
+	})
+
+	t.Run("it_should_return_entries_as_failed_when_queue_url_cannot_be_resolved", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		client := sqs.NewMockSQS(ctrl)
+		client.EXPECT().GetQueueUrl(gomock.Any(), gomock.Any(), gomock.Any()).Times(3).Return(nil, assert.AnError)
+
+		q, err := New(Config{QueueName: "q"}, WithClient(client), WithLogger(inslogger.NewNopLogger()))
+		require.NoError(t, err)
+
+		failed, err := q.DeleteMessageBatch([]SQSDeleteMessageEntry{{Id: aws.String("test-id")}})
+
+		assert.ErrorIs(t, err, ErrRetryCountExceeded)
+		assert.Contains(t, err.Error(), "error while getting queue url")
+		assert.Len(t, failed, 1)
+
+		t.Run("it_should_try_again_on_next_use", func(t *testing.T) {
+			client.EXPECT().
+				GetQueueUrl(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(&awssqs.GetQueueUrlOutput{QueueUrl: aws.String("test-queue-url")}, nil)
+			client.EXPECT().
+				DeleteMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(&awssqs.DeleteMessageBatchOutput{}, nil)
+
+			failed, err := q.DeleteMessageBatch([]SQSDeleteMessageEntry{{Id: aws.String("test-id")}})
+
+			assert.NoError(t, err)
+			assert.Empty(t, failed)
+		})
+	})
+
+	t.Run("it_should_use_the_region_of_the_given_aws_config", func(t *testing.T) {
+		ts, _ := newFakeSQSServer(t, http.StatusOK)
+
+		q, err := New(Config{QueueName: "q", EndpointUrl: ts.URL}, WithAWSConfig(aws.Config{
+			Region:      "eu-west-1",
+			Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		}))
+		require.NoError(t, err)
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{{Id: aws.String("test-id"), MessageBody: aws.String("body")}})
+
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+	})
+
+	t.Run("it_should_require_a_region_in_the_given_aws_config", func(t *testing.T) {
+		_, err := New(Config{QueueName: "q"}, WithAWSConfig(aws.Config{}))
+
+		assert.ErrorIs(t, err, ErrRegionNotSet)
+	})
+}
+
 func TestQueue_sendMessageBatch_edgeCases(t *testing.T) {
 	t.Run("it_should_return_nil_for_empty_entries", func(t *testing.T) {
 		q, _ := newQueue(t)
 
-		failed, err := q.sendMessageBatch(nil, 3)
+		failed, err := q.sendMessageBatch(context.Background(), nil, 3, nil, backoff{})
 
 		assert.Nil(t, failed)
 		assert.NoError(t, err)
@@ -186,7 +264,7 @@ func TestQueue_deleteMessageBatch_edgeCases(t *testing.T) {
 	t.Run("it_should_return_nil_for_empty_entries", func(t *testing.T) {
 		q, _ := newQueue(t)
 
-		failed, err := q.deleteMessageBatch(nil, 3)
+		failed, err := q.deleteMessageBatch(context.Background(), nil, 3, nil, backoff{})
 
 		assert.Nil(t, failed)
 		assert.NoError(t, err)
@@ -229,9 +307,9 @@ func Test_getRequestAttemptCount_withRealMetadata(t *testing.T) {
 			logger:     inslogger.NewNopLogger(),
 		}
 
-		failed, err := q.sendMessageBatch([]SQSMessageEntry{
+		failed, err := q.sendMessageBatch(context.Background(), []SQSMessageEntry{
 			{Id: aws.String("test-id"), MessageBody: aws.String("body")},
-		}, 3)
+		}, 3, nil, backoff{})
 
 		assert.NoError(t, err)
 		assert.Nil(t, failed)
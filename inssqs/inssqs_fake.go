@@ -1,5 +1,7 @@
 package inssqs
 
+import "context"
+
 type FakeQueue struct {
 	Interface
 	Data []SQSMessageEntry
@@ -10,6 +12,10 @@ func (q *FakeQueue) SendMessageBatch(entries []SQSMessageEntry) (failed []SQSMes
 	return nil, nil
 }
 
+func (q *FakeQueue) SendMessageBatchWithContext(_ context.Context, entries []SQSMessageEntry) (failed []SQSMessageEntry, err error) {
+	return q.SendMessageBatch(entries)
+}
+
 func (q *FakeQueue) DeleteMessageBatch(entries []SQSDeleteMessageEntry) (failed []SQSDeleteMessageEntry, err error) {
 	newData := make([]SQSMessageEntry, 0)
 	for _, e := range q.Data {
@@ -23,3 +29,7 @@ func (q *FakeQueue) DeleteMessageBatch(entries []SQSDeleteMessageEntry) (failed
 	q.Data = newData
 	return nil, nil
 }
+
+func (q *FakeQueue) DeleteMessageBatchWithContext(_ context.Context, entries []SQSDeleteMessageEntry) (failed []SQSDeleteMessageEntry, err error) {
+	return q.DeleteMessageBatch(entries)
+}
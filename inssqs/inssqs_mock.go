@@ -9,6 +9,7 @@
 package inssqs
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
@@ -52,6 +53,21 @@ func (mr *MockInterfaceMockRecorder) DeleteMessageBatch(entries any) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMessageBatch", reflect.TypeOf((*MockInterface)(nil).DeleteMessageBatch), entries)
 }
 
+// DeleteMessageBatchWithContext mocks base method.
+func (m *MockInterface) DeleteMessageBatchWithContext(ctx context.Context, entries []SQSDeleteMessageEntry) ([]SQSDeleteMessageEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMessageBatchWithContext", ctx, entries)
+	ret0, _ := ret[0].([]SQSDeleteMessageEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMessageBatchWithContext indicates an expected call of DeleteMessageBatchWithContext.
+func (mr *MockInterfaceMockRecorder) DeleteMessageBatchWithContext(ctx, entries any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMessageBatchWithContext", reflect.TypeOf((*MockInterface)(nil).DeleteMessageBatchWithContext), ctx, entries)
+}
+
 // SendMessageBatch mocks base method.
 func (m *MockInterface) SendMessageBatch(entries []SQSMessageEntry) ([]SQSMessageEntry, error) {
 	m.ctrl.T.Helper()
@@ -66,3 +82,18 @@ func (mr *MockInterfaceMockRecorder) SendMessageBatch(entries any) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessageBatch", reflect.TypeOf((*MockInterface)(nil).SendMessageBatch), entries)
 }
+
+// SendMessageBatchWithContext mocks base method.
+func (m *MockInterface) SendMessageBatchWithContext(ctx context.Context, entries []SQSMessageEntry) ([]SQSMessageEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendMessageBatchWithContext", ctx, entries)
+	ret0, _ := ret[0].([]SQSMessageEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SendMessageBatchWithContext indicates an expected call of SendMessageBatchWithContext.
+func (mr *MockInterfaceMockRecorder) SendMessageBatchWithContext(ctx, entries any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessageBatchWithContext", reflect.TypeOf((*MockInterface)(nil).SendMessageBatchWithContext), ctx, entries)
+}
@@ -1,6 +1,7 @@
 package inssqs
 
 import (
+	"context"
 	"errors"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
@@ -120,9 +121,91 @@ func TestQueue_DeleteMessageBatch(t *testing.T) {
 	})
 }
 
+func TestQueue_SendMessageBatchWithContext(t *testing.T) {
+	t.Run("should_return_all_entries_as_failed_when_context_is_canceled", func(t *testing.T) {
+		q, client := newQueue(t)
+		client.EXPECT().SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		failed, err := q.SendMessageBatchWithContext(ctx, []SQSMessageEntry{
+			{Id: aws.String("test-id-1")},
+			{Id: aws.String("test-id-2")},
+		})
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Len(t, failed, 2, "all entries should be reported as failed")
+	})
+
+	t.Run("should_not_start_new_batches_after_cancellation", func(t *testing.T) {
+		q, client := newQueue(t)
+		q.maxBatchSize = 1
+		q.maxBatchSizeBytes = 1024
+		q.workers = 1
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(callCtx context.Context, _ *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				assert.Equal(t, ctx, callCtx, "caller context should be passed to the client")
+				cancel()
+				return &awssqs.SendMessageBatchOutput{}, nil
+			}).
+			Times(1)
+
+		failed, err := q.SendMessageBatchWithContext(ctx, []SQSMessageEntry{
+			{Id: aws.String("test-id-1")},
+			{Id: aws.String("test-id-2")},
+		})
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Len(t, failed, 1, "the batch that was not started should be reported as failed")
+	})
+
+	t.Run("should_stop_retrying_when_context_is_canceled", func(t *testing.T) {
+		q, client := newQueue(t)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(context.Context, *awssqs.SendMessageBatchInput, ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				cancel()
+				return nil, assert.AnError
+			}).
+			Times(1)
+
+		failed, err := q.SendMessageBatchWithContext(ctx, []SQSMessageEntry{
+			{Id: aws.String("test-id")},
+		})
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Len(t, failed, 1)
+	})
+}
+
+func TestQueue_DeleteMessageBatchWithContext(t *testing.T) {
+	t.Run("should_return_all_entries_as_failed_when_context_is_canceled", func(t *testing.T) {
+		q, client := newQueue(t)
+		client.EXPECT().DeleteMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		failed, err := q.DeleteMessageBatchWithContext(ctx, []SQSDeleteMessageEntry{
+			{Id: aws.String("test-id")},
+		})
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Len(t, failed, 1)
+	})
+}
+
 func TestQueue_getQueueUrl(t *testing.T) {
 	t.Run("should_return_queue_url_when_successful", func(t *testing.T) {
 		q, client := newQueue(t)
+		q.url = nil
 
 		client.EXPECT().
 			GetQueueUrl(gomock.Any(), gomock.Any(), gomock.Any()).
@@ -130,7 +213,7 @@ func TestQueue_getQueueUrl(t *testing.T) {
 				QueueUrl: aws.String("test-queue-url"),
 			}, nil)
 
-		queueUrl, err := q.getQueueUrl()
+		queueUrl, err := q.getQueueUrl(context.Background())
 
 		assert.Nil(t, err, "err should be nil")
 		assert.Equal(t, queueUrl, aws.String("test-queue-url"), "queue url should be equal to test-queue-url")
@@ -138,7 +221,7 @@ func TestQueue_getQueueUrl(t *testing.T) {
 		t.Run("should_return_queue_url_from_cache_when_called_twice", func(_ *testing.T) {
 			client.EXPECT().GetQueueUrl(gomock.Any(), gomock.Any(), gomock.Any()).Times(0) // should not be called
 
-			queueUrl, err := q.getQueueUrl()
+			queueUrl, err := q.getQueueUrl(context.Background())
 
 			assert.Nil(t, err, "err should be nil")
 			assert.Equal(t, queueUrl, aws.String("test-queue-url"), "queue url should be equal to test-queue-url")
@@ -147,13 +230,14 @@ func TestQueue_getQueueUrl(t *testing.T) {
 
 	t.Run("should_return_error_when_failed", func(t *testing.T) {
 		q, client := newQueue(t)
+		q.url = nil
 
 		client.EXPECT().
 			GetQueueUrl(gomock.Any(), gomock.Any(), gomock.Any()).
 			Times(3).
 			Return(nil, assert.AnError)
 
-		queueUrl, err := q.getQueueUrl()
+		queueUrl, err := q.getQueueUrl(context.Background())
 
 		assert.Error(t, err, "err should not be nil")
 		assert.Nil(t, queueUrl, "queue url should be nil")
@@ -188,6 +272,7 @@ func newQueue(t *testing.T) (queue, *sqs.MockAPI) {
 	return queue{
 		client:     client,
 		name:       "test-queue",
+		url:        aws.String("test-queue-url"),
 		retryCount: 3,
 		logger:     inslogger.NewLogger(inslogger.Debug),
 	}, client
@@ -200,7 +285,7 @@ func Test_doConcurrently(t *testing.T) {
 			batches[i] = []string{"entry"}
 		}
 
-		failed, err := doConcurrently(batches, 8, 0, func(b []string, _ int) ([]string, error) {
+		failed, err := doConcurrently(context.Background(), batches, 8, 0, func(_ context.Context, b []string, _ int) ([]string, error) {
 			time.Sleep(time.Millisecond)
 			return b, errors.New("send failed")
 		})
@@ -212,7 +297,7 @@ func Test_doConcurrently(t *testing.T) {
 	t.Run("should_recover_from_panic_and_mark_batch_failed", func(t *testing.T) {
 		batches := [][]string{{"panic-entry"}, {"ok-entry-1"}, {"ok-entry-2"}}
 
-		failed, err := doConcurrently(batches, 3, 0, func(b []string, _ int) ([]string, error) {
+		failed, err := doConcurrently(context.Background(), batches, 3, 0, func(_ context.Context, b []string, _ int) ([]string, error) {
 			if b[0] == "panic-entry" {
 				panic("boom")
 			}
@@ -228,7 +313,7 @@ func Test_doConcurrently(t *testing.T) {
 	t.Run("should_not_deadlock_when_workers_is_zero", func(t *testing.T) {
 		batches := [][]string{{"a"}, {"b"}}
 
-		failed, err := doConcurrently(batches, 0, 0, func(_ []string, _ int) ([]string, error) {
+		failed, err := doConcurrently(context.Background(), batches, 0, 0, func(_ context.Context, _ []string, _ int) ([]string, error) {
 			return nil, nil
 		})
 
@@ -239,7 +324,7 @@ func Test_doConcurrently(t *testing.T) {
 	t.Run("should_return_no_error_when_all_batches_succeed", func(t *testing.T) {
 		batches := [][]string{{"a"}, {"b"}, {"c"}}
 
-		failed, err := doConcurrently(batches, 2, 0, func(_ []string, _ int) ([]string, error) {
+		failed, err := doConcurrently(context.Background(), batches, 2, 0, func(_ context.Context, _ []string, _ int) ([]string, error) {
 			return nil, nil
 		})
 
@@ -247,3 +332,36 @@ func Test_doConcurrently(t *testing.T) {
 		assert.Empty(t, failed, "no entries should fail")
 	})
 }
+
+func TestSQSMessageEntry_toSendMessageBatchRequestEntry(t *testing.T) {
+	t.Run("should_convert_message_and_system_attributes", func(t *testing.T) {
+		e := SQSMessageEntry{
+			Id:          aws.String("test-id"),
+			MessageBody: aws.String("body"),
+			MessageAttributes: map[string]SQSMessageAttribute{
+				"tenant":  StringAttribute("acme"),
+				"version": NumberAttribute(2),
+				"raw":     BinaryAttribute([]byte{0x01}),
+			},
+			MessageSystemAttributes: map[string]SQSMessageAttribute{
+				"AWSTraceHeader": StringAttribute("Root=1-5759e988-bd862e3fe1be46a994272793"),
+			},
+		}
+
+		converted := e.toSendMessageBatchRequestEntry()
+
+		assert.Equal(t, "String", aws.ToString(converted.MessageAttributes["tenant"].DataType))
+		assert.Equal(t, "acme", aws.ToString(converted.MessageAttributes["tenant"].StringValue))
+		assert.Equal(t, "Number", aws.ToString(converted.MessageAttributes["version"].DataType))
+		assert.Equal(t, "2", aws.ToString(converted.MessageAttributes["version"].StringValue))
+		assert.Equal(t, []byte{0x01}, converted.MessageAttributes["raw"].BinaryValue)
+		assert.Equal(t, "String", aws.ToString(converted.MessageSystemAttributes["AWSTraceHeader"].DataType))
+	})
+
+	t.Run("should_leave_attributes_nil_when_not_set", func(t *testing.T) {
+		converted := SQSMessageEntry{Id: aws.String("test-id")}.toSendMessageBatchRequestEntry()
+
+		assert.Nil(t, converted.MessageAttributes)
+		assert.Nil(t, converted.MessageSystemAttributes)
+	})
+}
@@ -0,0 +1,66 @@
+package inssqs
+
+import (
+	"context"
+	"time"
+)
+
+// Operations reported in BatchResult.
+const (
+	OperationSendMessageBatch             = "SendMessageBatch"
+	OperationDeleteMessageBatch           = "DeleteMessageBatch"
+	OperationChangeMessageVisibilityBatch = "ChangeMessageVisibilityBatch"
+)
+
+// BatchResult describes a single batch request made to SQS.
+type BatchResult struct {
+	Queue     string        // Name of the queue.
+	Operation string        // One of the Operation constants.
+	Entries   int           // Number of entries in the batch.
+	Failed    int           // Number of entries that failed, all of them if the request failed.
+	Bytes     int           // Size of the batch in bytes, as SQS accounts it.
+	Retry     int           // Number of the package-level retry, zero for the first attempt.
+	Attempts  int           // Number of attempts made by the AWS SDK for the request, -1 if unknown.
+	Latency   time.Duration // Duration of the request, including the AWS SDK retries.
+	Err       error         // Error failing the whole request, nil if SQS processed the batch.
+}
+
+// Metrics records the batch requests made by a queue. Implementations must be safe for concurrent use.
+type Metrics interface {
+	RecordBatch(ctx context.Context, result BatchResult)
+}
+
+// MetricsFunc adapts a function to the Metrics interface.
+type MetricsFunc func(ctx context.Context, result BatchResult)
+
+func (f MetricsFunc) RecordBatch(ctx context.Context, result BatchResult) {
+	f(ctx, result)
+}
+
+// recordBatch reports a batch request to the metrics of the queue, if any.
+func recordBatch[T entry](ctx context.Context, q *queue, operation string, entries []T, retry int, start time.Time, attempts int, failed int, err error) {
+	if q.metrics == nil {
+		return
+	}
+
+	bytes := 0
+	for _, e := range entries {
+		bytes += e.size()
+	}
+
+	if err != nil {
+		failed = len(entries)
+	}
+
+	q.metrics.RecordBatch(ctx, BatchResult{
+		Queue:     q.name,
+		Operation: operation,
+		Entries:   len(entries),
+		Failed:    failed,
+		Bytes:     bytes,
+		Retry:     retry,
+		Attempts:  attempts,
+		Latency:   time.Since(start),
+		Err:       err,
+	})
+}
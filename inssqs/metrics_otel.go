@@ -0,0 +1,85 @@
+package inssqs
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type otelMetrics struct {
+	batches       metric.Int64Counter
+	failedEntries metric.Int64Counter
+	retries       metric.Int64Counter
+	attempts      metric.Int64Histogram
+	batchSize     metric.Int64Histogram
+	latency       metric.Float64Histogram
+}
+
+// NewOTelMetrics creates a Metrics implementation recording OpenTelemetry instruments with the given meter.
+// Every measurement has the queue name and the operation as attributes:
+// - inssqs.batches: number of batch requests, with an error attribute telling whether the request failed.
+// - inssqs.entries.failed: number of entries that failed.
+// - inssqs.retries: number of package-level retries.
+// - inssqs.request.attempts: number of AWS SDK attempts per request.
+// - inssqs.batch.size: size of the batches in bytes.
+// - inssqs.batch.duration: duration of the requests in seconds.
+func NewOTelMetrics(meter metric.Meter) (Metrics, error) {
+	m := &otelMetrics{}
+
+	var err error
+	if m.batches, err = meter.Int64Counter("inssqs.batches",
+		metric.WithDescription("Number of batch requests made to SQS.")); err != nil {
+		return nil, errors.Wrap(err, "error while creating batches counter")
+	}
+
+	if m.failedEntries, err = meter.Int64Counter("inssqs.entries.failed",
+		metric.WithDescription("Number of batch entries that failed.")); err != nil {
+		return nil, errors.Wrap(err, "error while creating failed entries counter")
+	}
+
+	if m.retries, err = meter.Int64Counter("inssqs.retries",
+		metric.WithDescription("Number of batch requests retried by inssqs.")); err != nil {
+		return nil, errors.Wrap(err, "error while creating retries counter")
+	}
+
+	if m.attempts, err = meter.Int64Histogram("inssqs.request.attempts",
+		metric.WithDescription("Number of attempts made by the AWS SDK per batch request.")); err != nil {
+		return nil, errors.Wrap(err, "error while creating attempts histogram")
+	}
+
+	if m.batchSize, err = meter.Int64Histogram("inssqs.batch.size",
+		metric.WithDescription("Size of the batches sent to SQS."), metric.WithUnit("By")); err != nil {
+		return nil, errors.Wrap(err, "error while creating batch size histogram")
+	}
+
+	if m.latency, err = meter.Float64Histogram("inssqs.batch.duration",
+		metric.WithDescription("Duration of the batch requests made to SQS."), metric.WithUnit("s")); err != nil {
+		return nil, errors.Wrap(err, "error while creating batch duration histogram")
+	}
+
+	return m, nil
+}
+
+func (m *otelMetrics) RecordBatch(ctx context.Context, result BatchResult) {
+	attrs := metric.WithAttributes(
+		attribute.String("queue", result.Queue),
+		attribute.String("operation", result.Operation),
+	)
+
+	m.batches.Add(ctx, 1, attrs, metric.WithAttributes(attribute.Bool("error", result.Err != nil)))
+	m.batchSize.Record(ctx, int64(result.Bytes), attrs)
+	m.latency.Record(ctx, result.Latency.Seconds(), attrs)
+
+	if result.Failed > 0 {
+		m.failedEntries.Add(ctx, int64(result.Failed), attrs)
+	}
+
+	if result.Retry > 0 {
+		m.retries.Add(ctx, 1, attrs)
+	}
+
+	if result.Attempts >= 0 {
+		m.attempts.Record(ctx, int64(result.Attempts), attrs)
+	}
+}
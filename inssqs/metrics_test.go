@@ -0,0 +1,129 @@
+package inssqs
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/mock/gomock"
+)
+
+type recordingMetrics struct {
+	mu      sync.Mutex
+	results []BatchResult
+}
+
+func (m *recordingMetrics) RecordBatch(_ context.Context, result BatchResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.results = append(m.results, result)
+}
+
+func TestQueue_SendMessageBatch_withMetrics(t *testing.T) {
+	t.Run("it_should_record_every_batch_request", func(t *testing.T) {
+		q, client := newQueue(t)
+		q.maxBatchSize = 10
+		q.maxBatchSizeBytes = 64 * 1024
+		m := &recordingMetrics{}
+		q.metrics = m
+
+		gomock.InOrder(
+			client.EXPECT().SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, assert.AnError),
+			client.EXPECT().SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).Return(&awssqs.SendMessageBatchOutput{
+				Failed: []types.BatchResultErrorEntry{{Id: aws.String("2"), Code: aws.String("InternalError")}},
+			}, nil),
+			client.EXPECT().SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).Return(&awssqs.SendMessageBatchOutput{}, nil),
+		)
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			{Id: aws.String("1"), MessageBody: aws.String("abc")},
+			{Id: aws.String("2"), MessageBody: aws.String("de")},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+		require.Len(t, m.results, 3)
+
+		assert.Equal(t, "test-queue", m.results[0].Queue)
+		assert.Equal(t, OperationSendMessageBatch, m.results[0].Operation)
+		assert.Equal(t, 2, m.results[0].Entries)
+		assert.Equal(t, 2, m.results[0].Failed, "a failed request should fail all entries")
+		assert.Equal(t, 5, m.results[0].Bytes)
+		assert.Equal(t, 0, m.results[0].Retry)
+		assert.Equal(t, -1, m.results[0].Attempts)
+		assert.ErrorIs(t, m.results[0].Err, assert.AnError)
+
+		assert.Equal(t, 1, m.results[1].Retry)
+		assert.Equal(t, 1, m.results[1].Failed)
+		assert.NoError(t, m.results[1].Err)
+
+		assert.Equal(t, 2, m.results[2].Retry)
+		assert.Equal(t, 1, m.results[2].Entries)
+		assert.Equal(t, 2, m.results[2].Bytes)
+		assert.Zero(t, m.results[2].Failed)
+	})
+}
+
+func TestQueue_DeleteMessageBatch_withMetrics(t *testing.T) {
+	t.Run("it_should_record_the_delete_operation", func(t *testing.T) {
+		q, client := newQueue(t)
+		m := &recordingMetrics{}
+		q.metrics = m
+
+		client.EXPECT().DeleteMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).Return(&awssqs.DeleteMessageBatchOutput{}, nil)
+
+		_, err := q.DeleteMessageBatch([]SQSDeleteMessageEntry{{Id: aws.String("1"), ReceiptHandle: aws.String("handle")}})
+
+		require.NoError(t, err)
+		require.Len(t, m.results, 1)
+		assert.Equal(t, OperationDeleteMessageBatch, m.results[0].Operation)
+		assert.Equal(t, 1, m.results[0].Entries)
+	})
+}
+
+func TestNewOTelMetrics(t *testing.T) {
+	t.Run("it_should_record_instruments_per_queue", func(t *testing.T) {
+		reader := metric.NewManualReader()
+		provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+		m, err := NewOTelMetrics(provider.Meter("inssqs"))
+		require.NoError(t, err)
+
+		m.RecordBatch(context.Background(), BatchResult{Queue: "queue", Operation: OperationSendMessageBatch, Entries: 3, Bytes: 30, Attempts: 1})
+		m.RecordBatch(context.Background(), BatchResult{Queue: "queue", Operation: OperationSendMessageBatch, Entries: 1, Failed: 1, Bytes: 10, Retry: 1, Attempts: -1, Err: assert.AnError})
+
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+		require.Len(t, rm.ScopeMetrics, 1)
+
+		metrics := make(map[string]metricdata.Aggregation)
+		for _, metric := range rm.ScopeMetrics[0].Metrics {
+			metrics[metric.Name] = metric.Data
+		}
+
+		batches := metrics["inssqs.batches"].(metricdata.Sum[int64])
+		assert.Len(t, batches.DataPoints, 2, "successful and failed requests should be split by the error attribute")
+
+		assert.Equal(t, int64(1), metrics["inssqs.entries.failed"].(metricdata.Sum[int64]).DataPoints[0].Value)
+		assert.Equal(t, int64(1), metrics["inssqs.retries"].(metricdata.Sum[int64]).DataPoints[0].Value)
+
+		size := metrics["inssqs.batch.size"].(metricdata.Histogram[int64]).DataPoints[0]
+		assert.Equal(t, uint64(2), size.Count)
+		assert.Equal(t, int64(40), size.Sum)
+
+		attempts := metrics["inssqs.request.attempts"].(metricdata.Histogram[int64]).DataPoints[0]
+		assert.Equal(t, uint64(1), attempts.Count, "unknown attempts should not be recorded")
+
+		queue, ok := size.Attributes.Value("queue")
+		require.True(t, ok)
+		assert.Equal(t, "queue", queue.AsString())
+	})
+}
@@ -1,31 +1,139 @@
 package inssqs
 
-import "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
 
 type entry interface {
 	getId() *string
+	// size returns the number of bytes the entry counts towards the batch size limit.
+	size() int
+}
+
+// Data types of message attributes. Custom types can be built by appending a label, e.g. "Number.float".
+const (
+	AttributeDataTypeString = "String"
+	AttributeDataTypeNumber = "Number"
+	AttributeDataTypeBinary = "Binary"
+)
+
+type number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64
+}
+
+// SQSMessageAttribute represents a typed message attribute or message system attribute.
+type SQSMessageAttribute struct {
+	DataType    string
+	StringValue *string
+	BinaryValue []byte
+}
+
+// StringAttribute creates a message attribute of String data type.
+func StringAttribute(v string) SQSMessageAttribute {
+	return SQSMessageAttribute{DataType: AttributeDataTypeString, StringValue: aws.String(v)}
+}
+
+// NumberAttribute creates a message attribute of Number data type.
+func NumberAttribute[T number](v T) SQSMessageAttribute {
+	return SQSMessageAttribute{DataType: AttributeDataTypeNumber, StringValue: aws.String(fmt.Sprint(v))}
+}
+
+// BinaryAttribute creates a message attribute of Binary data type.
+func BinaryAttribute(v []byte) SQSMessageAttribute {
+	return SQSMessageAttribute{DataType: AttributeDataTypeBinary, BinaryValue: v}
+}
+
+// size returns the number of bytes SQS counts for the attribute: its name, data type and value.
+func (a SQSMessageAttribute) size(name string) int {
+	return len(name) + len(a.DataType) + len(aws.ToString(a.StringValue)) + len(a.BinaryValue)
+}
+
+func (a SQSMessageAttribute) toMessageAttributeValue() types.MessageAttributeValue {
+	return types.MessageAttributeValue{
+		DataType:    aws.String(a.DataType),
+		StringValue: a.StringValue,
+		BinaryValue: a.BinaryValue,
+	}
+}
+
+func (a SQSMessageAttribute) toMessageSystemAttributeValue() types.MessageSystemAttributeValue {
+	return types.MessageSystemAttributeValue{
+		DataType:    aws.String(a.DataType),
+		StringValue: a.StringValue,
+		BinaryValue: a.BinaryValue,
+	}
+}
+
+func newSQSMessageAttribute(v types.MessageAttributeValue) SQSMessageAttribute {
+	return SQSMessageAttribute{
+		DataType:    aws.ToString(v.DataType),
+		StringValue: v.StringValue,
+		BinaryValue: v.BinaryValue,
+	}
 }
 
 type SQSMessageEntry struct {
-	Id                     *string
-	MessageBody            *string
-	DelaySeconds           int32
-	MessageDeduplicationId *string
-	MessageGroupId         *string
+	Id                      *string
+	MessageBody             *string
+	DelaySeconds            int32
+	MessageDeduplicationId  *string
+	MessageGroupId          *string
+	MessageAttributes       map[string]SQSMessageAttribute
+	MessageSystemAttributes map[string]SQSMessageAttribute // Only AWSTraceHeader is supported by SQS.
 }
 
 func (e SQSMessageEntry) getId() *string {
 	return e.Id
 }
 
+// size returns the size of the message body and its message attributes, as SQS accounts them.
+func (e SQSMessageEntry) size() int {
+	size := len(aws.ToString(e.MessageBody))
+	for name, a := range e.MessageAttributes {
+		size += a.size(name)
+	}
+
+	return size
+}
+
 func (e SQSMessageEntry) toSendMessageBatchRequestEntry() types.SendMessageBatchRequestEntry {
 	return types.SendMessageBatchRequestEntry{
-		Id:                     e.Id,
-		MessageBody:            e.MessageBody,
-		DelaySeconds:           e.DelaySeconds,
-		MessageDeduplicationId: e.MessageDeduplicationId,
-		MessageGroupId:         e.MessageGroupId,
+		Id:                      e.Id,
+		MessageBody:             e.MessageBody,
+		DelaySeconds:            e.DelaySeconds,
+		MessageDeduplicationId:  e.MessageDeduplicationId,
+		MessageGroupId:          e.MessageGroupId,
+		MessageAttributes:       toMessageAttributeValues(e.MessageAttributes),
+		MessageSystemAttributes: toMessageSystemAttributeValues(e.MessageSystemAttributes),
+	}
+}
+
+func toMessageAttributeValues(attributes map[string]SQSMessageAttribute) map[string]types.MessageAttributeValue {
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	values := make(map[string]types.MessageAttributeValue, len(attributes))
+	for name, a := range attributes {
+		values[name] = a.toMessageAttributeValue()
+	}
+
+	return values
+}
+
+func toMessageSystemAttributeValues(attributes map[string]SQSMessageAttribute) map[string]types.MessageSystemAttributeValue {
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	values := make(map[string]types.MessageSystemAttributeValue, len(attributes))
+	for name, a := range attributes {
+		values[name] = a.toMessageSystemAttributeValue()
 	}
+
+	return values
 }
 
 type SQSDeleteMessageEntry struct {
@@ -37,9 +145,69 @@ func (e SQSDeleteMessageEntry) getId() *string {
 	return e.Id
 }
 
+func (e SQSDeleteMessageEntry) size() int {
+	return len(aws.ToString(e.Id)) + len(aws.ToString(e.ReceiptHandle))
+}
+
 func (e SQSDeleteMessageEntry) toDeleteMessageBatchRequestEntry() types.DeleteMessageBatchRequestEntry {
 	return types.DeleteMessageBatchRequestEntry{
 		Id:            e.Id,
 		ReceiptHandle: e.ReceiptHandle,
 	}
 }
+
+// SQSMessage represents a message received from an SQS queue.
+type SQSMessage struct {
+	MessageId         *string
+	ReceiptHandle     *string
+	Body              *string
+	Attributes        map[string]string // System attributes such as ApproximateReceiveCount and SentTimestamp.
+	MessageAttributes map[string]SQSMessageAttribute
+}
+
+func newSQSMessage(m types.Message) SQSMessage {
+	var attributes map[string]SQSMessageAttribute
+	if len(m.MessageAttributes) > 0 {
+		attributes = make(map[string]SQSMessageAttribute, len(m.MessageAttributes))
+		for name, v := range m.MessageAttributes {
+			attributes[name] = newSQSMessageAttribute(v)
+		}
+	}
+
+	return SQSMessage{
+		MessageId:         m.MessageId,
+		ReceiptHandle:     m.ReceiptHandle,
+		Body:              m.Body,
+		Attributes:        m.Attributes,
+		MessageAttributes: attributes,
+	}
+}
+
+func (m SQSMessage) toDeleteMessageEntry() SQSDeleteMessageEntry {
+	return SQSDeleteMessageEntry{
+		Id:            m.MessageId,
+		ReceiptHandle: m.ReceiptHandle,
+	}
+}
+
+type SQSChangeMessageVisibilityEntry struct {
+	Id                *string
+	ReceiptHandle     *string
+	VisibilityTimeout int32
+}
+
+func (e SQSChangeMessageVisibilityEntry) getId() *string {
+	return e.Id
+}
+
+func (e SQSChangeMessageVisibilityEntry) size() int {
+	return len(aws.ToString(e.Id)) + len(aws.ToString(e.ReceiptHandle))
+}
+
+func (e SQSChangeMessageVisibilityEntry) toChangeMessageVisibilityBatchRequestEntry() types.ChangeMessageVisibilityBatchRequestEntry {
+	return types.ChangeMessageVisibilityBatchRequestEntry{
+		Id:                e.Id,
+		ReceiptHandle:     e.ReceiptHandle,
+		VisibilityTimeout: e.VisibilityTimeout,
+	}
+}
@@ -0,0 +1,67 @@
+package inssqs
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/useinsider/go-pkg/inslogger"
+	"github.com/useinsider/go-pkg/inssqs/sqs"
+)
+
+// Option customizes how New builds a queue.
+type Option func(*options)
+
+type options struct {
+	client    sqs.API
+	logger    inslogger.Interface
+	awsConfig *aws.Config
+}
+
+// WithClient makes the queue use the given SQS client instead of creating one.
+// The region, endpoint and AWS configuration settings are ignored.
+func WithClient(client sqs.API) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithLogger makes the queue use the given logger instead of creating one from the log level.
+func WithLogger(logger inslogger.Interface) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithAWSConfig makes the queue create its SQS client from the given AWS configuration
+// instead of loading the default one. The region of the configuration is used if Config.Region is empty.
+func WithAWSConfig(cfg aws.Config) Option {
+	return func(o *options) {
+		o.awsConfig = &cfg
+	}
+}
+
+// newClient returns the injected SQS client, or creates one from the configuration.
+func (o options) newClient(config Config) (sqs.API, error) {
+	if o.client != nil {
+		return o.client, nil
+	}
+
+	cfg, err := loadAWSConfig(config, o.awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return sqs.NewSQSProxy(awssqs.NewFromConfig(cfg)), nil
+}
+
+// newLogger returns the injected logger, or creates one from the log level of the configuration.
+func (o options) newLogger(config Config) inslogger.Interface {
+	if o.logger != nil {
+		return o.logger
+	}
+
+	if config.LogLevel == "" {
+		return inslogger.NewNopLogger()
+	}
+
+	return inslogger.NewLogger(inslogger.LogLevel(config.LogLevel))
+}
@@ -0,0 +1,277 @@
+package inssqs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultPayloadSizeThreshold is the maximum message size in bytes accepted by SQS, body and attributes included.
+const DefaultPayloadSizeThreshold = 256 * 1024
+
+// payloadPointerAttribute is the reserved message attribute marking pointer messages, holding the payload key.
+// Pointers are detected by this attribute only, so a body that merely looks like a pointer is never resolved.
+const payloadPointerAttribute = "inssqsPayloadPointer"
+
+// PayloadStore stores message bodies that are too large to be sent through SQS.
+// Messages whose body is offloaded carry a small pointer to the stored payload instead.
+// Delete is called once the message of a payload has been deleted by a consumer, and must not fail for unknown keys.
+type PayloadStore interface {
+	Put(ctx context.Context, key string, payload []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type payloadPointer struct {
+	Key  string `json:"key"`
+	Size int    `json:"size"`
+}
+
+type pointerMessage struct {
+	Pointer *payloadPointer `json:"inssqsPayloadPointer"`
+}
+
+// offloadLargePayloads stores the bodies of entries whose size, body and message attributes included, exceeds the
+// payload size threshold and replaces them with pointer messages. Attributes are kept on the pointer messages,
+// which also carry the reserved pointer attribute. Entries already carrying it are pointers and are sent as is.
+//
+// Returns:
+// - ready: A slice of SQSMessageEntry that can be sent, with offloaded bodies replaced by pointers.
+// - failed: A slice of SQSMessageEntry whose body could not be stored, or that have no room left for the pointer attribute.
+// - err: The last error returned by the payload store or ErrAttributeLimitExceeded, nil if every payload was stored.
+func (q *queue) offloadLargePayloads(ctx context.Context, entries []SQSMessageEntry) (ready []SQSMessageEntry, failed []SQSMessageEntry, err error) {
+	if q.payloadStore == nil {
+		return entries, nil, nil
+	}
+
+	ready = make([]SQSMessageEntry, 0, len(entries))
+	for _, e := range entries {
+		size := e.size()
+		if _, ok := e.MessageAttributes[payloadPointerAttribute]; ok || size <= q.payloadSizeThreshold {
+			ready = append(ready, e)
+			continue
+		}
+
+		if len(e.MessageAttributes) >= maxMessageAttributes {
+			q.logger.Errorf("Error offloading payload of %d bytes message %s: %v\n", size, aws.ToString(e.Id), ErrAttributeLimitExceeded)
+			failed = append(failed, e)
+			err = ErrAttributeLimitExceeded
+			continue
+		}
+
+		key, pointer, putErr := q.storePayload(ctx, []byte(aws.ToString(e.MessageBody)))
+		if putErr != nil {
+			q.logger.Errorf("Error offloading payload of %d bytes message %s: %v\n", size, aws.ToString(e.Id), putErr)
+			failed = append(failed, e)
+			err = putErr
+			continue
+		}
+
+		attributes := make(map[string]SQSMessageAttribute, len(e.MessageAttributes)+1)
+		for k, a := range e.MessageAttributes {
+			attributes[k] = a
+		}
+		attributes[payloadPointerAttribute] = StringAttribute(key)
+
+		e.MessageBody = aws.String(pointer)
+		e.MessageAttributes = attributes
+		ready = append(ready, e)
+	}
+
+	return ready, failed, err
+}
+
+// storePayload puts the payload to the store under a random key and returns the key and the pointer message body.
+func (q *queue) storePayload(ctx context.Context, payload []byte) (string, string, error) {
+	key, err := newPayloadKey()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = q.payloadStore.Put(ctx, key, payload); err != nil {
+		return "", "", errors.Wrap(err, "error while storing payload")
+	}
+
+	js, err := json.Marshal(pointerMessage{Pointer: &payloadPointer{Key: key, Size: len(payload)}})
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, string(js), nil
+}
+
+// payloadKey returns the key of the payload a pointer message points to, false if the message is not a pointer.
+func payloadKey(m SQSMessage) (string, bool) {
+	a, ok := m.MessageAttributes[payloadPointerAttribute]
+	if !ok || a.StringValue == nil {
+		return "", false
+	}
+
+	return *a.StringValue, true
+}
+
+// resolvePayload replaces the body of a pointer message with the payload it points to and removes the pointer
+// attribute, so the message can be forwarded as a regular message. Messages that are not pointers are returned unchanged.
+func (q *queue) resolvePayload(ctx context.Context, m SQSMessage) (SQSMessage, error) {
+	key, ok := payloadKey(m)
+	if q.payloadStore == nil || !ok {
+		return m, nil
+	}
+
+	payload, err := q.payloadStore.Get(ctx, key)
+	if err != nil {
+		return m, errors.Wrapf(err, "error while resolving payload %s", key)
+	}
+
+	var attributes map[string]SQSMessageAttribute
+	if len(m.MessageAttributes) > 1 {
+		attributes = make(map[string]SQSMessageAttribute, len(m.MessageAttributes)-1)
+		for k, a := range m.MessageAttributes {
+			if k != payloadPointerAttribute {
+				attributes[k] = a
+			}
+		}
+	}
+
+	m.Body = aws.String(string(payload))
+	m.MessageAttributes = attributes
+
+	return m, nil
+}
+
+// deletePayloads deletes the payloads of the pointer messages among the given messages, except those of the messages
+// that failed to be deleted from the queue. Failures are logged, as the messages are already gone.
+func (q *queue) deletePayloads(ctx context.Context, messages []SQSMessage, failed []SQSDeleteMessageEntry) {
+	if q.payloadStore == nil {
+		return
+	}
+
+	notDeleted := make(map[string]bool, len(failed))
+	for _, e := range failed {
+		notDeleted[aws.ToString(e.Id)] = true
+	}
+
+	for _, m := range messages {
+		key, ok := payloadKey(m)
+		if !ok || notDeleted[aws.ToString(m.MessageId)] {
+			continue
+		}
+
+		if err := q.payloadStore.Delete(ctx, key); err != nil {
+			q.logger.Errorf("Error deleting payload %s of SQS message %s: %v\n", key, aws.ToString(m.MessageId), err)
+		}
+	}
+}
+
+func newPayloadKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "error while generating payload key")
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+type memoryPayloadStore struct {
+	mu       sync.RWMutex
+	payloads map[string][]byte
+}
+
+// NewMemoryPayloadStore creates a PayloadStore keeping payloads in memory, intended for tests.
+func NewMemoryPayloadStore() PayloadStore {
+	return &memoryPayloadStore{payloads: make(map[string][]byte)}
+}
+
+func (s *memoryPayloadStore) Put(_ context.Context, key string, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.payloads[key] = append([]byte(nil), payload...)
+
+	return nil
+}
+
+func (s *memoryPayloadStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payload, ok := s.payloads[key]
+	if !ok {
+		return nil, ErrPayloadNotFound
+	}
+
+	return append([]byte(nil), payload...), nil
+}
+
+func (s *memoryPayloadStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.payloads, key)
+
+	return nil
+}
+
+type filePayloadStore struct {
+	dir string
+}
+
+// NewFilePayloadStore creates a PayloadStore keeping each payload in a file under the given directory.
+func NewFilePayloadStore(dir string) PayloadStore {
+	return &filePayloadStore{dir: dir}
+}
+
+func (s *filePayloadStore) Put(_ context.Context, key string, payload []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, payload, 0o644)
+}
+
+func (s *filePayloadStore) Get(_ context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrPayloadNotFound
+	}
+
+	return payload, err
+}
+
+func (s *filePayloadStore) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// path returns the file path of a key, rejecting keys that would escape the store directory.
+func (s *filePayloadStore) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || key == "." || key == ".." {
+		return "", ErrInvalidPayloadKey
+	}
+
+	return filepath.Join(s.dir, key), nil
+}
@@ -0,0 +1,68 @@
+package inssqs
+
+import (
+	"bytes"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// S3API is the subset of the S3 client used by the S3 payload store, satisfied by *s3.Client.
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+type s3PayloadStore struct {
+	client S3API
+	bucket string
+}
+
+// NewS3PayloadStore creates a PayloadStore keeping each payload as an object in the given S3 bucket.
+// Objects are deleted once their message is deleted by a consumer. Use a bucket lifecycle rule to expire the objects
+// of messages that are never consumed, for example those moved to a dead-letter queue.
+func NewS3PayloadStore(client S3API, bucket string) PayloadStore {
+	return &s3PayloadStore{client: client, bucket: bucket}
+}
+
+func (s *s3PayloadStore) Put(ctx context.Context, key string, payload []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(payload),
+		ContentLength: aws.Int64(int64(len(payload))),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error while putting payload to bucket %s", s.bucket)
+	}
+
+	return nil
+}
+
+func (s *s3PayloadStore) Get(ctx context.Context, key string) ([]byte, error) {
+	res, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error while getting payload from bucket %s", s.bucket)
+	}
+	defer res.Body.Close()
+
+	return io.ReadAll(res.Body)
+}
+
+func (s *s3PayloadStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error while deleting payload from bucket %s", s.bucket)
+	}
+
+	return nil
+}
@@ -0,0 +1,336 @@
+package inssqs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) PutObject(_ context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, _ := io.ReadAll(in.Body)
+	f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = b
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(_ context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, ok := f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)]
+	if !ok {
+		return nil, assert.AnError
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (f *fakeS3) DeleteObject(_ context.Context, in *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.objects, aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key))
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+type failingPayloadStore struct{}
+
+func (failingPayloadStore) Put(context.Context, string, []byte) error {
+	return assert.AnError
+}
+
+func (failingPayloadStore) Get(context.Context, string) ([]byte, error) {
+	return nil, assert.AnError
+}
+
+func (failingPayloadStore) Delete(context.Context, string) error {
+	return assert.AnError
+}
+
+func pointerAttributes(key string) map[string]SQSMessageAttribute {
+	return map[string]SQSMessageAttribute{payloadPointerAttribute: StringAttribute(key)}
+}
+
+func TestPayloadStores(t *testing.T) {
+	stores := map[string]PayloadStore{
+		"memory": NewMemoryPayloadStore(),
+		"file":   NewFilePayloadStore(t.TempDir()),
+		"s3":     NewS3PayloadStore(&fakeS3{objects: map[string][]byte{}}, "bucket"),
+	}
+
+	for name, store := range stores {
+		t.Run(name+"_it_should_return_stored_payload", func(t *testing.T) {
+			require.NoError(t, store.Put(context.Background(), "key", []byte("payload")))
+
+			payload, err := store.Get(context.Background(), "key")
+
+			require.NoError(t, err)
+			assert.Equal(t, []byte("payload"), payload)
+		})
+
+		t.Run(name+"_it_should_not_share_returned_payloads", func(t *testing.T) {
+			require.NoError(t, store.Put(context.Background(), "shared", []byte("payload")))
+
+			payload, err := store.Get(context.Background(), "shared")
+			require.NoError(t, err)
+			payload[0] = 'P'
+
+			payload, err = store.Get(context.Background(), "shared")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("payload"), payload)
+		})
+
+		t.Run(name+"_it_should_fail_for_unknown_key", func(t *testing.T) {
+			_, err := store.Get(context.Background(), "unknown")
+
+			assert.Error(t, err)
+		})
+
+		t.Run(name+"_it_should_delete_stored_payload", func(t *testing.T) {
+			require.NoError(t, store.Put(context.Background(), "deleted", []byte("payload")))
+
+			require.NoError(t, store.Delete(context.Background(), "deleted"))
+			require.NoError(t, store.Delete(context.Background(), "deleted"), "deleting an unknown key should not fail")
+
+			_, err := store.Get(context.Background(), "deleted")
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("file_it_should_reject_keys_escaping_the_directory", func(t *testing.T) {
+		store := NewFilePayloadStore(t.TempDir())
+
+		_, err := store.Get(context.Background(), "../secret")
+		assert.ErrorIs(t, err, ErrInvalidPayloadKey)
+
+		err = store.Delete(context.Background(), "../secret")
+		assert.ErrorIs(t, err, ErrInvalidPayloadKey)
+
+		err = store.Put(context.Background(), "", []byte("payload"))
+		assert.ErrorIs(t, err, ErrInvalidPayloadKey)
+	})
+}
+
+func TestQueue_SendMessageBatch_withPayloadStore(t *testing.T) {
+	t.Run("it_should_offload_large_bodies_and_send_pointers", func(t *testing.T) {
+		q, client := newQueue(t)
+		q.payloadStore = NewMemoryPayloadStore()
+		q.payloadSizeThreshold = 16
+		q.maxBatchSize = 10
+		q.maxBatchSizeBytes = 1024
+
+		large := strings.Repeat("x", 2048)
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				require.Len(t, in.Entries, 2, "pointer should fit in the same batch as the small message")
+				assert.Equal(t, "small", aws.ToString(in.Entries[0].MessageBody))
+				assert.NotContains(t, in.Entries[0].MessageAttributes, payloadPointerAttribute)
+				assert.Contains(t, in.Entries[1].MessageAttributes, payloadPointerAttribute)
+				assert.Contains(t, in.Entries[1].MessageAttributes, "kept", "attributes should be kept on the pointer message")
+
+				attributes := make(map[string]SQSMessageAttribute)
+				for name, v := range in.Entries[1].MessageAttributes {
+					attributes[name] = newSQSMessageAttribute(v)
+				}
+
+				resolved, err := q.resolvePayload(context.Background(), SQSMessage{Body: in.Entries[1].MessageBody, MessageAttributes: attributes})
+				require.NoError(t, err)
+				assert.Equal(t, large, aws.ToString(resolved.Body))
+				assert.Equal(t, map[string]SQSMessageAttribute{"kept": StringAttribute("value")}, resolved.MessageAttributes)
+
+				return &awssqs.SendMessageBatchOutput{}, nil
+			})
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			{Id: aws.String("small"), MessageBody: aws.String("small")},
+			{Id: aws.String("large"), MessageBody: aws.String(large), MessageAttributes: map[string]SQSMessageAttribute{"kept": StringAttribute("value")}},
+		})
+
+		assert.NoError(t, err)
+		assert.Nil(t, failed)
+	})
+
+	t.Run("it_should_fail_entries_without_room_for_the_pointer_attribute", func(t *testing.T) {
+		q, _ := newQueue(t)
+		q.payloadStore = NewMemoryPayloadStore()
+		q.payloadSizeThreshold = 4
+
+		attributes := make(map[string]SQSMessageAttribute, maxMessageAttributes)
+		for i := 0; i < maxMessageAttributes; i++ {
+			attributes["a"+strconv.Itoa(i)] = StringAttribute("v")
+		}
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{{Id: aws.String("1"), MessageBody: aws.String("too large"), MessageAttributes: attributes}})
+
+		assert.ErrorIs(t, err, ErrAttributeLimitExceeded)
+		assert.Len(t, failed, 1)
+	})
+
+	t.Run("it_should_return_entries_that_cannot_be_offloaded_as_failed", func(t *testing.T) {
+		q, client := newQueue(t)
+		q.payloadStore = failingPayloadStore{}
+		q.payloadSizeThreshold = 4
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&awssqs.SendMessageBatchOutput{}, nil)
+
+		failed, err := q.SendMessageBatch([]SQSMessageEntry{
+			{Id: aws.String("small"), MessageBody: aws.String("ok")},
+			{Id: aws.String("large"), MessageBody: aws.String("too large")},
+		})
+
+		assert.ErrorIs(t, err, assert.AnError)
+		require.Len(t, failed, 1)
+		assert.Equal(t, "too large", aws.ToString(failed[0].MessageBody), "failed entry should keep its original body")
+	})
+
+	t.Run("it_should_count_attributes_and_trace_context_towards_the_threshold", func(t *testing.T) {
+		ctx := withTraceContextPropagator(t)
+		q, client := newQueue(t)
+		q.payloadStore = NewMemoryPayloadStore()
+		q.payloadSizeThreshold = 64
+
+		body := strings.Repeat("x", 60)
+
+		client.EXPECT().
+			SendMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, in *awssqs.SendMessageBatchInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+				require.Len(t, in.Entries, 1)
+				assert.Contains(t, in.Entries[0].MessageAttributes, payloadPointerAttribute,
+					"a body under the threshold should be offloaded when its attributes exceed it")
+				assert.Contains(t, in.Entries[0].MessageAttributes, "traceparent")
+
+				return &awssqs.SendMessageBatchOutput{}, nil
+			})
+
+		failed, err := q.SendMessageBatchWithContext(ctx, []SQSMessageEntry{{Id: aws.String("1"), MessageBody: aws.String(body)}})
+
+		assert.NoError(t, err)
+		assert.Nil(t, failed)
+	})
+}
+
+func TestQueue_resolvePayload(t *testing.T) {
+	t.Run("it_should_leave_regular_messages_unchanged", func(t *testing.T) {
+		q, _ := newQueue(t)
+		q.payloadStore = NewMemoryPayloadStore()
+
+		m, err := q.resolvePayload(context.Background(), SQSMessage{Body: aws.String(`{"hello":"world"}`)})
+
+		require.NoError(t, err)
+		assert.Equal(t, `{"hello":"world"}`, aws.ToString(m.Body))
+	})
+
+	t.Run("it_should_not_resolve_bodies_looking_like_pointers", func(t *testing.T) {
+		q, _ := newQueue(t)
+		store := NewMemoryPayloadStore()
+		require.NoError(t, store.Put(context.Background(), "key", []byte("secret")))
+		q.payloadStore = store
+
+		body := `{"inssqsPayloadPointer":{"key":"key","size":6}}`
+		m, err := q.resolvePayload(context.Background(), SQSMessage{Body: aws.String(body)})
+
+		require.NoError(t, err)
+		assert.Equal(t, body, aws.ToString(m.Body))
+	})
+
+	t.Run("it_should_fail_when_payload_is_missing", func(t *testing.T) {
+		q, _ := newQueue(t)
+		q.payloadStore = NewMemoryPayloadStore()
+
+		_, err := q.resolvePayload(context.Background(), SQSMessage{
+			Body:              aws.String(`{"inssqsPayloadPointer":{"key":"missing","size":10}}`),
+			MessageAttributes: pointerAttributes("missing"),
+		})
+
+		assert.ErrorIs(t, err, ErrPayloadNotFound)
+	})
+}
+
+func TestConsumer_Start_withPayloadStore(t *testing.T) {
+	t.Run("it_should_hand_resolved_payloads_to_the_handler", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		q.payloadStore = NewMemoryPayloadStore()
+		q.payloadSizeThreshold = 4
+
+		key, pointer, err := q.storePayload(context.Background(), []byte("large payload"))
+		require.NoError(t, err)
+
+		m := newMessage("1")
+		m.Body = aws.String(pointer)
+		m.MessageAttributes = map[string]types.MessageAttributeValue{payloadPointerAttribute: StringAttribute(key).toMessageAttributeValue()}
+		expectReceive(client, m)
+		recordDeletes(client)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var body string
+
+		c, err := NewConsumer(q, ConsumerConfig{}, func(_ context.Context, m SQSMessage) error {
+			defer cancel()
+			body = aws.ToString(m.Body)
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, c.Start(ctx))
+		assert.Equal(t, "large payload", body)
+
+		_, err = q.payloadStore.Get(context.Background(), key)
+		assert.ErrorIs(t, err, ErrPayloadNotFound, "the payload should be deleted along with its message")
+	})
+
+	t.Run("it_should_keep_payloads_of_messages_that_failed_to_be_deleted", func(t *testing.T) {
+		q, client := newConsumerQueue(t)
+		q.payloadStore = NewMemoryPayloadStore()
+		q.retryCount = 1
+
+		key, pointer, err := q.storePayload(context.Background(), []byte("large payload"))
+		require.NoError(t, err)
+
+		m := newMessage("1")
+		m.Body = aws.String(pointer)
+		m.MessageAttributes = map[string]types.MessageAttributeValue{payloadPointerAttribute: StringAttribute(key).toMessageAttributeValue()}
+		expectReceive(client, m)
+		client.EXPECT().
+			DeleteMessageBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, assert.AnError).
+			AnyTimes()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		c, err := NewConsumer(q, ConsumerConfig{}, func(context.Context, SQSMessage) error {
+			cancel()
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, c.Start(ctx))
+
+		payload, err := q.payloadStore.Get(context.Background(), key)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("large payload"), payload)
+	})
+}
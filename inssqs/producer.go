@@ -0,0 +1,89 @@
+package inssqs
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"strconv"
+)
+
+// ProducerInterface defines the interface for sending typed values to an SQS queue.
+type ProducerInterface[T any] interface {
+	Send(values []T) (failed []T, err error)
+	SendWithContext(ctx context.Context, values []T) (failed []T, err error)
+}
+
+type producer[T any] struct {
+	queue Interface
+	codec Codec[T]
+}
+
+// NewProducer creates a producer that encodes values with the given codec and sends them through the queue.
+func NewProducer[T any](q Interface, codec Codec[T]) ProducerInterface[T] {
+	return &producer[T]{
+		queue: q,
+		codec: codec,
+	}
+}
+
+// Send encodes and sends the values. It is equivalent to SendWithContext with a background context.
+func (p *producer[T]) Send(values []T) ([]T, error) {
+	return p.SendWithContext(context.Background(), values)
+}
+
+// SendWithContext encodes the values and sends them in batches, assigning each message a batch entry id.
+//
+// Parameters:
+// - ctx: A context passed to SendMessageBatchWithContext.
+// - values: A slice of values to be encoded into message bodies.
+//
+// Returns:
+// - failed: A slice of the values that could not be encoded or failed to be sent after all attempts.
+// - err: The encoding or sending error, nil if all values were sent successfully.
+func (p *producer[T]) SendWithContext(ctx context.Context, values []T) ([]T, error) {
+	var failed []T
+	var encodeErr error
+
+	entries := make([]SQSMessageEntry, 0, len(values))
+	for i, v := range values {
+		body, err := p.codec.Encode(v)
+		if err != nil {
+			failed = append(failed, v)
+			encodeErr = err
+			continue
+		}
+
+		entries = append(entries, SQSMessageEntry{
+			Id:          aws.String(strconv.Itoa(i)),
+			MessageBody: aws.String(body),
+		})
+	}
+
+	failedEntries, err := p.queue.SendMessageBatchWithContext(ctx, entries)
+	for _, e := range failedEntries {
+		i, convErr := strconv.Atoi(aws.ToString(e.Id))
+		if convErr != nil || i < 0 || i >= len(values) {
+			continue
+		}
+
+		failed = append(failed, values[i])
+	}
+
+	if err == nil {
+		err = encodeErr
+	}
+
+	return failed, err
+}
+
+// DecodingHandler creates a MessageHandler decoding message bodies with the codec before calling the handler.
+// Messages that cannot be decoded are reported as failed, so they are redelivered or moved to a dead-letter queue.
+func DecodingHandler[T any](codec Codec[T], handler func(ctx context.Context, value T, message SQSMessage) error) MessageHandler {
+	return func(ctx context.Context, message SQSMessage) error {
+		v, err := codec.Decode(aws.ToString(message.Body))
+		if err != nil {
+			return err
+		}
+
+		return handler(ctx, v, message)
+	}
+}
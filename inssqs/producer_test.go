@@ -0,0 +1,79 @@
+package inssqs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestProducer_Send(t *testing.T) {
+	t.Run("it_should_encode_values_and_assign_ids", func(t *testing.T) {
+		q := &FakeQueue{}
+		p := NewProducer[codecTestPayload](q, JSONCodec[codecTestPayload]())
+
+		failed, err := p.Send([]codecTestPayload{{Name: "a"}, {Name: "b"}})
+
+		assert.NoError(t, err)
+		assert.Nil(t, failed)
+		require.Len(t, q.Data, 2)
+		assert.Equal(t, "0", aws.ToString(q.Data[0].Id))
+		assert.Equal(t, "1", aws.ToString(q.Data[1].Id))
+		assert.Equal(t, `{"name":"b","count":0}`, aws.ToString(q.Data[1].MessageBody))
+	})
+
+	t.Run("it_should_return_failed_values", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		q := NewMockInterface(ctrl)
+		p := NewProducer[codecTestPayload](q, JSONCodec[codecTestPayload]())
+
+		q.EXPECT().
+			SendMessageBatchWithContext(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, entries []SQSMessageEntry) ([]SQSMessageEntry, error) {
+				return entries[1:], ErrRetryCountExceeded
+			})
+
+		failed, err := p.Send([]codecTestPayload{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+
+		assert.ErrorIs(t, err, ErrRetryCountExceeded)
+		assert.Equal(t, []codecTestPayload{{Name: "b"}, {Name: "c"}}, failed)
+	})
+
+	t.Run("it_should_return_values_that_cannot_be_encoded", func(t *testing.T) {
+		q := &FakeQueue{}
+		p := NewProducer[any](q, JSONCodec[any]())
+
+		failed, err := p.Send([]any{"ok", make(chan int)})
+
+		assert.Error(t, err)
+		assert.Len(t, failed, 1)
+		assert.Len(t, q.Data, 1)
+	})
+}
+
+func TestDecodingHandler(t *testing.T) {
+	t.Run("it_should_pass_decoded_values_to_the_handler", func(t *testing.T) {
+		var got codecTestPayload
+		handler := DecodingHandler(JSONCodec[codecTestPayload](), func(_ context.Context, v codecTestPayload, _ SQSMessage) error {
+			got = v
+			return nil
+		})
+
+		err := handler(context.Background(), SQSMessage{Body: aws.String(`{"name":"a","count":2}`)})
+
+		assert.NoError(t, err)
+		assert.Equal(t, codecTestPayload{Name: "a", Count: 2}, got)
+	})
+
+	t.Run("it_should_fail_without_calling_the_handler_when_decoding_fails", func(t *testing.T) {
+		handler := DecodingHandler(JSONCodec[codecTestPayload](), func(context.Context, codecTestPayload, SQSMessage) error {
+			t.Fatal("handler should not be called")
+			return nil
+		})
+
+		assert.Error(t, handler(context.Background(), SQSMessage{Body: aws.String("not json")}))
+	})
+}
@@ -0,0 +1,255 @@
+package inssqs
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/useinsider/go-pkg/inslogger"
+	"github.com/useinsider/go-pkg/inssqs/sqs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RouterInterface sends messages to many queues sharing one SQS client.
+type RouterInterface interface {
+	Queue(name string) (Interface, error)
+	SendMessageBatch(ctx context.Context, entries []RoutedEntry) (failed []RoutedEntry, err error)
+}
+
+// RoutedEntry is a message tagged with the name of its destination queue.
+type RoutedEntry struct {
+	QueueName string
+	SQSMessageEntry
+}
+
+// RouterConfig represents the configuration settings of a router.
+type RouterConfig struct {
+	Config Config            // Configuration shared by all queues. QueueName and FIFO are ignored.
+	Queues map[string]Config // Configurations of specific queues, their non-zero fields override Config. QueueName is set from the key.
+}
+
+// RouterError reports the queues a routed batch could not be fully sent to.
+type RouterError struct {
+	Errors map[string]error // Error of every failed queue, keyed by queue name.
+}
+
+func (e *RouterError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e.Errors[name])
+	}
+
+	return fmt.Sprintf("%d queues failed: %s", len(names), strings.Join(msgs, "; "))
+}
+
+// Is reports whether the error of any queue matches target.
+func (e *RouterError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type router struct {
+	config RouterConfig
+	client sqs.API
+	logger inslogger.Interface
+
+	mu     sync.Mutex
+	queues map[string]Interface
+}
+
+// NewRouter creates a router sending messages to many queues with a single SQS client and logger.
+// Queues are created on first use and their URLs are resolved lazily and cached.
+//
+// Parameters:
+// - config: The configuration of the queues. Config.Region is required unless WithClient or WithAWSConfig is given.
+// The region, endpoint and log level of the per-queue configurations are ignored, as the client and logger are shared.
+// - opts: Options injecting an SQS client, a logger or an AWS configuration.
+//
+// Returns:
+// - r: The router.
+// - err: ErrRegionNotSet for an incomplete configuration, or an error if the default AWS configuration cannot be loaded.
+func NewRouter(config RouterConfig, opts ...Option) (RouterInterface, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	shared := config.Config
+	shared.setDefaults()
+
+	client, err := o.newClient(shared)
+	if err != nil {
+		return nil, err
+	}
+
+	return &router{
+		config: config,
+		client: client,
+		logger: o.newLogger(shared),
+		queues: make(map[string]Interface),
+	}, nil
+}
+
+// Queue returns the queue with the given name, creating it on first use.
+//
+// Returns:
+// - q: The queue, sharing the SQS client and logger of the router.
+// - err: ErrQueueNameNotSet if name is empty.
+func (r *router) Queue(name string) (Interface, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if q, ok := r.queues[name]; ok {
+		return q, nil
+	}
+
+	config := mergeConfig(r.config.Config, r.config.Queues[name])
+	config.QueueName = name
+
+	q, err := New(config, WithClient(r.client), WithLogger(r.logger))
+	if err != nil {
+		return nil, err
+	}
+
+	r.queues[name] = q
+
+	return q, nil
+}
+
+// mergeConfig returns the shared configuration with the non-zero fields of a per-queue configuration applied over it.
+// Region, endpoint and log level are not merged, as the client and logger of the router are shared.
+// FIFO is only taken from the per-queue configuration, so that a shared FIFO cannot be forced on standard queues;
+// it is still enabled for queue names ending with .fifo.
+func mergeConfig(shared Config, override Config) Config {
+	config := shared
+	if override.RetryCount != 0 {
+		config.RetryCount = override.RetryCount
+	}
+
+	if override.MaxBatchSize != 0 {
+		config.MaxBatchSize = override.MaxBatchSize
+	}
+
+	if override.MaxBatchSizeBytes != 0 {
+		config.MaxBatchSizeBytes = override.MaxBatchSizeBytes
+	}
+
+	if override.MaxWorkers != 0 {
+		config.MaxWorkers = override.MaxWorkers
+	}
+
+	config.FIFO = override.FIFO
+
+	if override.RetryBaseDelay != 0 {
+		config.RetryBaseDelay = override.RetryBaseDelay
+	}
+
+	if override.RetryMaxDelay != 0 {
+		config.RetryMaxDelay = override.RetryMaxDelay
+	}
+
+	if override.RetryDeadline != 0 {
+		config.RetryDeadline = override.RetryDeadline
+	}
+
+	if override.PayloadStore != nil {
+		config.PayloadStore = override.PayloadStore
+	}
+
+	if override.PayloadSizeThreshold != 0 {
+		config.PayloadSizeThreshold = override.PayloadSizeThreshold
+	}
+
+	if override.DeadLetterSink != nil {
+		config.DeadLetterSink = override.DeadLetterSink
+	}
+
+	if override.Metrics != nil {
+		config.Metrics = override.Metrics
+	}
+
+	return config
+}
+
+// SendMessageBatch sends messages to their destination queues, grouping them by queue
+// and sending the groups concurrently. The order of the messages of a queue is kept.
+//
+// Parameters:
+// - ctx: A context passed to every batch operation.
+// - entries: The messages to send, tagged with their destination queue.
+//
+// Returns:
+// - failed: The messages that could not be sent, in the order their queues first appear in entries.
+// - err: A *RouterError with the error of every queue that failed, nil if all messages were sent successfully.
+func (r *router) SendMessageBatch(ctx context.Context, entries []RoutedEntry) ([]RoutedEntry, error) {
+	var names []string
+	groups := make(map[string][]SQSMessageEntry)
+	for _, e := range entries {
+		if _, ok := groups[e.QueueName]; !ok {
+			names = append(names, e.QueueName)
+		}
+		groups[e.QueueName] = append(groups[e.QueueName], e.SQSMessageEntry)
+	}
+
+	var (
+		mu          sync.Mutex
+		wg          sync.WaitGroup
+		groupFailed = make(map[string][]SQSMessageEntry)
+		errs        = make(map[string]error)
+	)
+
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string, group []SQSMessageEntry) {
+			defer wg.Done()
+
+			failed, err := r.sendGroup(ctx, name, group)
+			if err == nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			groupFailed[name] = failed
+			errs[name] = err
+		}(name, groups[name])
+	}
+
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil, nil
+	}
+
+	var failed []RoutedEntry
+	for _, name := range names {
+		for _, e := range groupFailed[name] {
+			failed = append(failed, RoutedEntry{QueueName: name, SQSMessageEntry: e})
+		}
+	}
+
+	return failed, &RouterError{Errors: errs}
+}
+
+// sendGroup sends the messages of a single queue.
+func (r *router) sendGroup(ctx context.Context, name string, entries []SQSMessageEntry) ([]SQSMessageEntry, error) {
+	q, err := r.Queue(name)
+	if err != nil {
+		return entries, err
+	}
+
+	return q.SendMessageBatchWithContext(ctx, entries)
+}
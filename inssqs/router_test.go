@@ -0,0 +1,167 @@
+package inssqs
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/useinsider/go-pkg/inssqs/sqs"
+)
+
+type countingEmulator struct {
+	*sqs.Emulator
+	urlCalls atomic.Int32
+}
+
+func (e *countingEmulator) GetQueueUrl(ctx context.Context, params *awssqs.GetQueueUrlInput, optFns ...func(*awssqs.Options)) (*awssqs.GetQueueUrlOutput, error) {
+	e.urlCalls.Add(1)
+	return e.Emulator.GetQueueUrl(ctx, params, optFns...)
+}
+
+func routed(queueName string, body string) RoutedEntry {
+	return RoutedEntry{QueueName: queueName, SQSMessageEntry: SQSMessageEntry{Id: aws.String(body), MessageBody: aws.String(body)}}
+}
+
+func TestRouter_SendMessageBatch(t *testing.T) {
+	t.Run("it_should_send_entries_to_their_queues_resolving_urls_once", func(t *testing.T) {
+		e := &countingEmulator{Emulator: sqs.NewEmulator()}
+		e.CreateQueue("a", sqs.QueueConfig{})
+		e.CreateQueue("b", sqs.QueueConfig{})
+
+		r, err := NewRouter(RouterConfig{}, WithClient(e))
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			failed, err := r.SendMessageBatch(context.Background(), []RoutedEntry{
+				routed("a", "a1"), routed("b", "b1"), routed("a", "a2"),
+			})
+
+			require.NoError(t, err)
+			assert.Empty(t, failed)
+		}
+
+		assert.Equal(t, []string{"a1", "a2", "a1", "a2"}, e.Bodies("a"))
+		assert.Equal(t, []string{"b1", "b1"}, e.Bodies("b"))
+		assert.Equal(t, int32(2), e.urlCalls.Load())
+	})
+
+	t.Run("it_should_return_the_entries_of_failed_queues", func(t *testing.T) {
+		e := sqs.NewEmulator()
+		e.CreateQueue("a", sqs.QueueConfig{})
+
+		r, err := NewRouter(RouterConfig{Config: Config{RetryCount: 1}}, WithClient(e))
+		require.NoError(t, err)
+
+		failed, err := r.SendMessageBatch(context.Background(), []RoutedEntry{
+			routed("missing", "m1"), routed("a", "a1"), routed("", "no queue"),
+		})
+
+		var routerErr *RouterError
+		require.ErrorAs(t, err, &routerErr)
+		assert.Len(t, routerErr.Errors, 2)
+		assert.ErrorIs(t, err, ErrQueueNameNotSet)
+		assert.Equal(t, []RoutedEntry{routed("missing", "m1"), routed("", "no queue")}, failed)
+		assert.Equal(t, []string{"a1"}, e.Bodies("a"))
+	})
+}
+
+func TestRouter_Queue(t *testing.T) {
+	t.Run("it_should_apply_per_queue_configuration", func(t *testing.T) {
+		r, err := NewRouter(RouterConfig{
+			Config: Config{MaxWorkers: 2, RetryCount: 7},
+			Queues: map[string]Config{"special": {MaxWorkers: 8}},
+		}, WithClient(sqs.NewEmulator()))
+		require.NoError(t, err)
+
+		special, err := r.Queue("special")
+		require.NoError(t, err)
+		other, err := r.Queue("other")
+		require.NoError(t, err)
+
+		assert.Equal(t, 8, special.(*queue).workers)
+		assert.Equal(t, 7, special.(*queue).retryCount, "shared fields not set for the queue should be kept")
+		assert.Equal(t, "special", special.(*queue).name)
+		assert.Equal(t, 2, other.(*queue).workers)
+		assert.Equal(t, 7, other.(*queue).retryCount)
+
+		again, err := r.Queue("special")
+		require.NoError(t, err)
+		assert.Same(t, special, again)
+	})
+
+	t.Run("it_should_enable_fifo_per_queue", func(t *testing.T) {
+		r, err := NewRouter(RouterConfig{
+			Config: Config{FIFO: true},
+			Queues: map[string]Config{"grouped": {FIFO: true}},
+		}, WithClient(sqs.NewEmulator()))
+		require.NoError(t, err)
+
+		standard, err := r.Queue("standard")
+		require.NoError(t, err)
+		suffixed, err := r.Queue("orders.fifo")
+		require.NoError(t, err)
+		grouped, err := r.Queue("grouped")
+		require.NoError(t, err)
+
+		assert.False(t, standard.(*queue).fifo, "a shared FIFO should not apply to standard queues")
+		assert.True(t, suffixed.(*queue).fifo)
+		assert.True(t, grouped.(*queue).fifo)
+	})
+
+	t.Run("it_should_require_a_region_without_client", func(t *testing.T) {
+		_, err := NewRouter(RouterConfig{})
+
+		assert.ErrorIs(t, err, ErrRegionNotSet)
+	})
+}
+
+func TestMergeConfig(t *testing.T) {
+	// fields taken from the shared configuration only, or set by the router.
+	notMerged := map[string]bool{"Region": true, "QueueName": true, "LogLevel": true, "EndpointUrl": true, "FIFO": true}
+
+	// values of the field types that have no usable non-zero value of their kind.
+	values := map[reflect.Type]interface{}{
+		reflect.TypeOf((*PayloadStore)(nil)).Elem():   NewMemoryPayloadStore(),
+		reflect.TypeOf((*DeadLetterSink)(nil)).Elem(): DeadLetterFunc(func(context.Context, []DeadLetterEntry) error { return nil }),
+		reflect.TypeOf((*Metrics)(nil)).Elem():        MetricsFunc(func(context.Context, BatchResult) {}),
+		reflect.TypeOf(time.Duration(0)):              time.Second,
+	}
+
+	fields := reflect.TypeOf(Config{})
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if notMerged[field.Name] {
+			continue
+		}
+
+		t.Run(field.Name, func(t *testing.T) {
+			var override Config
+			v := reflect.ValueOf(&override).Elem().Field(i)
+			if value, ok := values[field.Type]; ok {
+				v.Set(reflect.ValueOf(value))
+			} else {
+				switch v.Kind() {
+				case reflect.Int, reflect.Int32, reflect.Int64:
+					v.SetInt(1)
+				case reflect.String:
+					v.SetString("override")
+				case reflect.Bool:
+					v.SetBool(true)
+				default:
+					t.Fatalf("no test value for Config.%s of type %s", field.Name, field.Type)
+				}
+			}
+
+			merged := mergeConfig(Config{}, override)
+
+			assert.False(t, reflect.ValueOf(merged).Field(i).IsZero(),
+				"Config.%s should be merged by mergeConfig, or listed as not merged", field.Name)
+		})
+	}
+}
@@ -0,0 +1,606 @@
+package sqs
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations passed to a FailureInjector.
+const (
+	OperationSendMessageBatch             = "SendMessageBatch"
+	OperationDeleteMessageBatch           = "DeleteMessageBatch"
+	OperationChangeMessageVisibilityBatch = "ChangeMessageVisibilityBatch"
+)
+
+const (
+	emulatorUrlPrefix          = "https://sqs.emulator.local/000000000000/"
+	defaultVisibilityTimeout   = 30 * time.Second
+	deduplicationInterval      = 5 * time.Minute
+	maxBatchEntries            = 10
+	longPollingCheckInterval   = 10 * time.Millisecond
+	defaultMaxNumberOfMessages = 1
+)
+
+// FailureInjector decides whether an entry of a batch operation fails. Returning nil lets the entry be processed,
+// returning an error entry makes it fail with the given code and sender fault, its Id is set by the emulator.
+type FailureInjector func(operation string, entryId string) *types.BatchResultErrorEntry
+
+// QueueConfig represents the configuration of an emulated queue.
+type QueueConfig struct {
+	VisibilityTimeout         time.Duration // Default visibility timeout of received messages, 30 seconds if zero.
+	Delay                     time.Duration // Time new messages stay invisible after being sent.
+	ContentBasedDeduplication bool          // Whether FIFO messages without deduplication id are deduplicated by body.
+	DeadLetterQueue           string        // Name of the queue receiving messages received more than MaxReceiveCount times.
+	MaxReceiveCount           int           // Number of receives after which a message is moved to the DeadLetterQueue.
+}
+
+// Emulator is an in-memory implementation of API with SQS queue semantics, meant for tests.
+// It supports visibility timeouts, receive counts, redrive to dead-letter queues, FIFO message groups
+// and deduplication, delays, long polling and failure injection for batch entries.
+// Queue names ending with .fifo create FIFO queues. The emulator clock can be moved forward with Advance.
+type Emulator struct {
+	mu       sync.Mutex
+	queues   map[string]*emulatedQueue // Queues by url.
+	handles  map[string]*emulatedMessage
+	offset   time.Duration
+	seq      int
+	injector FailureInjector
+}
+
+type emulatedQueue struct {
+	name     string
+	url      string
+	fifo     bool
+	config   QueueConfig
+	messages []*emulatedMessage
+	dedup    map[string]dedupRecord
+}
+
+type dedupRecord struct {
+	messageId string
+	sentAt    time.Time
+}
+
+type emulatedMessage struct {
+	queue           *emulatedQueue
+	id              string
+	body            string
+	attributes      map[string]types.MessageAttributeValue
+	groupId         string
+	deduplicationId string
+	sequenceNumber  string
+	sentAt          time.Time
+	visibleAt       time.Time
+	receiveCount    int
+	firstReceivedAt time.Time
+	receiptHandle   string // Handle of the latest receive, empty if the message was never received.
+}
+
+// NewEmulator creates an emulator without queues.
+func NewEmulator() *Emulator {
+	return &Emulator{
+		queues:  make(map[string]*emulatedQueue),
+		handles: make(map[string]*emulatedMessage),
+	}
+}
+
+// CreateQueue creates a queue, or replaces the configuration of an existing one, and returns its url.
+func (e *Emulator) CreateQueue(name string, config QueueConfig) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if config.VisibilityTimeout == 0 {
+		config.VisibilityTimeout = defaultVisibilityTimeout
+	}
+
+	url := emulatorUrlPrefix + name
+	if q, ok := e.queues[url]; ok {
+		q.config = config
+		return url
+	}
+
+	e.queues[url] = &emulatedQueue{
+		name:   name,
+		url:    url,
+		fifo:   strings.HasSuffix(name, ".fifo"),
+		config: config,
+		dedup:  make(map[string]dedupRecord),
+	}
+
+	return url
+}
+
+// InjectFailures sets the injector deciding which batch entries fail, nil disables failure injection.
+func (e *Emulator) InjectFailures(injector FailureInjector) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.injector = injector
+}
+
+// Advance moves the emulator clock forward, making delayed and in-flight messages visible as time passes.
+func (e *Emulator) Advance(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.offset += d
+}
+
+// Bodies returns the bodies of all messages stored in a queue, including in-flight and delayed ones, in send order.
+func (e *Emulator) Bodies(name string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, ok := e.queues[emulatorUrlPrefix+name]
+	if !ok {
+		return nil
+	}
+
+	bodies := make([]string, len(q.messages))
+	for i, m := range q.messages {
+		bodies[i] = m.body
+	}
+
+	return bodies
+}
+
+func (e *Emulator) now() time.Time {
+	return time.Now().Add(e.offset)
+}
+
+func (e *Emulator) nextId(prefix string) string {
+	e.seq++
+	return prefix + "-" + strconv.Itoa(e.seq)
+}
+
+func (e *Emulator) queue(url *string) (*emulatedQueue, error) {
+	q, ok := e.queues[aws.ToString(url)]
+	if !ok {
+		return nil, &types.QueueDoesNotExist{Message: aws.String("The specified queue does not exist.")}
+	}
+
+	return q, nil
+}
+
+// injectedFailure returns the injected failure of an entry, nil if the entry should be processed.
+func (e *Emulator) injectedFailure(operation string, id *string) *types.BatchResultErrorEntry {
+	if e.injector == nil {
+		return nil
+	}
+
+	f := e.injector(operation, aws.ToString(id))
+	if f == nil {
+		return nil
+	}
+
+	failure := *f
+	failure.Id = id
+
+	return &failure
+}
+
+func validateBatchIds(ids []*string) error {
+	if len(ids) == 0 {
+		return &types.EmptyBatchRequest{Message: aws.String("There should be at least one entry in the request.")}
+	}
+
+	if len(ids) > maxBatchEntries {
+		return &types.TooManyEntriesInBatchRequest{Message: aws.String("Maximum number of entries per request are 10.")}
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[aws.ToString(id)] {
+			return &types.BatchEntryIdsNotDistinct{Message: aws.String("Id " + aws.ToString(id) + " repeated.")}
+		}
+
+		seen[aws.ToString(id)] = true
+	}
+
+	return nil
+}
+
+func senderFault(id *string, code, message string) types.BatchResultErrorEntry {
+	return types.BatchResultErrorEntry{Id: id, Code: aws.String(code), Message: aws.String(message), SenderFault: true}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (e *Emulator) GetQueueUrl(_ context.Context, params *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, err := e.queue(aws.String(emulatorUrlPrefix + aws.ToString(params.QueueName)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String(q.url)}, nil
+}
+
+func (e *Emulator) SendMessageBatch(_ context.Context, params *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, err := e.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(params.Entries))
+	for i, entry := range params.Entries {
+		ids[i] = entry.Id
+	}
+
+	if err = validateBatchIds(ids); err != nil {
+		return nil, err
+	}
+
+	out := &sqs.SendMessageBatchOutput{}
+	now := e.now()
+	for _, entry := range params.Entries {
+		if f := e.injectedFailure(OperationSendMessageBatch, entry.Id); f != nil {
+			out.Failed = append(out.Failed, *f)
+			continue
+		}
+
+		res, failure := e.send(q, entry, now)
+		if failure != nil {
+			out.Failed = append(out.Failed, *failure)
+			continue
+		}
+
+		out.Successful = append(out.Successful, res)
+	}
+
+	return out, nil
+}
+
+// send stores a message in the queue, or returns the stored message for a duplicate FIFO message.
+func (e *Emulator) send(q *emulatedQueue, entry types.SendMessageBatchRequestEntry, now time.Time) (types.SendMessageBatchResultEntry, *types.BatchResultErrorEntry) {
+	body := aws.ToString(entry.MessageBody)
+	if body == "" {
+		f := senderFault(entry.Id, "MissingParameter", "The request must contain the parameter MessageBody.")
+		return types.SendMessageBatchResultEntry{}, &f
+	}
+
+	m := &emulatedMessage{
+		queue:      q,
+		body:       body,
+		attributes: entry.MessageAttributes,
+		sentAt:     now,
+		visibleAt:  now.Add(q.config.Delay),
+	}
+
+	if q.fifo {
+		if entry.MessageGroupId == nil {
+			f := senderFault(entry.Id, "MissingParameter", "The request must contain the parameter MessageGroupId.")
+			return types.SendMessageBatchResultEntry{}, &f
+		}
+
+		m.groupId = aws.ToString(entry.MessageGroupId)
+		m.deduplicationId = aws.ToString(entry.MessageDeduplicationId)
+		if m.deduplicationId == "" {
+			if !q.config.ContentBasedDeduplication {
+				f := senderFault(entry.Id, "InvalidParameterValue",
+					"The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly.")
+				return types.SendMessageBatchResultEntry{}, &f
+			}
+
+			sum := sha256.Sum256([]byte(body))
+			m.deduplicationId = hex.EncodeToString(sum[:])
+		}
+
+		if d, ok := q.dedup[m.deduplicationId]; ok && now.Sub(d.sentAt) < deduplicationInterval {
+			return types.SendMessageBatchResultEntry{
+				Id:               entry.Id,
+				MessageId:        aws.String(d.messageId),
+				MD5OfMessageBody: aws.String(md5Hex(body)),
+			}, nil
+		}
+	} else if entry.DelaySeconds > 0 {
+		m.visibleAt = now.Add(time.Duration(entry.DelaySeconds) * time.Second)
+	}
+
+	m.id = e.nextId("message")
+	if q.fifo {
+		m.sequenceNumber = fmt.Sprintf("%020d", e.seq)
+		q.dedup[m.deduplicationId] = dedupRecord{messageId: m.id, sentAt: now}
+	}
+
+	q.messages = append(q.messages, m)
+
+	return types.SendMessageBatchResultEntry{
+		Id:               entry.Id,
+		MessageId:        aws.String(m.id),
+		MD5OfMessageBody: aws.String(md5Hex(body)),
+		SequenceNumber:   stringOrNil(m.sequenceNumber),
+	}, nil
+}
+
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return aws.String(s)
+}
+
+// ReceiveMessage receives visible messages, waiting up to WaitTimeSeconds for messages to become visible.
+// Messages received more than MaxReceiveCount times are moved to the dead-letter queue instead of being returned.
+// From a FIFO queue, no message of a group with an in-flight message is returned.
+func (e *Emulator) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	wait := time.NewTimer(time.Duration(params.WaitTimeSeconds) * time.Second)
+	defer wait.Stop()
+
+	ticker := time.NewTicker(longPollingCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		messages, err := e.receive(params)
+		if err != nil || len(messages) > 0 || params.WaitTimeSeconds == 0 {
+			return &sqs.ReceiveMessageOutput{Messages: messages}, err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wait.C:
+			return &sqs.ReceiveMessageOutput{}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (e *Emulator) receive(params *sqs.ReceiveMessageInput) ([]types.Message, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, err := e.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	max := int(params.MaxNumberOfMessages)
+	if max == 0 {
+		max = defaultMaxNumberOfMessages
+	}
+
+	visibilityTimeout := q.config.VisibilityTimeout
+	if params.VisibilityTimeout > 0 {
+		visibilityTimeout = time.Duration(params.VisibilityTimeout) * time.Second
+	}
+
+	now := e.now()
+	blockedGroups := make(map[string]bool)
+	var received []types.Message
+	for _, m := range append([]*emulatedMessage(nil), q.messages...) {
+		if len(received) == max {
+			break
+		}
+
+		if q.fifo && blockedGroups[m.groupId] {
+			continue
+		}
+
+		if now.Before(m.visibleAt) {
+			if q.fifo && m.receiptHandle != "" {
+				blockedGroups[m.groupId] = true
+			}
+
+			continue
+		}
+
+		if e.redrive(q, m) {
+			continue
+		}
+
+		delete(e.handles, m.receiptHandle)
+		m.receiveCount++
+		m.receiptHandle = e.nextId("receipt")
+		m.visibleAt = now.Add(visibilityTimeout)
+		if m.firstReceivedAt.IsZero() {
+			m.firstReceivedAt = now
+		}
+
+		e.handles[m.receiptHandle] = m
+		received = append(received, m.toMessage(params))
+	}
+
+	return received, nil
+}
+
+// redrive moves a message that reached the max receive count to the dead-letter queue of its queue.
+func (e *Emulator) redrive(q *emulatedQueue, m *emulatedMessage) bool {
+	if q.config.DeadLetterQueue == "" || q.config.MaxReceiveCount <= 0 || m.receiveCount < q.config.MaxReceiveCount {
+		return false
+	}
+
+	dlq, ok := e.queues[emulatorUrlPrefix+q.config.DeadLetterQueue]
+	if !ok {
+		return false
+	}
+
+	q.remove(m)
+	delete(e.handles, m.receiptHandle)
+	m.queue = dlq
+	m.receiptHandle = ""
+	m.visibleAt = e.now()
+	dlq.messages = append(dlq.messages, m)
+
+	return true
+}
+
+func (q *emulatedQueue) remove(m *emulatedMessage) {
+	for i, candidate := range q.messages {
+		if candidate == m {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m *emulatedMessage) toMessage(params *sqs.ReceiveMessageInput) types.Message {
+	msg := types.Message{
+		MessageId:     aws.String(m.id),
+		ReceiptHandle: aws.String(m.receiptHandle),
+		Body:          aws.String(m.body),
+		MD5OfBody:     aws.String(md5Hex(m.body)),
+	}
+
+	if len(params.AttributeNames) > 0 {
+		msg.Attributes = map[string]string{
+			"ApproximateReceiveCount":          strconv.Itoa(m.receiveCount),
+			"SentTimestamp":                    strconv.FormatInt(m.sentAt.UnixMilli(), 10),
+			"ApproximateFirstReceiveTimestamp": strconv.FormatInt(m.firstReceivedAt.UnixMilli(), 10),
+		}
+
+		if m.queue.fifo {
+			msg.Attributes["MessageGroupId"] = m.groupId
+			msg.Attributes["MessageDeduplicationId"] = m.deduplicationId
+			msg.Attributes["SequenceNumber"] = m.sequenceNumber
+		}
+	}
+
+	for _, name := range params.MessageAttributeNames {
+		for attrName, v := range m.attributes {
+			if name == "All" || name == ".*" || name == attrName || (strings.HasSuffix(name, ".*") && strings.HasPrefix(attrName, strings.TrimSuffix(name, "*"))) {
+				if msg.MessageAttributes == nil {
+					msg.MessageAttributes = make(map[string]types.MessageAttributeValue)
+				}
+
+				msg.MessageAttributes[attrName] = v
+			}
+		}
+	}
+
+	return msg
+}
+
+func (e *Emulator) DeleteMessageBatch(_ context.Context, params *sqs.DeleteMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, err := e.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(params.Entries))
+	for i, entry := range params.Entries {
+		ids[i] = entry.Id
+	}
+
+	if err = validateBatchIds(ids); err != nil {
+		return nil, err
+	}
+
+	out := &sqs.DeleteMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		if f := e.injectedFailure(OperationDeleteMessageBatch, entry.Id); f != nil {
+			out.Failed = append(out.Failed, *f)
+			continue
+		}
+
+		m, ok := e.handles[aws.ToString(entry.ReceiptHandle)]
+		if !ok || m.queue != q {
+			out.Failed = append(out.Failed, senderFault(entry.Id, "ReceiptHandleIsInvalid", "The input receipt handle is invalid."))
+			continue
+		}
+
+		q.remove(m)
+		delete(e.handles, m.receiptHandle)
+		out.Successful = append(out.Successful, types.DeleteMessageBatchResultEntry{Id: entry.Id})
+	}
+
+	return out, nil
+}
+
+func (e *Emulator) ChangeMessageVisibility(_ context.Context, params *sqs.ChangeMessageVisibilityInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, err := e.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if f := e.changeVisibility(q, params.ReceiptHandle, params.VisibilityTimeout, nil); f != nil {
+		if aws.ToString(f.Code) == "MessageNotInflight" {
+			return nil, &types.MessageNotInflight{Message: f.Message}
+		}
+
+		return nil, &types.ReceiptHandleIsInvalid{Message: f.Message}
+	}
+
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (e *Emulator) ChangeMessageVisibilityBatch(_ context.Context, params *sqs.ChangeMessageVisibilityBatchInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, err := e.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(params.Entries))
+	for i, entry := range params.Entries {
+		ids[i] = entry.Id
+	}
+
+	if err = validateBatchIds(ids); err != nil {
+		return nil, err
+	}
+
+	out := &sqs.ChangeMessageVisibilityBatchOutput{}
+	for _, entry := range params.Entries {
+		if f := e.injectedFailure(OperationChangeMessageVisibilityBatch, entry.Id); f != nil {
+			out.Failed = append(out.Failed, *f)
+			continue
+		}
+
+		if f := e.changeVisibility(q, entry.ReceiptHandle, entry.VisibilityTimeout, entry.Id); f != nil {
+			out.Failed = append(out.Failed, *f)
+			continue
+		}
+
+		out.Successful = append(out.Successful, types.ChangeMessageVisibilityBatchResultEntry{Id: entry.Id})
+	}
+
+	return out, nil
+}
+
+// changeVisibility makes an in-flight message visible after the timeout, returning a failure for an unknown
+// receipt handle or a message that is not in flight anymore.
+func (e *Emulator) changeVisibility(q *emulatedQueue, receiptHandle *string, timeout int32, id *string) *types.BatchResultErrorEntry {
+	m, ok := e.handles[aws.ToString(receiptHandle)]
+	if !ok || m.queue != q {
+		f := senderFault(id, "ReceiptHandleIsInvalid", "The input receipt handle is invalid.")
+		return &f
+	}
+
+	now := e.now()
+	if !now.Before(m.visibleAt) {
+		f := senderFault(id, "MessageNotInflight", "The message referred to is not in flight.")
+		return &f
+	}
+
+	m.visibleAt = now.Add(time.Duration(timeout) * time.Second)
+
+	return nil
+}
@@ -0,0 +1,275 @@
+package sqs
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ API = (*Emulator)(nil)
+
+func sendBodies(t *testing.T, e *Emulator, url string, group string, bodies ...string) *awssqs.SendMessageBatchOutput {
+	t.Helper()
+
+	entries := make([]types.SendMessageBatchRequestEntry, len(bodies))
+	for i, body := range bodies {
+		entries[i] = types.SendMessageBatchRequestEntry{Id: aws.String(strconv.Itoa(i)), MessageBody: aws.String(body)}
+		if group != "" {
+			entries[i].MessageGroupId = aws.String(group)
+		}
+	}
+
+	out, err := e.SendMessageBatch(context.Background(), &awssqs.SendMessageBatchInput{QueueUrl: aws.String(url), Entries: entries})
+	require.NoError(t, err)
+
+	return out
+}
+
+func receive(t *testing.T, e *Emulator, url string, max int32) []types.Message {
+	t.Helper()
+
+	out, err := e.ReceiveMessage(context.Background(), &awssqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(url),
+		MaxNumberOfMessages: max,
+		AttributeNames:      []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	require.NoError(t, err)
+
+	return out.Messages
+}
+
+func bodiesOf(messages []types.Message) []string {
+	bodies := make([]string, len(messages))
+	for i, m := range messages {
+		bodies[i] = aws.ToString(m.Body)
+	}
+
+	return bodies
+}
+
+func TestEmulator_GetQueueUrl(t *testing.T) {
+	t.Run("it_should_return_the_url_of_a_created_queue", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue", QueueConfig{})
+
+		out, err := e.GetQueueUrl(context.Background(), &awssqs.GetQueueUrlInput{QueueName: aws.String("queue")})
+
+		require.NoError(t, err)
+		assert.Equal(t, url, aws.ToString(out.QueueUrl))
+	})
+
+	t.Run("it_should_fail_for_unknown_queues", func(t *testing.T) {
+		_, err := NewEmulator().GetQueueUrl(context.Background(), &awssqs.GetQueueUrlInput{QueueName: aws.String("unknown")})
+
+		var notFound *types.QueueDoesNotExist
+		assert.ErrorAs(t, err, &notFound)
+	})
+}
+
+func TestEmulator_SendMessageBatch(t *testing.T) {
+	t.Run("it_should_reject_invalid_batches", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue", QueueConfig{})
+
+		_, err := e.SendMessageBatch(context.Background(), &awssqs.SendMessageBatchInput{QueueUrl: aws.String(url)})
+		var empty *types.EmptyBatchRequest
+		assert.ErrorAs(t, err, &empty)
+
+		_, err = e.SendMessageBatch(context.Background(), &awssqs.SendMessageBatchInput{
+			QueueUrl: aws.String(url),
+			Entries: []types.SendMessageBatchRequestEntry{
+				{Id: aws.String("1"), MessageBody: aws.String("a")},
+				{Id: aws.String("1"), MessageBody: aws.String("b")},
+			},
+		})
+		var notDistinct *types.BatchEntryIdsNotDistinct
+		assert.ErrorAs(t, err, &notDistinct)
+	})
+
+	t.Run("it_should_fail_injected_entries_only", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue", QueueConfig{})
+		e.InjectFailures(func(operation string, entryId string) *types.BatchResultErrorEntry {
+			if operation == OperationSendMessageBatch && entryId == "1" {
+				return &types.BatchResultErrorEntry{Code: aws.String("InternalError")}
+			}
+
+			return nil
+		})
+
+		out := sendBodies(t, e, url, "", "a", "b")
+
+		require.Len(t, out.Failed, 1)
+		assert.Equal(t, "1", aws.ToString(out.Failed[0].Id))
+		assert.Equal(t, "InternalError", aws.ToString(out.Failed[0].Code))
+		assert.Equal(t, []string{"a"}, e.Bodies("queue"))
+	})
+
+	t.Run("it_should_keep_delayed_messages_invisible", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue", QueueConfig{Delay: time.Minute})
+		sendBodies(t, e, url, "", "a")
+
+		assert.Empty(t, receive(t, e, url, 10))
+
+		e.Advance(time.Minute)
+		assert.Equal(t, []string{"a"}, bodiesOf(receive(t, e, url, 10)))
+	})
+}
+
+func TestEmulator_ReceiveMessage(t *testing.T) {
+	t.Run("it_should_redeliver_messages_after_visibility_timeout", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue", QueueConfig{VisibilityTimeout: 30 * time.Second})
+		sendBodies(t, e, url, "", "a")
+
+		first := receive(t, e, url, 10)
+		require.Len(t, first, 1)
+		assert.Equal(t, "1", first[0].Attributes["ApproximateReceiveCount"])
+		assert.Empty(t, receive(t, e, url, 10), "in-flight messages should be invisible")
+
+		e.Advance(30 * time.Second)
+		second := receive(t, e, url, 10)
+		require.Len(t, second, 1)
+		assert.Equal(t, "2", second[0].Attributes["ApproximateReceiveCount"])
+		assert.NotEqual(t, aws.ToString(first[0].ReceiptHandle), aws.ToString(second[0].ReceiptHandle))
+	})
+
+	t.Run("it_should_move_messages_to_dead_letter_queue_after_max_receives", func(t *testing.T) {
+		e := NewEmulator()
+		e.CreateQueue("dlq", QueueConfig{})
+		url := e.CreateQueue("queue", QueueConfig{DeadLetterQueue: "dlq", MaxReceiveCount: 2})
+		sendBodies(t, e, url, "", "poison")
+
+		for i := 0; i < 2; i++ {
+			require.Len(t, receive(t, e, url, 10), 1)
+			e.Advance(time.Minute)
+		}
+
+		assert.Empty(t, receive(t, e, url, 10))
+		assert.Empty(t, e.Bodies("queue"))
+		assert.Equal(t, []string{"poison"}, e.Bodies("dlq"))
+	})
+
+	t.Run("it_should_not_deliver_a_fifo_group_with_a_message_in_flight", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue.fifo", QueueConfig{ContentBasedDeduplication: true})
+		sendBodies(t, e, url, "a", "a1", "a2")
+		sendBodies(t, e, url, "b", "b1")
+
+		assert.Equal(t, []string{"a1"}, bodiesOf(receive(t, e, url, 1)))
+		assert.Equal(t, []string{"b1"}, bodiesOf(receive(t, e, url, 10)), "group a is blocked by a1 in flight")
+	})
+
+	t.Run("it_should_deduplicate_fifo_messages", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue.fifo", QueueConfig{ContentBasedDeduplication: true})
+
+		first := sendBodies(t, e, url, "a", "same")
+		second := sendBodies(t, e, url, "a", "same")
+
+		assert.Equal(t, aws.ToString(first.Successful[0].MessageId), aws.ToString(second.Successful[0].MessageId))
+		assert.Equal(t, []string{"same"}, e.Bodies("queue.fifo"))
+	})
+
+	t.Run("it_should_require_fifo_parameters", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue.fifo", QueueConfig{})
+
+		out := sendBodies(t, e, url, "", "no group")
+		require.Len(t, out.Failed, 1)
+		assert.True(t, out.Failed[0].SenderFault)
+
+		out = sendBodies(t, e, url, "a", "no deduplication id")
+		require.Len(t, out.Failed, 1)
+		assert.Equal(t, "InvalidParameterValue", aws.ToString(out.Failed[0].Code))
+	})
+
+	t.Run("it_should_wait_for_messages_when_long_polling", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue", QueueConfig{})
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			sendBodies(t, e, url, "", "late")
+		}()
+
+		out, err := e.ReceiveMessage(context.Background(), &awssqs.ReceiveMessageInput{QueueUrl: aws.String(url), WaitTimeSeconds: 1})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"late"}, bodiesOf(out.Messages))
+	})
+}
+
+func TestEmulator_DeleteMessageBatch(t *testing.T) {
+	t.Run("it_should_delete_by_receipt_handle_and_reject_unknown_handles", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue", QueueConfig{})
+		sendBodies(t, e, url, "", "a")
+		m := receive(t, e, url, 1)[0]
+
+		out, err := e.DeleteMessageBatch(context.Background(), &awssqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(url),
+			Entries: []types.DeleteMessageBatchRequestEntry{
+				{Id: aws.String("ok"), ReceiptHandle: m.ReceiptHandle},
+				{Id: aws.String("bad"), ReceiptHandle: aws.String("unknown")},
+			},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, out.Successful, 1)
+		require.Len(t, out.Failed, 1)
+		assert.Equal(t, "ReceiptHandleIsInvalid", aws.ToString(out.Failed[0].Code))
+		assert.True(t, out.Failed[0].SenderFault)
+		assert.Empty(t, e.Bodies("queue"))
+	})
+}
+
+func TestEmulator_ChangeMessageVisibilityBatch(t *testing.T) {
+	t.Run("it_should_extend_and_reset_visibility", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue", QueueConfig{VisibilityTimeout: 10 * time.Second})
+		sendBodies(t, e, url, "", "a")
+		m := receive(t, e, url, 1)[0]
+
+		out, err := e.ChangeMessageVisibilityBatch(context.Background(), &awssqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(url),
+			Entries: []types.ChangeMessageVisibilityBatchRequestEntry{
+				{Id: aws.String("1"), ReceiptHandle: m.ReceiptHandle, VisibilityTimeout: 60},
+			},
+		})
+		require.NoError(t, err)
+		assert.Len(t, out.Successful, 1)
+
+		e.Advance(30 * time.Second)
+		assert.Empty(t, receive(t, e, url, 1), "visibility should have been extended")
+
+		_, err = e.ChangeMessageVisibility(context.Background(), &awssqs.ChangeMessageVisibilityInput{
+			QueueUrl: aws.String(url), ReceiptHandle: m.ReceiptHandle, VisibilityTimeout: 0,
+		})
+		require.NoError(t, err)
+		assert.Len(t, receive(t, e, url, 1), 1, "a zero timeout should make the message visible")
+	})
+
+	t.Run("it_should_fail_for_messages_not_in_flight", func(t *testing.T) {
+		e := NewEmulator()
+		url := e.CreateQueue("queue", QueueConfig{VisibilityTimeout: time.Second})
+		sendBodies(t, e, url, "", "a")
+		m := receive(t, e, url, 1)[0]
+		e.Advance(time.Second)
+
+		_, err := e.ChangeMessageVisibility(context.Background(), &awssqs.ChangeMessageVisibilityInput{
+			QueueUrl: aws.String(url), ReceiptHandle: m.ReceiptHandle, VisibilityTimeout: 10,
+		})
+
+		var notInflight *types.MessageNotInflight
+		assert.ErrorAs(t, err, &notInflight)
+	})
+}
@@ -30,6 +30,12 @@ func newProxyUnderTest(t *testing.T) API {
 			_, _ = w.Write([]byte(`{"Successful":[{"Id":"id-1","MessageId":"m-1","MD5OfMessageBody":"841a2d689ad86bd1611447453c22c6fc"}],"Failed":[]}`))
 		case strings.HasSuffix(target, "DeleteMessageBatch"):
 			_, _ = w.Write([]byte(`{"Successful":[{"Id":"id-1"}],"Failed":[]}`))
+		case strings.HasSuffix(target, "ChangeMessageVisibilityBatch"):
+			_, _ = w.Write([]byte(`{"Successful":[{"Id":"id-1"}],"Failed":[]}`))
+		case strings.HasSuffix(target, "ChangeMessageVisibility"):
+			_, _ = w.Write([]byte(`{}`))
+		case strings.HasSuffix(target, "ReceiveMessage"):
+			_, _ = w.Write([]byte(`{"Messages":[{"MessageId":"m-1","ReceiptHandle":"rh-1","Body":"body","MD5OfBody":"841a2d689ad86bd1611447453c22c6fc"}]}`))
 		default:
 			w.WriteHeader(http.StatusBadRequest)
 		}
@@ -98,3 +104,50 @@ func TestProxy_DeleteMessageBatch(t *testing.T) {
 		assert.Equal(t, "id-1", aws.ToString(out.Successful[0].Id))
 	})
 }
+
+func TestProxy_ReceiveMessage(t *testing.T) {
+	t.Run("it_should_forward_the_call", func(t *testing.T) {
+		p := newProxyUnderTest(t)
+
+		out, err := p.ReceiveMessage(context.Background(), &awssqs.ReceiveMessageInput{
+			QueueUrl:            aws.String("https://sqs.test/queue"),
+			MaxNumberOfMessages: 1,
+		})
+
+		require.NoError(t, err)
+		require.Len(t, out.Messages, 1)
+		assert.Equal(t, "rh-1", aws.ToString(out.Messages[0].ReceiptHandle))
+	})
+}
+
+func TestProxy_ChangeMessageVisibility(t *testing.T) {
+	t.Run("it_should_forward_the_call", func(t *testing.T) {
+		p := newProxyUnderTest(t)
+
+		out, err := p.ChangeMessageVisibility(context.Background(), &awssqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String("https://sqs.test/queue"),
+			ReceiptHandle:     aws.String("rh-1"),
+			VisibilityTimeout: 30,
+		})
+
+		require.NoError(t, err)
+		assert.NotNil(t, out)
+	})
+}
+
+func TestProxy_ChangeMessageVisibilityBatch(t *testing.T) {
+	t.Run("it_should_forward_the_call", func(t *testing.T) {
+		p := newProxyUnderTest(t)
+
+		out, err := p.ChangeMessageVisibilityBatch(context.Background(), &awssqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String("https://sqs.test/queue"),
+			Entries: []types.ChangeMessageVisibilityBatchRequestEntry{
+				{Id: aws.String("id-1"), ReceiptHandle: aws.String("rh-1"), VisibilityTimeout: 30},
+			},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, out.Successful, 1)
+		assert.Equal(t, "id-1", aws.ToString(out.Successful[0].Id))
+	})
+}
@@ -0,0 +1,93 @@
+package inssqs
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"go.opentelemetry.io/otel"
+)
+
+// maxMessageAttributes is the maximum number of message attributes SQS accepts on a single message.
+const maxMessageAttributes = 10
+
+// messageAttributeCarrier adapts message attributes to a propagation.TextMapCarrier,
+// storing propagated fields as String attributes.
+type messageAttributeCarrier map[string]SQSMessageAttribute
+
+func (c messageAttributeCarrier) Get(key string) string {
+	a, ok := c[key]
+	if !ok || a.StringValue == nil {
+		return ""
+	}
+
+	return *a.StringValue
+}
+
+func (c messageAttributeCarrier) Set(key string, value string) {
+	c[key] = StringAttribute(value)
+}
+
+func (c messageAttributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// injectTraceContext adds the trace context of ctx, as produced by the global OpenTelemetry propagator,
+// to the message attributes of every entry. Attributes already set on an entry are kept, and entries
+// that have no room left for the propagated fields are sent without them.
+// The attribute maps of the given entries are never modified, entries receiving the trace context get a copy.
+func (q *queue) injectTraceContext(ctx context.Context, entries []SQSMessageEntry) []SQSMessageEntry {
+	fields := messageAttributeCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, fields)
+	if len(fields) == 0 {
+		return entries
+	}
+
+	injected := make([]SQSMessageEntry, len(entries))
+	for i, e := range entries {
+		injected[i] = e
+
+		missing := 0
+		for k := range fields {
+			if _, ok := e.MessageAttributes[k]; !ok {
+				missing++
+			}
+		}
+
+		if missing == 0 {
+			continue
+		}
+
+		if len(e.MessageAttributes)+missing > maxMessageAttributes {
+			q.logger.Debugf("Not injecting trace context into message %s, attribute limit reached\n", aws.ToString(e.Id))
+			continue
+		}
+
+		attributes := make(map[string]SQSMessageAttribute, len(e.MessageAttributes)+missing)
+		for k, a := range e.MessageAttributes {
+			attributes[k] = a
+		}
+
+		for k, a := range fields {
+			if _, ok := attributes[k]; !ok {
+				attributes[k] = a
+			}
+		}
+
+		injected[i].MessageAttributes = attributes
+	}
+
+	return injected
+}
+
+// extractTraceContext returns a context carrying the trace context propagated in the message attributes.
+func extractTraceContext(ctx context.Context, m SQSMessage) context.Context {
+	if len(m.MessageAttributes) == 0 {
+		return ctx
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, messageAttributeCarrier(m.MessageAttributes))
+}
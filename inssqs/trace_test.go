@@ -0,0 +1,80 @@
+package inssqs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func withTraceContextPropagator(t *testing.T) context.Context {
+	t.Helper()
+
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	return trace.ContextWithSpanContext(context.Background(), sc)
+}
+
+func TestQueue_injectTraceContext(t *testing.T) {
+	t.Run("it_should_add_traceparent_without_modifying_caller_attributes", func(t *testing.T) {
+		ctx := withTraceContextPropagator(t)
+		q, _ := newQueue(t)
+
+		attributes := map[string]SQSMessageAttribute{"tenant": StringAttribute("acme")}
+		entries := []SQSMessageEntry{{Id: aws.String("1"), MessageAttributes: attributes}}
+
+		injected := q.injectTraceContext(ctx, entries)
+
+		require.Contains(t, injected[0].MessageAttributes, "traceparent")
+		assert.Equal(t, "acme", aws.ToString(injected[0].MessageAttributes["tenant"].StringValue))
+		assert.NotContains(t, attributes, "traceparent", "caller attributes should not be modified")
+	})
+
+	t.Run("it_should_skip_entries_at_the_attribute_limit", func(t *testing.T) {
+		ctx := withTraceContextPropagator(t)
+		q, _ := newQueue(t)
+
+		attributes := make(map[string]SQSMessageAttribute, maxMessageAttributes)
+		for i := 0; i < maxMessageAttributes; i++ {
+			attributes[string(rune('a'+i))] = NumberAttribute(i)
+		}
+
+		injected := q.injectTraceContext(ctx, []SQSMessageEntry{{Id: aws.String("1"), MessageAttributes: attributes}})
+
+		assert.NotContains(t, injected[0].MessageAttributes, "traceparent")
+	})
+
+	t.Run("it_should_leave_entries_unchanged_without_trace_context", func(t *testing.T) {
+		q, _ := newQueue(t)
+		entries := []SQSMessageEntry{{Id: aws.String("1")}}
+
+		injected := q.injectTraceContext(context.Background(), entries)
+
+		assert.Nil(t, injected[0].MessageAttributes)
+	})
+}
+
+func Test_extractTraceContext(t *testing.T) {
+	t.Run("it_should_restore_the_injected_span_context", func(t *testing.T) {
+		ctx := withTraceContextPropagator(t)
+		q, _ := newQueue(t)
+
+		injected := q.injectTraceContext(ctx, []SQSMessageEntry{{Id: aws.String("1")}})
+		extracted := extractTraceContext(context.Background(), SQSMessage{MessageAttributes: injected[0].MessageAttributes})
+
+		assert.Equal(t, trace.SpanContextFromContext(ctx).TraceID(), trace.SpanContextFromContext(extracted).TraceID())
+	})
+}